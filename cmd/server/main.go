@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
@@ -13,9 +14,11 @@ import (
 	clientv3 "go.etcd.io/etcd/client/v3"
 
 	"github.com/ryandielhenn/zephyrcache/internal/telemetry"
+	"github.com/ryandielhenn/zephyrcache/pkg/httpcache"
 	"github.com/ryandielhenn/zephyrcache/pkg/kv"
 	"github.com/ryandielhenn/zephyrcache/pkg/node"
 	discovery "github.com/ryandielhenn/zephyrcache/pkg/registry"
+	"github.com/ryandielhenn/zephyrcache/pkg/replication"
 	"github.com/ryandielhenn/zephyrcache/pkg/ring"
 )
 
@@ -33,6 +36,16 @@ func main() {
 		}
 	}
 	n := node.NewNodeRF(store, r, node.NormalizeHostPort(addr, "8080"), rf)
+	if v := os.Getenv("MAX_VALUE_BYTES"); v != "" {
+		if limit, err := strconv.ParseInt(v, 10, 64); err == nil && limit > 0 {
+			n.SetMaxValueBytes(limit)
+		}
+	}
+	if v := os.Getenv("CDC_BUFFER"); v != "" {
+		if capacity, err := strconv.Atoi(v); err == nil && capacity >= 0 {
+			n.SetCDCBuffer(capacity)
+		}
+	}
 	// 2. Create etcd client
 	log.Printf("[Boot] creating etcd client")
 	cli, err := clientv3.New(clientv3.Config{
@@ -81,12 +94,35 @@ func main() {
 	})
 	log.Printf("[BOOT] after WatchPeers")
 
-	// 6. Wire up HTTP node endpoints
+	// 6. Watch namespace configs
+	discovery.WatchNamespaces(cli, func(configs map[string]string) {
+		n.SyncNamespaces(configs)
+		log.Printf("[WatchNamespaces Callback] synced %d namespaces\n", len(configs))
+	})
+	telemetry.SetNamespaceSource(func() map[string]telemetry.NamespaceStats {
+		out := make(map[string]telemetry.NamespaceStats)
+		for name, st := range n.NamespaceStats() {
+			out[name] = telemetry.NamespaceStats(st)
+		}
+		return out
+	})
+	telemetry.SetWriteBehindSource(func() map[string]telemetry.WriteBehindStats {
+		out := make(map[string]telemetry.WriteBehindStats)
+		for name, st := range n.WriteBehindStats() {
+			out[name] = telemetry.WriteBehindStats(st)
+		}
+		return out
+	})
+
+	// 7. Wire up HTTP node endpoints
 	mux := http.NewServeMux()
 	mux.HandleFunc("/healthz", n.Healthz)
 	mux.HandleFunc("/info", n.Info)
+	mux.HandleFunc("/ring", n.Ring)
+	mux.HandleFunc("/cluster", n.Cluster)
+	mux.HandleFunc("/locate", n.Locate)
 	mux.Handle("/metrics", telemetry.MetricsHandler())
-	mux.HandleFunc("/kv/", func(w http.ResponseWriter, req *http.Request) {
+	kvHandler := func(w http.ResponseWriter, req *http.Request) {
 		op := methodToOp(req.Method) // "get" | "put" | "post" | "delete" | "other"
 		telemetry.Instrument(op, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			switch r.Method {
@@ -100,11 +136,98 @@ func main() {
 				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
 			}
 		})).ServeHTTP(w, req)
-	})
+	}
+	mux.HandleFunc("/kv/", kvHandler)
+	mux.HandleFunc("/ns/{ns}/kv/", kvHandler)
+	ttlHandler := telemetry.Instrument("ttl", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodPut, http.MethodPost:
+			n.TTL(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	}))
+	mux.Handle("/ttl/", ttlHandler)
+	mux.Handle("/ns/{ns}/ttl/", ttlHandler)
+	for section, h := range map[string]http.HandlerFunc{
+		"hash":      n.Hash,
+		"list":      n.List,
+		"set":       n.Set,
+		"zset":      n.ZSet,
+		"json":      n.JSON,
+		"lock":      n.Lock,
+		"ratelimit": n.RateLimit,
+	} {
+		instrumented := telemetry.Instrument(section, h)
+		mux.Handle("/"+section+"/", instrumented)
+		mux.Handle("/ns/{ns}/"+section+"/", instrumented)
+	}
+	mux.Handle("/watch", telemetry.Instrument("watch", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n.Watch(w, r)
+	})))
+	mux.Handle("/cdc", telemetry.Instrument("cdc", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n.Changes(w, r)
+	})))
+	mux.Handle("/dump", telemetry.Instrument("dump", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		n.Dump(w, r)
+	})))
+	mux.Handle("/invalidate", telemetry.Instrument("invalidate", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodDelete:
+			n.Invalidate(w, r)
+		default:
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})))
+
+	postHandler := func(op string, h http.HandlerFunc) http.Handler {
+		return telemetry.Instrument(op, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h(w, r)
+		}))
+	}
+	mux.Handle("/mget", postHandler("mget", n.MGet))
+	mux.Handle("/mset", postHandler("mset", n.MSet))
+	mux.Handle("/mdel", postHandler("mdel", n.MDel))
+	mux.Handle("/txn", postHandler("txn", n.Txn))
+	mux.Handle(replication.IngestPath, postHandler("replicate", n.Replicate))
+
+	// 8. Optionally mirror namespaces to another cluster
+	if target := os.Getenv("REPLICATE_TO"); target != "" {
+		r := replication.New(replication.Config{
+			Target:     target,
+			Namespaces: strings.Split(os.Getenv("REPLICATE_NAMESPACES"), ","),
+		})
+		n.SetReplicator(r)
+		telemetry.SetReplicationSource(func() telemetry.ReplicationStats {
+			return telemetry.ReplicationStats(r.Stats())
+		})
+		log.Printf("[Boot] mirroring namespaces %s to %s", os.Getenv("REPLICATE_NAMESPACES"), target)
+	}
+
+	// 9. Optionally serve as a shared HTTP cache in front of an origin
+	if origin := os.Getenv("PROXY_ORIGIN"); origin != "" {
+		serveProxy(n, mux, origin)
+	}
 
 	addr = ":8080"
 	fmt.Println("ZephyrCache node listening on", addr)
-	if err := http.ListenAndServe(addr, mux); err != nil {
+	if err := http.ListenAndServe(addr, n.WithRingEpoch(mux)); err != nil {
 		log.Fatal(err)
 	}
 }
@@ -123,3 +246,43 @@ func methodToOp(m string) string {
 		return "other"
 	}
 }
+
+// serveProxy starts the HTTP cache listener on PROXY_ADDR (default :8081),
+// caching origin in namespace PROXY_NAMESPACE (default "default"), and mounts
+// the handler peers route owned requests to on mux. A bad setting only
+// disables the proxy, and requests pass to the origin uncached while the
+// namespace does not exist.
+func serveProxy(n *node.Node, mux *http.ServeMux, origin string) {
+	originURL, err := url.Parse(origin)
+	if err != nil {
+		log.Printf("[Proxy] disabled: invalid PROXY_ORIGIN: %v", err)
+		return
+	}
+	listen := os.Getenv("PROXY_ADDR")
+	if listen == "" {
+		listen = ":8081"
+	}
+	ns := os.Getenv("PROXY_NAMESPACE")
+	if ns == "" {
+		ns = node.DefaultNamespace
+	}
+	if _, ok := n.Store(ns); !ok {
+		log.Printf("[Proxy] namespace %q does not exist yet; passing requests to the origin uncached until it does", ns)
+	}
+
+	// peers reach the owner over the node listener, where the routed handler
+	// lives; the proxy listener itself always routes by the ring
+	p := httpcache.New(originURL, nil, func(key string) (string, bool, bool) {
+		owner, self, ok := n.OwnerForKey(key)
+		return owner, owner == self, ok
+	})
+	// namespaces come and go with config syncs, so look the store up each time
+	p.StoreFunc = func() (*kv.Store, bool) { return n.Store(ns) }
+	mux.Handle(httpcache.RoutedPath+"/", telemetry.Instrument("proxy", p.Routed()))
+	go func() {
+		fmt.Println("ZephyrCache proxy listening on", listen, "for origin", origin)
+		if err := http.ListenAndServe(listen, telemetry.Instrument("proxy", p)); err != nil {
+			log.Printf("[Proxy] disabled: %v", err)
+		}
+	}()
+}
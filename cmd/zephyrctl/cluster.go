@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/ring"
+)
+
+// headerRingEpoch is the header nodes send the epoch of their ring in.
+const headerRingEpoch = "X-Zephyr-Ring-Epoch"
+
+// member is a node as /cluster and /locate describe it.
+type member struct {
+	ID           string  `json:"id"`
+	Addr         string  `json:"addr"`
+	OwnershipPct float64 `json:"ownership_pct"`
+}
+
+// clusterInfo is the answer of /cluster.
+type clusterInfo struct {
+	Epoch             string   `json:"epoch"`
+	Replicas          int      `json:"replicas"`
+	ReplicationFactor int      `json:"replication_factor"`
+	Members           []member `json:"members"`
+}
+
+// cluster fetches the ring the node c talks to routes by.
+func (c *ctl) cluster(ctx context.Context) (clusterInfo, error) {
+	var info clusterInfo
+	err := c.getJSON(ctx, c.addr, "/cluster", &info)
+	return info, err
+}
+
+func cmdLocate(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("locate", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	var res struct {
+		Epoch string   `json:"epoch"`
+		Nodes []member `json:"nodes"`
+	}
+	if err := c.getJSON(ctx, c.addr, "/locate?key="+url.QueryEscape(fs.Arg(0)), &res); err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROLE\tNODE\tADDR")
+	for i, m := range res.Nodes {
+		role := "replica"
+		if i == 0 {
+			role = "owner"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", role, m.ID, m.Addr)
+	}
+	fmt.Fprintf(tw, "\nring epoch %s\n", res.Epoch)
+	return tw.Flush()
+}
+
+func cmdCluster(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("cluster", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil || fs.Arg(0) != "status" {
+		return errUsage
+	}
+	info, err := c.cluster(ctx)
+	if err != nil {
+		return err
+	}
+
+	// ask every member whether it is up and which ring it routes by
+	type health struct {
+		status string
+		epoch  string
+	}
+	healths := make([]health, len(info.Members))
+	var wg sync.WaitGroup
+	for i, m := range info.Members {
+		wg.Add(1)
+		go func(i int, addr string) {
+			defer wg.Done()
+			h := health{status: "ok"}
+			resp, err := c.do(ctx, http.MethodGet, addr, "/healthz", nil)
+			if err != nil {
+				healths[i] = health{status: "down: " + err.Error()}
+				return
+			}
+			h.epoch = resp.Header.Get(headerRingEpoch)
+			resp.Body.Close()
+			healths[i] = h
+		}(i, hostPort(m.Addr))
+	}
+	wg.Wait()
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tADDR\tOWNERSHIP\tHEALTH\tRING")
+	down, disagree := 0, 0
+	for i, m := range info.Members {
+		h := healths[i]
+		ringState := "agrees"
+		switch {
+		case h.epoch == "":
+			ringState = "-"
+			down++
+		case h.epoch != info.Epoch:
+			ringState = "differs (" + h.epoch + ")"
+			disagree++
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%.2f%%\t%s\t%s\n", m.ID, m.Addr, m.OwnershipPct, h.status, ringState)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(c.out, "\n%d members, %d down, %d on a different ring; epoch %s, %d tokens per node, replication factor %d\n",
+		len(info.Members), down, disagree, info.Epoch, info.Replicas, info.ReplicationFactor)
+	if len(info.Members) > 0 {
+		lo, hi := info.Members[0].OwnershipPct, info.Members[0].OwnershipPct
+		for _, m := range info.Members {
+			lo, hi = min(lo, m.OwnershipPct), max(hi, m.OwnershipPct)
+		}
+		ideal := 100 / float64(len(info.Members))
+		fmt.Fprintf(c.out, "ownership skew: min %.2f%%, max %.2f%%, ideal %.2f%%; the largest node owns %.2fx its share\n",
+			lo, hi, ideal, hi/ideal)
+	}
+	if down > 0 || disagree > 0 {
+		return fmt.Errorf("cluster unhealthy: %d down, %d on a different ring", down, disagree)
+	}
+	return nil
+}
+
+// listFlag collects the values of a flag given several times.
+type listFlag []string
+
+func (l *listFlag) String() string     { return strings.Join(*l, ",") }
+func (l *listFlag) Set(v string) error { *l = append(*l, v); return nil }
+
+func cmdRing(ctx context.Context, c *ctl, args []string) error {
+	if len(args) == 0 || args[0] != "simulate" {
+		return errUsage
+	}
+	fs := flag.NewFlagSet("ring simulate", flag.ContinueOnError)
+	var add, remove listFlag
+	fs.Var(&add, "add", "add node `id=addr` (repeatable)")
+	fs.Var(&remove, "remove", "remove node `id` (repeatable)")
+	keys := fs.Int("keys", 100000, "number of sample keys to place")
+	if err := parseFlags(fs, args[1:], 0); err != nil {
+		return err
+	}
+	if len(add)+len(remove) == 0 || *keys <= 0 {
+		return errUsage
+	}
+	info, err := c.cluster(ctx)
+	if err != nil {
+		return err
+	}
+
+	// rebuild the cluster's ring, as the nodes do, before and after
+	before, after := ring.New(info.Replicas, ring.FNV32a), ring.New(info.Replicas, ring.FNV32a)
+	for _, m := range info.Members {
+		before.Add(m.ID, m.Addr)
+		after.Add(m.ID, m.Addr)
+	}
+	for _, id := range remove {
+		if _, ok := after.Addr(id); !ok {
+			return fmt.Errorf("ring simulate: %s is not a member", id)
+		}
+		after.Remove(id)
+	}
+	for _, spec := range add {
+		id, addr, ok := strings.Cut(spec, "=")
+		if !ok || id == "" || addr == "" {
+			return fmt.Errorf("ring simulate: -add wants id=addr, got %q", spec)
+		}
+		after.Add(id, hostPort(addr))
+	}
+	if len(after.Nodes()) == 0 {
+		return fmt.Errorf("ring simulate: no nodes would be left")
+	}
+
+	// place sample keys on both rings and count what changes hands
+	rf := max(info.ReplicationFactor, 1)
+	gained, lost := make(map[string]int), make(map[string]int)
+	moved, replicasMoved := 0, 0
+	for i := range *keys {
+		key := []byte("sample:" + strconv.Itoa(i))
+		from, to := before.Lookup(key), after.Lookup(key)
+		if from != to {
+			moved++
+			lost[from]++
+			gained[to]++
+		}
+		if !slices.Equal(before.LookupN(key, rf), after.LookupN(key, rf)) {
+			replicasMoved++
+		}
+	}
+
+	ownBefore, ownAfter := before.Ownership(), after.Ownership()
+	ids := slices.Sorted(maps.Keys(ownAfter))
+	for id := range ownBefore {
+		if _, ok := ownAfter[id]; !ok {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tBEFORE\tAFTER\tGAINS\tLOSES")
+	for _, id := range ids {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%d\n", id, pct(ownBefore, id), pct(ownAfter, id), gained[id], lost[id])
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "\n%d of %d sample keys (%.2f%%) change owner; %d (%.2f%%) change replica set (rf %d)\n",
+		moved, *keys, 100*float64(moved)/float64(*keys), replicasMoved, 100*float64(replicasMoved)/float64(*keys), rf)
+	fmt.Fprintf(c.out, "a perfectly balanced ring would move %.2f%% of the keys\n", 100*idealMovement(len(ownBefore), len(ownAfter), len(remove)))
+	return nil
+}
+
+// pct formats the share of the ring id owns, or "-" if it is not a member.
+func pct(own map[string]float64, id string) string {
+	share, ok := own[id]
+	if !ok {
+		return "-"
+	}
+	return fmt.Sprintf("%.2f%%", 100*share)
+}
+
+// idealMovement is the share of keys a membership change from n to m nodes
+// moves when every node owns exactly its share and only the keys of removed
+// nodes or the share of added ones move.
+func idealMovement(n, m, removed int) float64 {
+	added := m - n + removed
+	if n == 0 || m == 0 {
+		return 1
+	}
+	// removed nodes lose everything they owned; added ones take their share
+	// of what is left
+	lostShare := float64(removed) / float64(n)
+	return lostShare + (1-lostShare)*float64(added)/float64(m)
+}
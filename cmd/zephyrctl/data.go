@@ -0,0 +1,226 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/replication"
+)
+
+func cmdInvalidatePrefix(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("invalidate-prefix", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	if fs.Arg(0) == "" {
+		return errors.New("invalidate-prefix: refusing to delete every key; give a non-empty prefix")
+	}
+	q := url.Values{"ns": {c.ns}, "prefix": {fs.Arg(0)}}
+
+	// a node that could not reach every peer answers 502 with the same body
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+c.addr+"/invalidate?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var res struct {
+		Deleted int `json:"deleted"`
+		Failed  int `json:"failed"`
+		Nodes   []struct {
+			Node    string `json:"node"`
+			Addr    string `json:"addr"`
+			Deleted int    `json:"deleted"`
+			Error   string `json:"error"`
+		} `json:"nodes"`
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusBadGateway {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return &statusError{status: resp.StatusCode, msg: string(bytes.TrimSpace(msg))}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "NODE\tADDR\tDELETED\tERROR")
+	for _, n := range res.Nodes {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%s\n", n.Node, n.Addr, n.Deleted, n.Error)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(c.out, "\ndeleted %d keys\n", res.Deleted)
+	if res.Failed > 0 {
+		return fmt.Errorf("%d nodes could not be reached; their keys are still there", res.Failed)
+	}
+	return nil
+}
+
+func cmdDump(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("dump", flag.ContinueOnError)
+	out := fs.String("o", "-", "file to write to, - for stdout")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	info, err := c.cluster(ctx)
+	if err != nil {
+		return err
+	}
+	w := c.out
+	if *out != "-" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	// every node holds the keys it owns; a dump missing a node is no dump
+	total := 0
+	for _, m := range info.Members {
+		resp, err := c.stream(ctx, http.MethodGet, hostPort(m.Addr), "/dump?ns="+url.QueryEscape(c.ns), nil)
+		if err != nil {
+			return fmt.Errorf("dump %s (%s): %w", m.ID, m.Addr, err)
+		}
+		n, err := copyLines(w, resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("dump %s (%s): %w", m.ID, m.Addr, err)
+		}
+		total += n
+	}
+	fmt.Fprintf(os.Stderr, "dumped %d keys of namespace %s from %d nodes\n", total, c.ns, len(info.Members))
+	return nil
+}
+
+// copyLines copies the JSON lines of a node's dump to w and counts them.
+func copyLines(w io.Writer, r io.Reader) (int, error) {
+	dec := json.NewDecoder(r)
+	n := 0
+	for {
+		var line json.RawMessage
+		err := dec.Decode(&line)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return n, err
+		}
+		n++
+	}
+}
+
+func cmdRestore(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ContinueOnError)
+	in := fs.String("i", "-", "file to read, - for stdin")
+	into := fs.String("into", "", "namespace to restore into (default the one each key was dumped from)")
+	batchSize := fs.Int("batch", 500, "keys per request")
+	if err := parseFlags(fs, args, 0); err != nil {
+		return err
+	}
+	r := io.Reader(os.Stdin)
+	if *in != "-" {
+		f, err := os.Open(*in)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var (
+		total      struct{ Applied, Ignored, Skipped, Failed, Expired int }
+		batch      []replication.Record
+		batchBytes int // estimated size of batch
+	)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		data, err := json.Marshal(batch)
+		if err != nil {
+			return err
+		}
+		batch, batchBytes = batch[:0], 0
+		resp, err := c.stream(ctx, http.MethodPost, c.addr, replication.IngestPath, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+			return &statusError{status: resp.StatusCode, msg: string(bytes.TrimSpace(msg))}
+		}
+		var res struct{ Applied, Ignored, Skipped, Failed int }
+		if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+			return err
+		}
+		total.Applied += res.Applied
+		total.Ignored += res.Ignored
+		total.Skipped += res.Skipped
+		total.Failed += res.Failed
+		return nil
+	}
+
+	dec := json.NewDecoder(r)
+	nowMs := time.Now().UnixMilli()
+	for {
+		var rec replication.Record
+		err := dec.Decode(&rec)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("restore: reading the dump: %w", err)
+		}
+		if rec.ExpireAt != 0 && rec.ExpireAt <= nowMs {
+			total.Expired++
+			continue
+		}
+		if *into != "" {
+			rec.Namespace = *into
+		}
+		// nodes refuse batches over replication.MaxBatchBytes
+		if len(batch) > 0 && batchBytes+rec.Size() > replication.MaxBatchBytes {
+			if err := flush(); err != nil {
+				return fmt.Errorf("restore: %w", err)
+			}
+		}
+		batch, batchBytes = append(batch, rec), batchBytes+rec.Size()
+		if len(batch) >= *batchSize {
+			if err := flush(); err != nil {
+				return fmt.Errorf("restore: %w", err)
+			}
+		}
+	}
+	if err := flush(); err != nil {
+		return fmt.Errorf("restore: %w", err)
+	}
+
+	fmt.Fprintf(c.out, "restored %d keys; %d already newer, %d expired, %d in unknown namespaces, %d failed\n",
+		total.Applied, total.Ignored, total.Expired, total.Skipped, total.Failed)
+	if total.Failed > 0 {
+		return fmt.Errorf("restore: %d keys failed", total.Failed)
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/client"
+)
+
+// client returns a ring-aware client seeded with the node c talks to, so
+// that keys are read and written on their owners directly.
+func (c *ctl) client(ctx context.Context) (*client.Client, error) {
+	return client.New(ctx, client.Config{Seeds: []string{c.addr}, Namespace: c.ns})
+}
+
+func cmdGet(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("get", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	cl, err := c.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	val, err := cl.Get(ctx, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	_, err = c.out.Write(val)
+	return err
+}
+
+func cmdPut(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("put", flag.ContinueOnError)
+	ttl := fs.Duration("ttl", 0, "expire the key after this long")
+	if err := parseFlags(fs, args, -1); err != nil {
+		return err
+	}
+	var val []byte
+	switch fs.NArg() {
+	case 1:
+		var err error
+		if val, err = io.ReadAll(os.Stdin); err != nil {
+			return err
+		}
+	case 2:
+		val = []byte(fs.Arg(1))
+	default:
+		return errUsage
+	}
+	cl, err := c.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	return cl.Put(ctx, fs.Arg(0), val, *ttl)
+}
+
+func cmdDel(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("del", flag.ContinueOnError)
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	cl, err := c.client(ctx)
+	if err != nil {
+		return err
+	}
+	defer cl.Close()
+	return cl.Delete(ctx, fs.Arg(0))
+}
+
+// ttlResponse is the answer of the /ttl endpoint.
+type ttlResponse struct {
+	TTLMs    int64 `json:"ttl_ms"` // -1 if the key does not expire
+	ExpireAt int64 `json:"expire_at,omitempty"`
+	Sliding  bool  `json:"sliding"`
+}
+
+func cmdTTL(ctx context.Context, c *ctl, args []string) error {
+	fs := flag.NewFlagSet("ttl", flag.ContinueOnError)
+	set := fs.Duration("set", 0, "expire the key this long from now")
+	persist := fs.Bool("persist", false, "remove the key's expiry")
+	if err := parseFlags(fs, args, 1); err != nil {
+		return err
+	}
+	method, q := http.MethodGet, url.Values{}
+	switch {
+	case *set > 0 && *persist:
+		return errUsage
+	case *set > 0:
+		method = http.MethodPut
+		q.Set("ttl_ms", strconv.FormatInt(set.Milliseconds(), 10))
+	case *persist:
+		method = http.MethodPut
+		q.Set("persist", "true")
+	}
+	uri := c.nsPath("ttl", fs.Arg(0))
+	if len(q) > 0 {
+		uri += "?" + q.Encode()
+	}
+	resp, err := c.do(ctx, method, c.addr, uri, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	var res ttlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return err
+	}
+
+	if res.TTLMs < 0 {
+		fmt.Fprintln(c.out, "no expiry")
+		return nil
+	}
+	ttl := (time.Duration(res.TTLMs) * time.Millisecond).String()
+	if res.Sliding {
+		ttl += " (sliding)"
+	}
+	fmt.Fprintf(c.out, "%s, expires at %s\n", ttl, time.UnixMilli(res.ExpireAt).Format(time.RFC3339))
+	return nil
+}
@@ -0,0 +1,221 @@
+// Command zephyrctl operates a zephyrcache cluster through the HTTP API of
+// its nodes: it reads and writes keys, shows where keys live and how the ring
+// is balanced, simulates membership changes, invalidates keys and dumps and
+// restores namespaces.
+//
+// Usage:
+//
+//	zephyrctl [-addr host:port] [-ns namespace] <command> [flags] [args]
+//
+// The node to talk to defaults to $ZEPHYR_ADDR, or localhost:8080.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+)
+
+const usage = `usage: zephyrctl [-addr host:port] [-ns namespace] <command> [flags] [args]
+
+Keys:
+  get <key>                        print the value of key
+  put [-ttl d] <key> [value]       write key, reading the value from stdin if omitted
+  del <key>                        delete key
+  ttl [-set d | -persist] <key>    show or change when key expires
+
+Cluster:
+  locate <key>                     nodes key is placed on, owner first
+  cluster status                   members, their health and ownership skew
+  ring simulate [-add id=addr]... [-remove id]... [-keys n]
+                                   show how many keys a membership change moves
+
+Data:
+  invalidate-prefix <prefix>       delete every key starting with prefix on all nodes
+  dump [-o file]                   write the namespace's values as JSON lines
+  restore [-i file] [-into ns]     write dumped values back to their owners
+`
+
+// requestTimeout bounds every request but the streaming ones, dumps and
+// restore batches, which take as long as the data they carry.
+const requestTimeout = 30 * time.Second
+
+// ctl is the state shared by all commands.
+type ctl struct {
+	addr    string // host:port of the node to talk to
+	ns      string
+	http    *http.Client
+	timeout time.Duration // of each short request, see requestTimeout
+	out     io.Writer
+}
+
+// command runs one subcommand with the arguments that follow its name.
+type command func(ctx context.Context, c *ctl, args []string) error
+
+var commands = map[string]command{
+	"get":               cmdGet,
+	"put":               cmdPut,
+	"del":               cmdDel,
+	"ttl":               cmdTTL,
+	"locate":            cmdLocate,
+	"cluster":           cmdCluster,
+	"ring":              cmdRing,
+	"invalidate-prefix": cmdInvalidatePrefix,
+	"dump":              cmdDump,
+	"restore":           cmdRestore,
+}
+
+// errUsage makes main print the usage and exit with status 2.
+var errUsage = errors.New("invalid usage")
+
+func main() {
+	addr := os.Getenv("ZEPHYR_ADDR")
+	if addr == "" {
+		addr = "localhost:8080"
+	}
+	flag.StringVar(&addr, "addr", addr, "node to talk to (default $ZEPHYR_ADDR or localhost:8080)")
+	ns := flag.String("ns", "default", "namespace")
+	flag.Usage = func() { fmt.Fprint(os.Stderr, usage) }
+	flag.Parse()
+
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		flag.Usage()
+		os.Exit(2)
+	}
+	c := &ctl{
+		addr:    hostPort(addr),
+		ns:      *ns,
+		http:    &http.Client{},
+		timeout: requestTimeout,
+		out:     os.Stdout,
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	err := cmd(ctx, c, flag.Args()[1:])
+	switch {
+	case errors.Is(err, errUsage):
+		flag.Usage()
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "zephyrctl:", err)
+		os.Exit(1)
+	}
+}
+
+// parseFlags parses the flags of a subcommand and checks that exactly nargs
+// arguments follow them; a negative nargs accepts any number.
+func parseFlags(fs *flag.FlagSet, args []string, nargs int) error {
+	fs.SetOutput(io.Discard)
+	if err := fs.Parse(args); err != nil {
+		return fmt.Errorf("%s: %w", fs.Name(), err)
+	}
+	if nargs >= 0 && fs.NArg() != nargs {
+		return errUsage
+	}
+	return nil
+}
+
+// nsPath returns the path of key under the API section, in the namespace c
+// works on.
+func (c *ctl) nsPath(section, key string) string {
+	p := "/" + section + "/" + url.PathEscape(key)
+	if c.ns != "" && c.ns != "default" {
+		p = "/ns/" + url.PathEscape(c.ns) + p
+	}
+	return p
+}
+
+// do sends a request to the node at addr and returns the response if it has
+// a 2xx status. Any other status is turned into an error carrying the
+// response's message. The request, reading the response included, must be
+// done within c.timeout.
+func (c *ctl) do(ctx context.Context, method, addr, uri string, body io.Reader) (*http.Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	resp, err := c.stream(ctx, method, addr, uri, body)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+// stream is do without a timeout, for requests that carry a whole namespace
+// and are bounded by ctx alone.
+func (c *ctl) stream(ctx context.Context, method, addr, uri string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+addr+uri, body)
+	if err != nil {
+		return nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		defer resp.Body.Close()
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return nil, &statusError{status: resp.StatusCode, msg: strings.TrimSpace(string(msg))}
+	}
+	return resp, nil
+}
+
+// cancelBody releases the timeout of a request once its response is read.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// getJSON decodes the JSON answer to GET uri from the node at addr into v.
+func (c *ctl) getJSON(ctx context.Context, addr, uri string, v any) error {
+	resp, err := c.do(ctx, http.MethodGet, addr, uri, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// statusError is a non-2xx answer from a node.
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (e *statusError) Error() string {
+	if e.msg == "" {
+		return fmt.Sprintf("%d %s", e.status, http.StatusText(e.status))
+	}
+	return fmt.Sprintf("%d %s: %s", e.status, http.StatusText(e.status), e.msg)
+}
+
+// hostPort strips any scheme from addr and adds the default node port if it
+// has none.
+func hostPort(addr string) string {
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://")
+	addr = strings.TrimSuffix(addr, "/")
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return addr + ":8080"
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/client"
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/node"
+	"github.com/ryandielhenn/zephyrcache/pkg/ring"
+)
+
+func TestHostPort(t *testing.T) {
+	for in, want := range map[string]string{
+		"localhost":           "localhost:8080",
+		"10.0.0.1:9000":       "10.0.0.1:9000",
+		"http://node-a:9000/": "node-a:9000",
+		"https://node-b":      "node-b:8080",
+		"[::1]:7000":          "[::1]:7000",
+	} {
+		if got := hostPort(in); got != want {
+			t.Errorf("hostPort(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNSPath(t *testing.T) {
+	for _, tc := range []struct{ ns, section, key, want string }{
+		{"default", "kv", "user:42", "/kv/user:42"},
+		{"", "ttl", "a/b", "/ttl/a%2Fb"},
+		{"carts", "kv", "cart 1", "/ns/carts/kv/cart%201"},
+	} {
+		c := &ctl{ns: tc.ns}
+		if got := c.nsPath(tc.section, tc.key); got != tc.want {
+			t.Errorf("nsPath(%q, %q) in %q = %q, want %q", tc.section, tc.key, tc.ns, got, tc.want)
+		}
+	}
+}
+
+func TestIdealMovement(t *testing.T) {
+	for _, tc := range []struct {
+		n, m, removed int
+		want          float64
+	}{
+		{3, 4, 0, 0.25},    // the new node takes its quarter
+		{4, 3, 1, 0.25},    // the removed node's quarter moves
+		{3, 3, 1, 5.0 / 9}, // a third is lost, and the new node takes a third of the rest
+		{0, 2, 0, 1},
+	} {
+		if got := idealMovement(tc.n, tc.m, tc.removed); math.Abs(got-tc.want) > 1e-9 {
+			t.Errorf("idealMovement(%d, %d, %d) = %v, want %v", tc.n, tc.m, tc.removed, got, tc.want)
+		}
+	}
+}
+
+// startCluster starts size nodes serving what zephyrctl talks to on loopback
+// and returns the address of the first.
+func startCluster(t *testing.T, size int) string {
+	t.Helper()
+	peers := make(map[string]string)
+	var nodes []*node.Node
+	for i := range size {
+		srv := httptest.NewUnstartedServer(nil)
+		addr := srv.Listener.Addr().String()
+		n := node.NewNode(kv.NewStore(1<<20), ring.New(client.DefaultReplicas, nil), addr)
+		mux := http.NewServeMux()
+		kvHandler := func(w http.ResponseWriter, r *http.Request) {
+			switch r.Method {
+			case http.MethodPut:
+				n.Put(w, r)
+			case http.MethodGet:
+				n.Get(w, r)
+			case http.MethodDelete:
+				n.Del(w, r)
+			}
+		}
+		mux.HandleFunc("/kv/", kvHandler)
+		mux.HandleFunc("/ns/{ns}/kv/", kvHandler)
+		mux.HandleFunc("/ring", n.Ring)
+		mux.HandleFunc("/cluster", n.Cluster)
+		mux.HandleFunc("/dump", n.Dump)
+		mux.HandleFunc("/replicate", n.Replicate)
+		srv.Config.Handler = n.WithRingEpoch(mux)
+		srv.Start()
+		t.Cleanup(srv.Close)
+		nodes = append(nodes, n)
+		peers["node"+strconv.Itoa(i)] = addr
+	}
+	for _, n := range nodes {
+		n.SyncPeers(peers)
+	}
+	return nodes[0].Addr()
+}
+
+func newCtl(addr string, out io.Writer) *ctl {
+	return &ctl{addr: addr, ns: "default", http: &http.Client{}, timeout: requestTimeout, out: out}
+}
+
+func TestDumpRestoreRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	src, dst := startCluster(t, 3), startCluster(t, 2)
+
+	want := make(map[string]string)
+	for i := range 50 {
+		key := "key:" + strconv.Itoa(i)
+		want[key] = strings.Repeat("v", i)
+		args := []string{key, want[key]}
+		if i%10 == 0 {
+			args = append([]string{"-ttl", "1h"}, args...)
+		}
+		if err := cmdPut(ctx, newCtl(src, io.Discard), args); err != nil {
+			t.Fatalf("put %s: %v", key, err)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "dump.jsonl")
+	if err := cmdDump(ctx, newCtl(src, io.Discard), []string{"-o", file}); err != nil {
+		t.Fatalf("dump: %v", err)
+	}
+	var out bytes.Buffer
+	if err := cmdRestore(ctx, newCtl(dst, &out), []string{"-i", file, "-batch", "7"}); err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if !strings.HasPrefix(out.String(), "restored 50 keys") {
+		t.Fatalf("restore said %q", out.String())
+	}
+
+	cl, err := client.New(ctx, client.Config{Seeds: []string{dst}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	for key, val := range want {
+		if got, err := cl.Get(ctx, key); err != nil || string(got) != val {
+			t.Fatalf("Get(%s) after restore = %q, %v; want %q", key, got, err, val)
+		}
+	}
+}
+
+func TestRestoreReportsRejectedBatches(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "dump.jsonl")
+	if err := os.WriteFile(file, []byte(`{"ns":"default","key":"k","value":"dg=="}`+"\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	for _, status := range []int{http.StatusAccepted, http.StatusRequestEntityTooLarge} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+			io.WriteString(w, "batch refused\n")
+		}))
+		err := cmdRestore(context.Background(), newCtl(srv.Listener.Addr().String(), io.Discard), []string{"-i", file})
+		srv.Close()
+		var se *statusError
+		if !errors.As(err, &se) || se.status != status || se.msg != "batch refused" {
+			t.Fatalf("restore against a node answering %d = %v", status, err)
+		}
+	}
+}
+
+func TestShortRequestsTimeOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	c := newCtl(srv.Listener.Addr().String(), io.Discard)
+	c.timeout = 50 * time.Millisecond
+	start := time.Now()
+	if _, err := c.do(context.Background(), http.MethodGet, c.addr, "/cluster", nil); err == nil {
+		t.Fatal("request to a hung node succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("request gave up after %v, want about %v", elapsed, c.timeout)
+	}
+}
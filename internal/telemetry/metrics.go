@@ -3,6 +3,7 @@ package telemetry
 import (
 	"net/http"
 	"strconv"
+	"sync"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -63,7 +64,7 @@ var (
 )
 
 func init() {
-	Registry.MustRegister(RequestsTotal, RequestDuration, InFlight, buildInfo, uptime)
+	Registry.MustRegister(RequestsTotal, RequestDuration, InFlight, buildInfo, uptime, namespaces, replication, writeBehind)
 }
 
 // MetricsHandler exposes /metrics. Mount it with mux.Handle("/metrics", telemetry.MetricsHandler()).
@@ -76,6 +77,173 @@ func SetBuildInfo(version, gitSHA string) {
 	buildInfo.WithLabelValues(version, gitSHA).Set(1)
 }
 
+// ---- Per-namespace store usage ----
+
+// NamespaceStats is a point-in-time view of one namespace's store.
+type NamespaceStats struct {
+	Items         int
+	UsedBytes     int
+	CapacityBytes int
+	Evictions     uint64
+}
+
+var (
+	namespaces = &namespaceCollector{}
+
+	nsItemsDesc = prometheus.NewDesc("zephyrcache_namespace_items",
+		"Number of keys stored in the namespace.", []string{"namespace"}, nil)
+	nsUsedDesc = prometheus.NewDesc("zephyrcache_namespace_used_bytes",
+		"Bytes of values stored in the namespace.", []string{"namespace"}, nil)
+	nsCapDesc = prometheus.NewDesc("zephyrcache_namespace_capacity_bytes",
+		"Byte quota of the namespace.", []string{"namespace"}, nil)
+	nsEvictDesc = prometheus.NewDesc("zephyrcache_namespace_evictions_total",
+		"Keys evicted from the namespace to stay within its quota.", []string{"namespace"}, nil)
+)
+
+// SetNamespaceSource registers the function polled on every scrape for
+// per-namespace usage, keyed by namespace name.
+func SetNamespaceSource(source func() map[string]NamespaceStats) {
+	namespaces.mu.Lock()
+	defer namespaces.mu.Unlock()
+	namespaces.source = source
+}
+
+// namespaceCollector reads namespace usage at scrape time so the stores don't
+// have to push updates on every write.
+type namespaceCollector struct {
+	mu     sync.RWMutex
+	source func() map[string]NamespaceStats
+}
+
+func (c *namespaceCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nsItemsDesc
+	ch <- nsUsedDesc
+	ch <- nsCapDesc
+	ch <- nsEvictDesc
+}
+
+func (c *namespaceCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	source := c.source
+	c.mu.RUnlock()
+	if source == nil {
+		return
+	}
+	for name, st := range source() {
+		ch <- prometheus.MustNewConstMetric(nsItemsDesc, prometheus.GaugeValue, float64(st.Items), name)
+		ch <- prometheus.MustNewConstMetric(nsUsedDesc, prometheus.GaugeValue, float64(st.UsedBytes), name)
+		ch <- prometheus.MustNewConstMetric(nsCapDesc, prometheus.GaugeValue, float64(st.CapacityBytes), name)
+		ch <- prometheus.MustNewConstMetric(nsEvictDesc, prometheus.CounterValue, float64(st.Evictions), name)
+	}
+}
+
+// ---- Cross-cluster replication ----
+
+// ReplicationStats is a point-in-time view of the backlog of writes mirrored
+// to another cluster.
+type ReplicationStats struct {
+	Pending  int
+	Lag      time.Duration
+	Shipped  uint64
+	Failures uint64
+}
+
+var (
+	replication = &replicationCollector{}
+
+	replPendingDesc = prometheus.NewDesc("zephyrcache_replication_pending_records",
+		"Writes not yet acknowledged by the remote cluster.", nil, nil)
+	replLagDesc = prometheus.NewDesc("zephyrcache_replication_lag_seconds",
+		"Age of the oldest write not yet acknowledged by the remote cluster.", nil, nil)
+	replShippedDesc = prometheus.NewDesc("zephyrcache_replication_shipped_records_total",
+		"Writes acknowledged by the remote cluster.", nil, nil)
+	replFailuresDesc = prometheus.NewDesc("zephyrcache_replication_failed_batches_total",
+		"Batches the remote cluster failed to take.", nil, nil)
+)
+
+// SetReplicationSource registers the function polled on every scrape for the
+// replication backlog; nil means replication is off.
+func SetReplicationSource(source func() ReplicationStats) {
+	replication.mu.Lock()
+	defer replication.mu.Unlock()
+	replication.source = source
+}
+
+type replicationCollector struct {
+	mu     sync.RWMutex
+	source func() ReplicationStats
+}
+
+func (c *replicationCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- replPendingDesc
+	ch <- replLagDesc
+	ch <- replShippedDesc
+	ch <- replFailuresDesc
+}
+
+func (c *replicationCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	source := c.source
+	c.mu.RUnlock()
+	if source == nil {
+		return
+	}
+	st := source()
+	ch <- prometheus.MustNewConstMetric(replPendingDesc, prometheus.GaugeValue, float64(st.Pending))
+	ch <- prometheus.MustNewConstMetric(replLagDesc, prometheus.GaugeValue, st.Lag.Seconds())
+	ch <- prometheus.MustNewConstMetric(replShippedDesc, prometheus.CounterValue, float64(st.Shipped))
+	ch <- prometheus.MustNewConstMetric(replFailuresDesc, prometheus.CounterValue, float64(st.Failures))
+}
+
+// ---- Write-behind ----
+
+// WriteBehindStats is a point-in-time view of one namespace's write-behind
+// backlog.
+type WriteBehindStats struct {
+	Pending int
+	Dropped uint64
+}
+
+var (
+	writeBehind = &writeBehindCollector{}
+
+	wbPendingDesc = prometheus.NewDesc("zephyrcache_writebehind_pending_records",
+		"Keys waiting to be flushed to the namespace's backing store.", []string{"namespace"}, nil)
+	wbDroppedDesc = prometheus.NewDesc("zephyrcache_writebehind_dropped_records_total",
+		"Writes not flushed to the backing store because too many keys were pending.", []string{"namespace"}, nil)
+)
+
+// SetWriteBehindSource registers the function polled on every scrape for the
+// write-behind backlog, keyed by namespace name.
+func SetWriteBehindSource(source func() map[string]WriteBehindStats) {
+	writeBehind.mu.Lock()
+	defer writeBehind.mu.Unlock()
+	writeBehind.source = source
+}
+
+type writeBehindCollector struct {
+	mu     sync.RWMutex
+	source func() map[string]WriteBehindStats
+}
+
+func (c *writeBehindCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- wbPendingDesc
+	ch <- wbDroppedDesc
+}
+
+func (c *writeBehindCollector) Collect(ch chan<- prometheus.Metric) {
+	c.mu.RLock()
+	source := c.source
+	c.mu.RUnlock()
+	if source == nil {
+		return
+	}
+	for name, st := range source() {
+		ch <- prometheus.MustNewConstMetric(wbPendingDesc, prometheus.GaugeValue, float64(st.Pending), name)
+		ch <- prometheus.MustNewConstMetric(wbDroppedDesc, prometheus.CounterValue, float64(st.Dropped), name)
+	}
+}
+
 // ---- Middleware instrumentation ----
 
 type statusWriter struct {
@@ -88,6 +256,12 @@ func (w *statusWriter) WriteHeader(code int) {
 	w.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
 // Instrument wraps an http.Handler to record metrics under the provided "op" label.
 // Example:
 //
@@ -0,0 +1,180 @@
+// Package cdc keeps an ordered change log of the mutations applied to a node
+// in an in-memory ring buffer, bounded in records and in value bytes, so that
+// consumers can tail it by sequence number and resume where they left off.
+package cdc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+var (
+	// ErrTruncated is returned for an offset that has already been pushed out
+	// of the buffer; the consumer missed records and has to resynchronize.
+	ErrTruncated = errors.New("cdc: offset no longer in the buffer")
+	// ErrAhead is returned for an offset past the end of the log, e.g. one
+	// saved from a previous run of the node.
+	ErrAhead = errors.New("cdc: offset beyond the end of the log")
+)
+
+// Record is one mutation in the log.
+type Record struct {
+	Seq       uint64 `json:"seq"`
+	Op        kv.Op  `json:"op"`
+	Namespace string `json:"ns"`
+	Key       string `json:"key"`
+	// Value is the written value of a put; shared, do not modify. Updates of
+	// hashes, lists, sets and sorted sets carry no value.
+	Value []byte `json:"value,omitempty"`
+	// ValueOmitted is set on puts whose value was larger than the log's
+	// Limits.MaxValue and is not kept; consumers read the key instead.
+	ValueOmitted bool      `json:"value_omitted,omitempty"`
+	ExpireAt     int64     `json:"expire_at,omitempty"` // unix milliseconds for puts and touches, 0 if none
+	Time         time.Time `json:"time"`
+}
+
+// Limits bound the memory a Log holds.
+type Limits struct {
+	Records int // most records held
+	// Bytes is the most value bytes held across all records; once over it
+	// the oldest records are dropped. Zero means no limit.
+	Bytes int
+	// MaxValue is the largest value kept with its record; larger values are
+	// dropped and the record marked ValueOmitted. Zero means Bytes.
+	MaxValue int
+}
+
+// Log is a bounded, append-only sequence of records. Sequence numbers start
+// at 1 and increase by one per record; once the buffer is full, in records or
+// in bytes, every append drops the oldest records.
+type Log struct {
+	id     string
+	limits Limits
+
+	mu      sync.Mutex
+	buf     []Record
+	start   uint64        // sequence number of the oldest record not dropped for bytes
+	next    uint64        // sequence number of the next record
+	bytes   int           // value bytes held
+	appends chan struct{} // closed and replaced by every append
+}
+
+// New returns an empty log holding at most capacity records.
+func New(capacity int) *Log {
+	return NewWithLimits(Limits{Records: capacity})
+}
+
+// NewWithLimits returns an empty log bounded by lim.
+func NewWithLimits(lim Limits) *Log {
+	lim.Records = max(lim.Records, 1)
+	if lim.Bytes > 0 && (lim.MaxValue <= 0 || lim.MaxValue > lim.Bytes) {
+		lim.MaxValue = lim.Bytes
+	}
+	id := make([]byte, 8)
+	rand.Read(id)
+	return &Log{
+		id:      hex.EncodeToString(id),
+		limits:  lim,
+		buf:     make([]Record, lim.Records),
+		start:   1,
+		next:    1,
+		appends: make(chan struct{}),
+	}
+}
+
+// ID identifies this log. It changes whenever the node restarts, so that
+// consumers can tell that sequence numbers started over.
+func (l *Log) ID() string {
+	return l.id
+}
+
+// Limits returns the bounds of the log.
+func (l *Log) Limits() Limits {
+	return l.limits
+}
+
+// Append assigns r the next sequence number and adds it to the log.
+func (l *Log) Append(r Record) uint64 {
+	if l.limits.MaxValue > 0 && len(r.Value) > l.limits.MaxValue {
+		r.Value, r.ValueOmitted = nil, true
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.Seq = l.next
+	slot := &l.buf[r.Seq%uint64(len(l.buf))]
+	l.bytes -= len(slot.Value) // of the record pushed out, if any
+	*slot = r
+	l.bytes += len(r.Value)
+	l.next++
+	for l.limits.Bytes > 0 && l.bytes > l.limits.Bytes {
+		old := &l.buf[l.first()%uint64(len(l.buf))]
+		l.bytes -= len(old.Value)
+		*old = Record{}
+		l.start = l.first() + 1
+	}
+	close(l.appends)
+	l.appends = make(chan struct{})
+	return r.Seq
+}
+
+// Bounds returns the sequence number of the oldest record still held and
+// that of the next record to be appended. The log is empty when they are
+// equal.
+func (l *Log) Bounds() (first, next uint64) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.first(), l.next
+}
+
+func (l *Log) first() uint64 {
+	if n := uint64(len(l.buf)); l.next > n {
+		return max(l.next-n, l.start)
+	}
+	return l.start
+}
+
+// Read returns up to limit records starting at sequence number from, in
+// order. It returns no records when from is the end of the log.
+func (l *Log) Read(from uint64, limit int) ([]Record, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	switch {
+	case from < l.first():
+		return nil, ErrTruncated
+	case from > l.next:
+		return nil, ErrAhead
+	}
+	n := l.next - from
+	if limit > 0 && n > uint64(limit) {
+		n = uint64(limit)
+	}
+	out := make([]Record, 0, n)
+	for seq := from; seq < from+n; seq++ {
+		out = append(out, l.buf[seq%uint64(len(l.buf))])
+	}
+	return out, nil
+}
+
+// Wait blocks until the log holds a record with sequence number from or
+// ctx is done.
+func (l *Log) Wait(ctx context.Context, from uint64) error {
+	for {
+		l.mu.Lock()
+		next, appends := l.next, l.appends
+		l.mu.Unlock()
+		if from < next {
+			return nil
+		}
+		select {
+		case <-appends:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
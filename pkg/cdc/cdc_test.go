@@ -0,0 +1,80 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLogKeepsNewestRecords(t *testing.T) {
+	l := New(3)
+	if recs, err := l.Read(1, 0); err != nil || len(recs) != 0 {
+		t.Fatalf("Read of empty log = %v, %v", recs, err)
+	}
+	for _, key := range []string{"a", "b", "c", "d", "e"} {
+		l.Append(Record{Op: "put", Key: key})
+	}
+	if first, next := l.Bounds(); first != 3 || next != 6 {
+		t.Fatalf("Bounds = %d, %d; want 3, 6", first, next)
+	}
+
+	recs, err := l.Read(3, 0)
+	if err != nil || len(recs) != 3 || recs[0].Key != "c" || recs[2].Seq != 5 {
+		t.Fatalf("Read(3) = %+v, %v", recs, err)
+	}
+	if recs, _ := l.Read(4, 1); len(recs) != 1 || recs[0].Key != "d" {
+		t.Fatalf("Read(4, 1) = %+v", recs)
+	}
+	if _, err := l.Read(2, 0); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("Read(2) err = %v, want ErrTruncated", err)
+	}
+	if _, err := l.Read(7, 0); !errors.Is(err, ErrAhead) {
+		t.Fatalf("Read(7) err = %v, want ErrAhead", err)
+	}
+}
+
+func TestWaitReturnsOnAppend(t *testing.T) {
+	l := New(8)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := l.Wait(ctx, 1); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait on empty log = %v, want deadline exceeded", err)
+	}
+
+	done := make(chan error)
+	go func() { done <- l.Wait(context.Background(), 1) }()
+	time.Sleep(10 * time.Millisecond)
+	l.Append(Record{Op: "delete", Key: "k"})
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Wait = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Wait did not return after an append")
+	}
+}
+
+func TestLogIsBoundedByBytes(t *testing.T) {
+	l := NewWithLimits(Limits{Records: 100, Bytes: 10, MaxValue: 4})
+	for _, v := range []string{"aaaa", "bbbb", "cc", "dddd"} {
+		l.Append(Record{Op: "put", Key: v[:1], Value: []byte(v)})
+	}
+	// a, b, c and d hold 14 bytes; a is dropped to get back under 10
+	if first, next := l.Bounds(); first != 2 || next != 5 {
+		t.Fatalf("Bounds = %d, %d; want 2, 5", first, next)
+	}
+	if _, err := l.Read(1, 0); !errors.Is(err, ErrTruncated) {
+		t.Fatalf("Read(1) err = %v, want ErrTruncated", err)
+	}
+
+	l.Append(Record{Op: "put", Key: "big", Value: []byte("too large")})
+	recs, _ := l.Read(5, 0)
+	if len(recs) != 1 || recs[0].Value != nil || !recs[0].ValueOmitted {
+		t.Fatalf("record of a value over MaxValue = %+v", recs)
+	}
+	if first, _ := l.Bounds(); first != 2 {
+		t.Fatalf("first = %d after an omitted value, want 2", first)
+	}
+}
@@ -0,0 +1,353 @@
+// Package client is a Go client for zephyrcache. It keeps its own copy of
+// the cluster's consistent hash ring and sends every request straight to the
+// node owning the key, instead of paying for a node forwarding it there.
+//
+// The ring is fetched from the /ring endpoint of any node, or built from the
+// members registered in etcd. The client notices that its copy is stale when
+// a node answers with a different ring epoch or redirects it to the owner,
+// and fetches the ring again. If a node cannot be reached the request is
+// retried on the next node of the key's preference list.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+
+	discovery "github.com/ryandielhenn/zephyrcache/pkg/registry"
+	"github.com/ryandielhenn/zephyrcache/pkg/ring"
+)
+
+// DefaultReplicas is the number of ring tokens per node that cmd/server uses.
+const DefaultReplicas = 128
+
+// minRefreshInterval spaces out ring refreshes triggered by responses, so
+// that a cluster in flux cannot make every request refetch the ring.
+const minRefreshInterval = time.Second
+
+// headers and paths of the node API, as defined by pkg/node
+const (
+	headerRingEpoch = "X-Zephyr-Ring-Epoch"
+	headerRedirect  = "X-Zephyr-Redirect"
+	nodesPrefix     = "/zephyr/nodes/"
+)
+
+// ErrNotFound is returned for keys that do not exist.
+var ErrNotFound = errors.New("client: key not found")
+
+// ErrNoNodes is returned when the client knows of no node to send to.
+var ErrNoNodes = errors.New("client: ring has no nodes")
+
+// StatusError is a response the client does not retry, such as 400 or 507.
+type StatusError struct {
+	Status  int
+	Message string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("client: %d %s: %s", e.Status, http.StatusText(e.Status), e.Message)
+}
+
+// Config selects how the client discovers the cluster and talks to it. Zero
+// values pick the defaults.
+type Config struct {
+	// Seeds are host:port addresses of nodes to fetch the ring from. Once
+	// the ring is known its members are asked as well.
+	Seeds []string
+	// Etcd, if set, is where members are discovered instead of Seeds.
+	Etcd *clientv3.Client
+	// Replicas is the number of ring tokens per node when members come from
+	// etcd, which does not record it (default DefaultReplicas).
+	Replicas int
+	// Namespace is the namespace keys are read and written in (default
+	// "default").
+	Namespace string
+	// Attempts is how many nodes of a key's preference list a request is
+	// tried on before giving up (default 3).
+	Attempts int
+	// HTTPClient sends the requests. The default pools connections to every
+	// node. The client never follows redirects itself.
+	HTTPClient *http.Client
+}
+
+func (c *Config) setDefaults() {
+	if c.Replicas <= 0 {
+		c.Replicas = DefaultReplicas
+	}
+	if c.Attempts <= 0 {
+		c.Attempts = 3
+	}
+	if c.HTTPClient == nil {
+		c.HTTPClient = &http.Client{
+			Timeout: 30 * time.Second,
+			Transport: &http.Transport{
+				Proxy:               http.ProxyFromEnvironment,
+				DialContext:         (&net.Dialer{Timeout: 5 * time.Second, KeepAlive: 30 * time.Second}).DialContext,
+				MaxIdleConns:        256,
+				MaxIdleConnsPerHost: 32,
+				IdleConnTimeout:     90 * time.Second,
+			},
+		}
+	}
+	hc := *c.HTTPClient
+	hc.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	c.HTTPClient = &hc
+}
+
+// view is a snapshot of the ring the client routes by.
+type view struct {
+	ring  *ring.HashRing
+	epoch string
+}
+
+// Client talks to a zephyrcache cluster. It is safe for concurrent use.
+type Client struct {
+	cfg         Config
+	view        atomic.Pointer[view]
+	refreshing  atomic.Bool
+	lastRefresh atomic.Int64 // unix nanoseconds
+	// distrust is set once a node answered with another ring epoch or could
+	// not be reached, until the ring is refreshed. Until then nodes forward
+	// requests instead of redirecting them, as they know the ring better.
+	distrust atomic.Bool
+}
+
+// New discovers the cluster and returns a client routing by its ring.
+func New(ctx context.Context, cfg Config) (*Client, error) {
+	cfg.setDefaults()
+	if cfg.Etcd == nil && len(cfg.Seeds) == 0 {
+		return nil, errors.New("client: no seeds or etcd client to discover the cluster from")
+	}
+	c := &Client{cfg: cfg}
+	if err := c.Refresh(ctx); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Refresh fetches the ring again.
+func (c *Client) Refresh(ctx context.Context) error {
+	c.lastRefresh.Store(time.Now().UnixNano())
+	var (
+		members  map[string]string
+		replicas = c.cfg.Replicas
+		err      error
+	)
+	if c.cfg.Etcd != nil {
+		members, err = discovery.GetPeers(c.cfg.Etcd, nodesPrefix)
+	} else {
+		members, replicas, err = c.fetchRing(ctx)
+	}
+	if err != nil {
+		return err
+	}
+	r := ring.New(replicas, ring.FNV32a)
+	for id, addr := range members {
+		r.Add(id, hostPort(addr))
+	}
+	c.view.Store(&view{ring: r, epoch: strconv.FormatUint(r.Epoch(), 16)})
+	c.distrust.Store(false)
+	return nil
+}
+
+// fetchRing asks the seeds, then the known members, for their ring until
+// one answers.
+func (c *Client) fetchRing(ctx context.Context) (map[string]string, int, error) {
+	addrs := append([]string(nil), c.cfg.Seeds...)
+	if v := c.view.Load(); v != nil {
+		for _, addr := range v.ring.Nodes() {
+			addrs = append(addrs, addr)
+		}
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		var res struct {
+			Replicas int               `json:"replicas"`
+			Members  map[string]string `json:"members"`
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+hostPort(addr)+"/ring", nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		resp, err := c.cfg.HTTPClient.Do(req)
+		if err == nil {
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("client: %s/ring answered %s", addr, resp.Status)
+			} else {
+				err = json.NewDecoder(resp.Body).Decode(&res)
+			}
+			resp.Body.Close()
+		}
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return res.Members, res.Replicas, nil
+	}
+	return nil, 0, fmt.Errorf("client: no node answered with its ring: %w", lastErr)
+}
+
+// refreshSoon refreshes the ring in the background, once minRefreshInterval
+// has passed since the last refresh, unless a refresh is already pending.
+func (c *Client) refreshSoon() {
+	if !c.refreshing.CompareAndSwap(false, true) {
+		return
+	}
+	go func() {
+		defer c.refreshing.Store(false)
+		last := time.Unix(0, c.lastRefresh.Load())
+		time.Sleep(time.Until(last.Add(minRefreshInterval)))
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		c.Refresh(ctx)
+	}()
+}
+
+// Epoch returns the epoch of the ring the client routes by.
+func (c *Client) Epoch() string {
+	return c.view.Load().epoch
+}
+
+// Members returns the nodes of the ring the client routes by, node ID to
+// host:port.
+func (c *Client) Members() map[string]string {
+	return c.view.Load().ring.Nodes()
+}
+
+// Locate returns the host:port of the nodes key would be tried on, owner
+// first.
+func (c *Client) Locate(key string) []string {
+	r := c.view.Load().ring
+	var out []string
+	for _, id := range r.LookupN([]byte(key), c.cfg.Attempts) {
+		if addr, ok := r.Addr(id); ok {
+			out = append(out, addr)
+		}
+	}
+	return out
+}
+
+// Get returns the value of key.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	return c.do(ctx, http.MethodGet, key, nil, nil)
+}
+
+// Put stores val under key. A positive ttl expires it after that long,
+// rounded down to milliseconds.
+func (c *Client) Put(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	q := url.Values{}
+	if ttl > 0 {
+		q.Set("ttl_ms", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.do(ctx, http.MethodPut, key, q, val)
+	return err
+}
+
+// Delete removes key. Deleting a missing key is not an error.
+func (c *Client) Delete(ctx context.Context, key string) error {
+	_, err := c.do(ctx, http.MethodDelete, key, nil, nil)
+	return err
+}
+
+// Close releases the client's idle connections.
+func (c *Client) Close() {
+	c.cfg.HTTPClient.CloseIdleConnections()
+}
+
+// do sends a request for key to its owner, falling back to the next nodes of
+// its preference list if the owner cannot be reached or is unavailable, and
+// returns the response body.
+func (c *Client) do(ctx context.Context, method, key string, q url.Values, body []byte) ([]byte, error) {
+	path := "/kv/" + url.PathEscape(key)
+	if ns := c.cfg.Namespace; ns != "" {
+		path = "/ns/" + url.PathEscape(ns) + path
+	}
+	if len(q) > 0 {
+		path += "?" + q.Encode()
+	}
+	addrs := c.Locate(key)
+	if len(addrs) == 0 {
+		return nil, ErrNoNodes
+	}
+
+	var lastErr error
+	for i, addr := range addrs {
+		// only the owner by a ring the client trusts may redirect; a
+		// fallback node forwards to whichever node it considers the owner
+		redirect := i == 0 && !c.distrust.Load()
+		status, data, err := c.send(ctx, method, "http://"+addr+path, body, redirect)
+		if err == nil && status == http.StatusTemporaryRedirect {
+			// the ring has moved on: the node pointed us at the owner
+			status, data, err = c.send(ctx, method, string(data), body, false)
+		}
+		switch {
+		case ctx.Err() != nil:
+			return nil, ctx.Err()
+		case err != nil:
+			lastErr = err
+			c.distrust.Store(true)
+			c.refreshSoon()
+			continue
+		case status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout:
+			lastErr = &StatusError{Status: status, Message: strings.TrimSpace(string(data))}
+			continue
+		case status == http.StatusNotFound:
+			return nil, ErrNotFound
+		case status/100 != 2:
+			return nil, &StatusError{Status: status, Message: strings.TrimSpace(string(data))}
+		}
+		return data, nil
+	}
+	return nil, lastErr
+}
+
+// send makes one request and returns its status and body, or for a
+// redirect the location it points to. With redirect set, a node that does not
+// own the key answers with a redirect rather than forwarding the request.
+func (c *Client) send(ctx context.Context, method, target string, body []byte, redirect bool) (int, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, method, target, bytes.NewReader(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	if redirect {
+		req.Header.Set(headerRedirect, "true")
+	}
+	resp, err := c.cfg.HTTPClient.Do(req)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	if epoch := resp.Header.Get(headerRingEpoch); epoch != "" && epoch != c.Epoch() {
+		c.distrust.Store(true)
+		c.refreshSoon()
+	}
+	if resp.StatusCode == http.StatusTemporaryRedirect {
+		io.Copy(io.Discard, resp.Body)
+		c.refreshSoon()
+		return resp.StatusCode, []byte(resp.Header.Get("Location")), nil
+	}
+	data, err := io.ReadAll(resp.Body)
+	return resp.StatusCode, data, err
+}
+
+// hostPort strips any scheme from addr and adds the default node port if it
+// has none, as nodes do for the addresses they route by.
+func hostPort(addr string) string {
+	addr = strings.TrimPrefix(strings.TrimPrefix(addr, "http://"), "https://")
+	if _, _, err := net.SplitHostPort(addr); err == nil {
+		return addr
+	}
+	return addr + ":8080"
+}
@@ -0,0 +1,230 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/node"
+	"github.com/ryandielhenn/zephyrcache/pkg/ring"
+)
+
+// cluster is a set of nodes serving the key/value API on loopback.
+type cluster struct {
+	nodes    []*node.Node
+	servers  []*httptest.Server
+	requests []*atomic.Int64 // requests each node served, forwarded ones included
+	peers    map[string]string
+}
+
+func newCluster(t *testing.T, size int) *cluster {
+	t.Helper()
+	c := &cluster{peers: make(map[string]string)}
+	for i := range size {
+		c.start(t, "node"+string(rune('a'+i)))
+	}
+	c.sync()
+	return c
+}
+
+// start adds a node to the cluster without telling the others.
+func (c *cluster) start(t *testing.T, id string) int {
+	srv := httptest.NewUnstartedServer(nil)
+	addr := srv.Listener.Addr().String()
+	n := node.NewNode(kv.NewStore(1<<20), ring.New(DefaultReplicas, nil), addr)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/kv/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			n.Put(w, r)
+		case http.MethodGet:
+			n.Get(w, r)
+		case http.MethodDelete:
+			n.Del(w, r)
+		}
+	})
+	mux.HandleFunc("/ring", n.Ring)
+	count := new(atomic.Int64)
+	srv.Config.Handler = n.WithRingEpoch(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		count.Add(1)
+		mux.ServeHTTP(w, r)
+	}))
+	srv.Start()
+	t.Cleanup(srv.Close)
+
+	c.nodes = append(c.nodes, n)
+	c.servers = append(c.servers, srv)
+	c.requests = append(c.requests, count)
+	c.peers[id] = addr
+	return len(c.nodes) - 1
+}
+
+// sync makes every node route by the current membership.
+func (c *cluster) sync() {
+	for _, n := range c.nodes {
+		n.SyncPeers(c.peers)
+	}
+}
+
+func (c *cluster) served() int64 {
+	var total int64
+	for _, n := range c.requests {
+		total += n.Load()
+	}
+	return total
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRequestsGoStraightToOwner(t *testing.T) {
+	c := newCluster(t, 3)
+	cl, err := New(context.Background(), Config{Seeds: []string{c.servers[0].Listener.Addr().String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if cl.Epoch() != c.nodes[0].RingEpoch() {
+		t.Fatalf("client epoch %s, nodes %s", cl.Epoch(), c.nodes[0].RingEpoch())
+	}
+
+	before := c.served()
+	for _, key := range []string{"a", "b", "c", "d", "e", "f"} {
+		if err := cl.Put(context.Background(), key, []byte("v-"+key), time.Minute); err != nil {
+			t.Fatalf("Put(%s): %v", key, err)
+		}
+	}
+	if got := c.served() - before; got != 6 {
+		t.Fatalf("6 puts took %d requests, want no forwarding", got)
+	}
+	if v, err := cl.Get(context.Background(), "d"); err != nil || string(v) != "v-d" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+	cl.Delete(context.Background(), "d")
+	if _, err := cl.Get(context.Background(), "d"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStaleRingIsRetriedAndRefreshed(t *testing.T) {
+	c := newCluster(t, 3)
+	cl, err := New(context.Background(), Config{Seeds: []string{c.servers[0].Listener.Addr().String()}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	// a node joins; keys it now owns are redirected to it
+	joined := c.start(t, "noded")
+	c.sync()
+	key := ""
+	for i := 0; key == ""; i++ {
+		k := "key" + string(rune('a'+i%26)) + string(rune('a'+i/26))
+		if owner, _, _ := c.nodes[0].OwnerForKey(k); owner == c.nodes[joined].Addr() {
+			key = k
+		}
+	}
+	if err := cl.Put(context.Background(), key, []byte("v"), 0); err != nil {
+		t.Fatalf("Put via a stale ring: %v", err)
+	}
+	if st, _ := c.nodes[joined].Store(node.DefaultNamespace); st.Len() != 1 {
+		t.Fatalf("joined owner holds %d keys, want the redirected write", st.Len())
+	}
+	waitFor(t, func() bool { return cl.Epoch() == c.nodes[0].RingEpoch() })
+
+	// the owner dies; the next node of the preference list takes over
+	owner := cl.Locate(key)[0]
+	for i, srv := range c.servers {
+		if srv.Listener.Addr().String() == owner {
+			srv.Close()
+			for id, addr := range c.peers {
+				if addr == owner {
+					delete(c.peers, id)
+				}
+			}
+			c.nodes = append(c.nodes[:i], c.nodes[i+1:]...)
+			break
+		}
+	}
+	c.sync()
+	if err := cl.Put(context.Background(), key, []byte("v2"), 0); err != nil {
+		t.Fatalf("Put with a dead owner: %v", err)
+	}
+	if v, err := cl.Get(context.Background(), key); err != nil || string(v) != "v2" {
+		t.Fatalf("Get = %q, %v", v, err)
+	}
+}
+
+// roundTripper adapts a function to http.RoundTripper.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+func TestFallbackLetsNodesForwardWhenOwnerIsDown(t *testing.T) {
+	c := newCluster(t, 3)
+	var redirectAsks atomic.Int64
+	hc := &http.Client{Transport: roundTripper(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get(headerRedirect) != "" {
+			redirectAsks.Add(1)
+		}
+		return http.DefaultTransport.RoundTrip(req)
+	})}
+	cl, err := New(context.Background(), Config{Seeds: []string{c.servers[0].Listener.Addr().String()}, HTTPClient: hc})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	// the owner dies and the cluster moves on before the client notices
+	const key = "user:42"
+	owner := cl.Locate(key)[0]
+	for i, srv := range c.servers {
+		if srv.Listener.Addr().String() == owner {
+			srv.Close()
+			for id, addr := range c.peers {
+				if addr == owner {
+					delete(c.peers, id)
+				}
+			}
+			c.nodes = append(c.nodes[:i], c.nodes[i+1:]...)
+			break
+		}
+	}
+	c.sync()
+
+	before := redirectAsks.Load()
+	if err := cl.Put(context.Background(), key, []byte("v"), 0); err != nil {
+		t.Fatalf("Put with a dead owner: %v", err)
+	}
+	if got := redirectAsks.Load() - before; got != 1 {
+		t.Fatalf("%d requests asked for a redirect, want only the one to the dead owner", got)
+	}
+	if v, err := cl.Get(context.Background(), key); err != nil || string(v) != "v" {
+		t.Fatalf("Get with a dead owner = %q, %v", v, err)
+	}
+	if got := redirectAsks.Load() - before; got != 1 {
+		t.Fatalf("%d requests asked for a redirect before the ring was refreshed, want 1", got)
+	}
+
+	// once the ring is refreshed the client trusts it again
+	waitFor(t, func() bool { return cl.Epoch() == c.nodes[0].RingEpoch() })
+	if _, err := cl.Get(context.Background(), key); err != nil {
+		t.Fatalf("Get after refresh: %v", err)
+	}
+	if got := redirectAsks.Load() - before; got != 2 {
+		t.Fatalf("%d requests asked for a redirect after the refresh, want 2 in total", got)
+	}
+}
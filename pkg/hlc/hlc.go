@@ -0,0 +1,103 @@
+// Package hlc implements hybrid logical clocks: timestamps that stay close
+// to wall-clock time but never go backwards on a node and always order a
+// write after every write its node has seen, locally or in a message from
+// another node, even when the nodes' clocks disagree.
+package hlc
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const logicalBits = 16
+
+// Timestamp is a hybrid logical clock reading: the upper 48 bits hold
+// wall-clock milliseconds since the Unix epoch, the lower 16 a counter that
+// orders readings within the same millisecond. Timestamps compare with <,
+// and the zero Timestamp is before every reading.
+type Timestamp uint64
+
+// New returns the timestamp of wall with the given logical counter.
+func New(wall time.Time, logical uint16) Timestamp {
+	return Timestamp(uint64(wall.UnixMilli())<<logicalBits | uint64(logical))
+}
+
+// Time returns the wall-clock part of t.
+func (t Timestamp) Time() time.Time {
+	return time.UnixMilli(int64(t >> logicalBits))
+}
+
+// Logical returns the counter part of t.
+func (t Timestamp) Logical() uint16 {
+	return uint16(t)
+}
+
+// String formats t as a decimal number, the form Parse reads and that
+// travels in headers.
+func (t Timestamp) String() string {
+	return strconv.FormatUint(uint64(t), 10)
+}
+
+// Parse reads a timestamp formatted by String.
+func Parse(s string) (Timestamp, error) {
+	v, err := strconv.ParseUint(s, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("hlc: invalid timestamp %q", s)
+	}
+	return Timestamp(v), nil
+}
+
+// MaxOffset is how far ahead of the local wall clock a remote timestamp may
+// be before Update rejects it, so that one node with a runaway clock cannot
+// drag every other clock along.
+const MaxOffset = time.Minute
+
+// ErrOffset is returned by Update for a timestamp too far in the future.
+var ErrOffset = errors.New("hlc: remote timestamp too far ahead of local clock")
+
+// Clock hands out timestamps. It is safe for concurrent use.
+type Clock struct {
+	mu   sync.Mutex
+	last Timestamp
+	wall func() time.Time
+}
+
+// NewClock returns a clock reading the system wall clock.
+func NewClock() *Clock {
+	return &Clock{wall: time.Now}
+}
+
+// Now returns a timestamp after every one the clock has returned or seen.
+func (c *Clock) Now() Timestamp {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.advance(0)
+}
+
+// Update advances the clock past a timestamp received from another node and
+// returns a timestamp after both. Timestamps more than MaxOffset ahead of the
+// local wall clock are not taken in; Update then returns ErrOffset along with
+// a reading of the local clock.
+func (c *Clock) Update(remote Timestamp) (Timestamp, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if remote.Time().Sub(c.wall()) > MaxOffset {
+		return c.advance(0), ErrOffset
+	}
+	return c.advance(remote), nil
+}
+
+// advance returns the next reading after c.last and seen. c.mu must be held.
+func (c *Clock) advance(seen Timestamp) Timestamp {
+	next := New(c.wall(), 0)
+	if latest := max(c.last, seen); next <= latest {
+		// the counter overflowing into the millisecond bits is the same as
+		// the wall clock moving on by a millisecond
+		next = latest + 1
+	}
+	c.last = next
+	return next
+}
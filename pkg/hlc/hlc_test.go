@@ -0,0 +1,62 @@
+package hlc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+// fakeClock returns a Clock whose wall clock is *now.
+func fakeClock(now *time.Time) *Clock {
+	return &Clock{wall: func() time.Time { return *now }}
+}
+
+func TestClockNeverGoesBackwards(t *testing.T) {
+	now := time.UnixMilli(1_000_000)
+	c := fakeClock(&now)
+
+	a := c.Now()
+	b := c.Now()
+	if b <= a || b.Logical() != 1 || !b.Time().Equal(now) {
+		t.Fatalf("second reading in the same millisecond = %v (logical %d), after %v", b, b.Logical(), a)
+	}
+	now = now.Add(-time.Second) // wall clock steps back
+	if d := c.Now(); d <= b {
+		t.Fatalf("reading after the wall clock stepped back = %v, want after %v", d, b)
+	}
+	now = now.Add(time.Hour)
+	if e := c.Now(); e.Logical() != 0 || !e.Time().Equal(now) {
+		t.Fatalf("reading after the wall clock moved on = %v at %v, want logical 0 at %v", e, e.Time(), now)
+	}
+}
+
+func TestUpdateOrdersAfterRemote(t *testing.T) {
+	now := time.UnixMilli(1_000_000)
+	c := fakeClock(&now)
+
+	remote := New(now.Add(5*time.Second), 7)
+	got, err := c.Update(remote)
+	if err != nil || got <= remote {
+		t.Fatalf("Update(%v) = %v, %v; want a later timestamp", remote, got, err)
+	}
+	if next := c.Now(); next <= got {
+		t.Fatalf("Now after Update = %v, want after %v", next, got)
+	}
+
+	runaway := New(now.Add(MaxOffset+time.Second), 0)
+	got, err = c.Update(runaway)
+	if !errors.Is(err, ErrOffset) || got >= runaway {
+		t.Fatalf("Update of a runaway timestamp = %v, %v; want ErrOffset and no jump", got, err)
+	}
+}
+
+func TestParseRoundTrips(t *testing.T) {
+	ts := New(time.UnixMilli(1_700_000_000_000), 42)
+	got, err := Parse(ts.String())
+	if err != nil || got != ts {
+		t.Fatalf("Parse(%q) = %v, %v", ts.String(), got, err)
+	}
+	if _, err := Parse("soon"); err == nil {
+		t.Fatal("Parse accepted garbage")
+	}
+}
@@ -0,0 +1,189 @@
+package httpcache
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cacheableStatus lists the status codes stored when the origin gives them an
+// explicit freshness lifetime.
+var cacheableStatus = []int{
+	http.StatusOK,
+	http.StatusNonAuthoritativeInfo,
+	http.StatusMovedPermanently,
+	http.StatusNotFound,
+	http.StatusGone,
+}
+
+// cacheControl is a parsed Cache-Control header.
+type cacheControl map[string]string
+
+func parseCacheControl(h http.Header) cacheControl {
+	cc := cacheControl{}
+	for _, v := range h.Values("Cache-Control") {
+		for _, part := range strings.Split(v, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, val, _ := strings.Cut(part, "=")
+			cc[strings.ToLower(strings.TrimSpace(name))] = strings.Trim(strings.TrimSpace(val), `"`)
+		}
+	}
+	return cc
+}
+
+func (cc cacheControl) has(directive string) bool {
+	_, ok := cc[directive]
+	return ok
+}
+
+// seconds returns the value of a delta-seconds directive such as max-age.
+func (cc cacheControl) seconds(directive string) (time.Duration, bool) {
+	v, ok := cc[directive]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, false
+	}
+	return time.Duration(n) * time.Second, true
+}
+
+// requestBypasses reports whether req must skip the cache entirely.
+// Credentialed requests are never served from or stored in the shared cache.
+func requestBypasses(req *http.Request) bool {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		return true
+	}
+	if req.Header.Get("Authorization") != "" {
+		return true
+	}
+	return parseCacheControl(req.Header).has("no-store")
+}
+
+// requestRevalidates reports whether req asks for a response fetched from the
+// origin even if a fresh one is cached.
+func requestRevalidates(req *http.Request) bool {
+	cc := parseCacheControl(req.Header)
+	if cc.has("no-cache") {
+		return true
+	}
+	if age, ok := cc.seconds("max-age"); ok && age == 0 {
+		return true
+	}
+	return req.Header.Get("Pragma") == "no-cache"
+}
+
+// notModified reports whether a conditional req is satisfied by a stored 200
+// response with header h, so that a 304 answers it. If-None-Match takes
+// precedence over If-Modified-Since and is compared weakly.
+func notModified(req *http.Request, status int, h http.Header) bool {
+	if status != http.StatusOK {
+		return false
+	}
+	if inm := req.Header.Values("If-None-Match"); len(inm) > 0 {
+		etag := strings.TrimPrefix(h.Get("ETag"), "W/")
+		for _, v := range inm {
+			for _, tag := range strings.Split(v, ",") {
+				tag = strings.TrimSpace(tag)
+				if tag == "*" || (etag != "" && strings.TrimPrefix(tag, "W/") == etag) {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	since, err := http.ParseTime(req.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	modified, err := http.ParseTime(h.Get("Last-Modified"))
+	return err == nil && !modified.After(since)
+}
+
+// freshness returns how long a response from the origin may be served from a
+// shared cache, as of when it was received. ok is false if the response must
+// not be stored.
+func freshness(resp *http.Response, now time.Time) (lifetime time.Duration, ok bool) {
+	if !slices.Contains(cacheableStatus, resp.StatusCode) {
+		return 0, false
+	}
+	if resp.Header.Get("Vary") == "*" || resp.Header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	cc := parseCacheControl(resp.Header)
+	if cc.has("no-store") || cc.has("private") || cc.has("no-cache") {
+		return 0, false
+	}
+
+	if d, ok := cc.seconds("s-maxage"); ok {
+		lifetime = d
+	} else if d, ok := cc.seconds("max-age"); ok {
+		lifetime = d
+	} else if exp := resp.Header.Get("Expires"); exp != "" {
+		t, err := http.ParseTime(exp)
+		if err != nil {
+			return 0, false
+		}
+		date := now
+		if d, err := http.ParseTime(resp.Header.Get("Date")); err == nil {
+			date = d
+		}
+		lifetime = t.Sub(date)
+	} else {
+		return 0, false // no heuristic freshness
+	}
+
+	lifetime -= originAge(resp.Header)
+	if lifetime <= 0 {
+		return 0, false
+	}
+	return lifetime, true
+}
+
+// originAge is the Age the origin (or a cache in front of it) reported.
+func originAge(h http.Header) time.Duration {
+	n, err := strconv.ParseInt(h.Get("Age"), 10, 64)
+	if err != nil || n < 0 {
+		return 0
+	}
+	return time.Duration(n) * time.Second
+}
+
+// varyHeaders returns the canonical, sorted header names listed in Vary.
+func varyHeaders(h http.Header) []string {
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+	slices.Sort(names)
+	return slices.Compact(names)
+}
+
+// baseKey identifies a resource independently of Vary. HEAD shares GET's
+// entries.
+func baseKey(req *http.Request) string {
+	return "GET " + req.URL.RequestURI()
+}
+
+// variantKey extends base with the request's values of the Vary headers.
+func variantKey(base string, vary []string, req *http.Request) string {
+	var b strings.Builder
+	b.WriteString(base)
+	for _, name := range vary {
+		b.WriteString("\x00")
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strings.Join(req.Header.Values(name), ","))
+	}
+	return b.String()
+}
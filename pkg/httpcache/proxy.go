@@ -0,0 +1,298 @@
+// Package httpcache runs zephyrcache as a distributed shared HTTP cache in
+// front of a single origin. Every node runs a Proxy listener; a request is
+// keyed by method and URL, routed to the key's owner on the hash ring and
+// served from the owner's kv.Store while fresh per Cache-Control / Expires.
+// Otherwise the owner fetches it from the origin and stores it if the
+// response allows. Responses that Vary are stored once per combination of
+// the listed request headers.
+package httpcache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// RoutedPath prefixes requests a peer proxy already routed to this node as the
+// key's owner. The owner serves them without consulting its own ring, so a
+// ring that is briefly out of sync cannot bounce requests between nodes. The
+// Routed handler belongs on the node listener next to the other peer
+// endpoints, never on the public proxy listener.
+const RoutedPath = "/proxy-routed"
+
+// HeaderCache reports HIT or MISS on every cacheable response.
+const HeaderCache = "X-Cache"
+
+// DefaultMaxObjectBytes is the largest response body stored when
+// Proxy.MaxObjectBytes is unset. Larger bodies are streamed uncached.
+const DefaultMaxObjectBytes = 8 << 20
+
+// varyPrefix prefixes the key under which the Vary header names of a resource
+// are stored.
+const varyPrefix = "vary\x00"
+
+// hopHeaders are connection-level headers that must not be forwarded.
+var hopHeaders = []string{
+	"Connection", "Keep-Alive", "Proxy-Authenticate", "Proxy-Authorization",
+	"Proxy-Connection", "Te", "Trailer", "Transfer-Encoding", "Upgrade",
+}
+
+// Proxy is an http.Handler serving a shared cache for one origin.
+type Proxy struct {
+	Origin *url.URL
+	Store  *kv.Store
+	// StoreFunc, if set, is asked for the store on every request instead of
+	// using Store. When it reports none, requests are passed to the origin
+	// uncached.
+	StoreFunc func() (*kv.Store, bool)
+	// Owner returns the address (host:port) serving the Routed handler of the
+	// node that owns key and whether that node is this one.
+	Owner          func(key string) (addr string, self bool, ok bool)
+	MaxObjectBytes int64
+	Client         *http.Client // nil means http.DefaultClient
+
+	pass *httputil.ReverseProxy
+}
+
+// New returns a Proxy caching origin in store and routing keys with owner.
+func New(origin *url.URL, store *kv.Store, owner func(key string) (string, bool, bool)) *Proxy {
+	return &Proxy{
+		Origin: origin,
+		Store:  store,
+		Owner:  owner,
+		pass:   httputil.NewSingleHostReverseProxy(origin),
+	}
+}
+
+// cached is a stored origin response.
+type cached struct {
+	Status   int
+	Header   http.Header
+	Body     []byte
+	Received time.Time
+	Age      time.Duration // Age reported by the origin when received
+}
+
+func (p *Proxy) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if requestBypasses(req) {
+		p.pass.ServeHTTP(w, req)
+		return
+	}
+
+	base := baseKey(req)
+	addr, self, ok := p.Owner(base)
+	if !ok {
+		http.Error(w, "no owner for key", http.StatusServiceUnavailable)
+		return
+	}
+	if !self {
+		p.forward(w, req, addr)
+		return
+	}
+	p.serveOwned(w, req, base)
+}
+
+// Routed returns the handler for requests under RoutedPath, which peers send
+// to the owner of their key.
+func (p *Proxy) Routed() http.Handler {
+	return http.StripPrefix(RoutedPath, http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if requestBypasses(req) {
+			p.pass.ServeHTTP(w, req)
+			return
+		}
+		p.serveOwned(w, req, baseKey(req))
+	}))
+}
+
+// serveOwned answers a cacheable request on the owner of its key.
+func (p *Proxy) serveOwned(w http.ResponseWriter, req *http.Request, base string) {
+	store := p.Store
+	if p.StoreFunc != nil {
+		var ok bool
+		if store, ok = p.StoreFunc(); !ok {
+			p.pass.ServeHTTP(w, req)
+			return
+		}
+	}
+
+	var vary []string
+	if v, ok := store.Get(varyPrefix + base); ok && len(v) > 0 {
+		vary = strings.Split(string(v), ",")
+	}
+	if !requestRevalidates(req) {
+		if raw, ok := store.Get(variantKey(base, vary, req)); ok {
+			var c cached
+			if err := gob.NewDecoder(bytes.NewReader(raw)).Decode(&c); err == nil {
+				p.write(w, req, &c, "HIT")
+				return
+			}
+		}
+	}
+
+	resp, err := p.fetch(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+
+	now := time.Now()
+	lifetime, ok := freshness(resp, now)
+	limit := p.MaxObjectBytes
+	if limit <= 0 {
+		limit = DefaultMaxObjectBytes
+	}
+	if !ok || resp.ContentLength > limit {
+		p.stream(w, req, resp, nil)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if int64(len(body)) > limit {
+		p.stream(w, req, resp, body)
+		return
+	}
+
+	c := &cached{Status: resp.StatusCode, Header: resp.Header.Clone(), Body: body, Received: now, Age: originAge(resp.Header)}
+	removeHopHeaders(c.Header)
+	c.Header.Del("Age")
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(c); err == nil {
+		vary = varyHeaders(resp.Header)
+		store.Put(varyPrefix+base, []byte(strings.Join(vary, ",")), lifetime)
+		if err := store.Put(variantKey(base, vary, req), buf.Bytes(), lifetime); err != nil {
+			log.Printf("[HTTPCache] not storing %q: %v", base, err)
+		}
+	}
+	p.write(w, req, c, "MISS")
+}
+
+// fetch requests the resource from the origin. HEAD requests are fetched as
+// GET so that the response can be cached for later GETs.
+func (p *Proxy) fetch(req *http.Request) (*http.Response, error) {
+	target := *p.Origin
+	target.Path = strings.TrimSuffix(target.Path, "/") + req.URL.Path
+	target.RawPath = ""
+	target.RawQuery = req.URL.RawQuery
+
+	out, err := http.NewRequestWithContext(req.Context(), http.MethodGet, target.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	out.Header = req.Header.Clone()
+	removeHopHeaders(out.Header)
+	out.Header.Set("X-Forwarded-For", req.RemoteAddr)
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return client.Do(out)
+}
+
+// forward hands req to the owner's Routed handler and relays its response.
+func (p *Proxy) forward(w http.ResponseWriter, req *http.Request, addr string) {
+	target := *req.URL
+	target.Scheme = "http"
+	target.Host = addr
+	target.Path = RoutedPath + req.URL.Path
+	if req.URL.RawPath != "" {
+		target.RawPath = RoutedPath + req.URL.RawPath
+	}
+
+	out, err := http.NewRequestWithContext(req.Context(), req.Method, target.String(), nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	out.Header = req.Header.Clone()
+	removeHopHeaders(out.Header)
+
+	client := p.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	p.stream(w, req, resp, nil)
+}
+
+// stream relays resp uncached. head holds body bytes already read from it.
+func (p *Proxy) stream(w http.ResponseWriter, req *http.Request, resp *http.Response, head []byte) {
+	for k, vv := range resp.Header {
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	removeHopHeaders(w.Header())
+	if w.Header().Get(HeaderCache) == "" {
+		w.Header().Set(HeaderCache, "MISS")
+	}
+	w.WriteHeader(resp.StatusCode)
+	if req.Method == http.MethodHead {
+		return
+	}
+	w.Write(head)
+	io.Copy(w, resp.Body)
+}
+
+// notModifiedHeaders are the stored headers, in canonical form, repeated on a
+// 304.
+var notModifiedHeaders = []string{
+	"Cache-Control", "Content-Location", "Date", "Etag", "Expires", "Last-Modified", "Vary",
+}
+
+// write serves a stored response with its current Age, or a 304 if it
+// satisfies the request's conditions.
+func (p *Proxy) write(w http.ResponseWriter, req *http.Request, c *cached, status string) {
+	notMod := notModified(req, c.Status, c.Header)
+	for k, vv := range c.Header {
+		if notMod && !slices.Contains(notModifiedHeaders, k) {
+			continue
+		}
+		for _, v := range vv {
+			w.Header().Add(k, v)
+		}
+	}
+	age := c.Age + time.Since(c.Received)
+	w.Header().Set("Age", strconv.FormatInt(int64(age/time.Second), 10))
+	w.Header().Set(HeaderCache, status)
+	if notMod {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(c.Body)))
+	w.WriteHeader(c.Status)
+	if req.Method != http.MethodHead {
+		w.Write(c.Body)
+	}
+}
+
+func removeHopHeaders(h http.Header) {
+	for _, name := range h.Values("Connection") {
+		for _, f := range strings.Split(name, ",") {
+			h.Del(strings.TrimSpace(f))
+		}
+	}
+	for _, name := range hopHeaders {
+		h.Del(name)
+	}
+}
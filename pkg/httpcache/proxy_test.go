@@ -0,0 +1,263 @@
+package httpcache
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// newOrigin serves a few paths with different caching behaviour and counts
+// the requests that reach it.
+func newOrigin(t *testing.T, hits *atomic.Int32) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		switch r.URL.Path {
+		case "/fresh":
+			w.Header().Set("Cache-Control", "public, max-age=60")
+			io.WriteString(w, "fresh:"+r.URL.RawQuery)
+		case "/vary":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("Vary", "Accept-Language")
+			io.WriteString(w, "lang:"+r.Header.Get("Accept-Language"))
+		case "/validated":
+			w.Header().Set("Cache-Control", "max-age=60")
+			w.Header().Set("ETag", `"v1"`)
+			w.Header().Set("Last-Modified", "Mon, 05 Oct 2026 10:00:00 GMT")
+			io.WriteString(w, "validated")
+		case "/private":
+			w.Header().Set("Cache-Control", "private, max-age=60")
+			io.WriteString(w, "private")
+		default:
+			io.WriteString(w, "uncacheable")
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func selfOwner(string) (string, bool, bool) { return "", true, true }
+
+func get(t *testing.T, h http.Handler, target string, header http.Header) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestProxyCachesFreshResponses(t *testing.T) {
+	var hits atomic.Int32
+	origin := newOrigin(t, &hits)
+	u, _ := url.Parse(origin.URL)
+	p := New(u, kv.NewStore(1<<20), selfOwner)
+
+	first := get(t, p, "/fresh?a=1", nil)
+	second := get(t, p, "/fresh?a=1", nil)
+	other := get(t, p, "/fresh?a=2", nil)
+
+	if first.Header().Get(HeaderCache) != "MISS" || second.Header().Get(HeaderCache) != "HIT" {
+		t.Fatalf("X-Cache = %q then %q, want MISS then HIT", first.Header().Get(HeaderCache), second.Header().Get(HeaderCache))
+	}
+	if second.Body.String() != "fresh:a=1" || other.Body.String() != "fresh:a=2" {
+		t.Fatalf("bodies = %q, %q", second.Body.String(), other.Body.String())
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("origin hits = %d, want 2", got)
+	}
+
+	// a client asking for revalidation goes to the origin
+	get(t, p, "/fresh?a=1", http.Header{"Cache-Control": {"no-cache"}})
+	if got := hits.Load(); got != 3 {
+		t.Fatalf("origin hits after no-cache = %d, want 3", got)
+	}
+}
+
+func TestProxyHonoursVary(t *testing.T) {
+	var hits atomic.Int32
+	origin := newOrigin(t, &hits)
+	u, _ := url.Parse(origin.URL)
+	p := New(u, kv.NewStore(1<<20), selfOwner)
+
+	en := http.Header{"Accept-Language": {"en"}}
+	de := http.Header{"Accept-Language": {"de"}}
+	get(t, p, "/vary", en)
+	if rec := get(t, p, "/vary", de); rec.Body.String() != "lang:de" || rec.Header().Get(HeaderCache) != "MISS" {
+		t.Fatalf("de variant = %q (%s)", rec.Body.String(), rec.Header().Get(HeaderCache))
+	}
+	if rec := get(t, p, "/vary", en); rec.Body.String() != "lang:en" || rec.Header().Get(HeaderCache) != "HIT" {
+		t.Fatalf("en variant = %q (%s)", rec.Body.String(), rec.Header().Get(HeaderCache))
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("origin hits = %d, want 2", got)
+	}
+}
+
+func TestProxyAnswersConditionalHits(t *testing.T) {
+	var hits atomic.Int32
+	origin := newOrigin(t, &hits)
+	u, _ := url.Parse(origin.URL)
+	p := New(u, kv.NewStore(1<<20), selfOwner)
+	get(t, p, "/validated", nil)
+
+	cases := []struct {
+		name   string
+		header http.Header
+		want   int
+	}{
+		{"etag match", http.Header{"If-None-Match": {`"v0", W/"v1"`}}, http.StatusNotModified},
+		{"etag star", http.Header{"If-None-Match": {"*"}}, http.StatusNotModified},
+		{"etag mismatch", http.Header{"If-None-Match": {`"v0"`}}, http.StatusOK},
+		{"etag wins over date", http.Header{"If-None-Match": {`"v0"`}, "If-Modified-Since": {"Tue, 06 Oct 2026 10:00:00 GMT"}}, http.StatusOK},
+		{"not modified since", http.Header{"If-Modified-Since": {"Mon, 05 Oct 2026 10:00:00 GMT"}}, http.StatusNotModified},
+		{"modified since", http.Header{"If-Modified-Since": {"Sun, 04 Oct 2026 10:00:00 GMT"}}, http.StatusOK},
+	}
+	for _, c := range cases {
+		rec := get(t, p, "/validated", c.header)
+		if rec.Code != c.want || rec.Header().Get(HeaderCache) != "HIT" {
+			t.Fatalf("%s: status %d (%s), want %d HIT", c.name, rec.Code, rec.Header().Get(HeaderCache), c.want)
+		}
+		if c.want == http.StatusNotModified && (rec.Body.Len() != 0 || rec.Header().Get("ETag") != `"v1"`) {
+			t.Fatalf("%s: 304 body %q, ETag %q", c.name, rec.Body.String(), rec.Header().Get("ETag"))
+		}
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("origin hits = %d, want 1", got)
+	}
+}
+
+func TestProxyDoesNotStoreUncacheable(t *testing.T) {
+	var hits atomic.Int32
+	origin := newOrigin(t, &hits)
+	u, _ := url.Parse(origin.URL)
+	p := New(u, kv.NewStore(1<<20), selfOwner)
+
+	for _, path := range []string{"/private", "/plain"} {
+		get(t, p, path, nil)
+		get(t, p, path, nil)
+	}
+	get(t, p, "/fresh", http.Header{"Authorization": {"Bearer x"}})
+	get(t, p, "/fresh", http.Header{"Authorization": {"Bearer x"}})
+	if got := hits.Load(); got != 6 {
+		t.Fatalf("origin hits = %d, want 6", got)
+	}
+}
+
+func TestProxyRoutesToOwner(t *testing.T) {
+	var hits atomic.Int32
+	origin := newOrigin(t, &hits)
+	u, _ := url.Parse(origin.URL)
+
+	ownerStore := kv.NewStore(1 << 20)
+	owner := httptest.NewServer(New(u, ownerStore, selfOwner).Routed())
+	defer owner.Close()
+	ownerAddr := strings.TrimPrefix(owner.URL, "http://")
+
+	edge := New(u, kv.NewStore(1<<20), func(string) (string, bool, bool) { return ownerAddr, false, true })
+	get(t, edge, "/fresh", nil)
+	rec := get(t, edge, "/fresh", nil)
+
+	if rec.Header().Get(HeaderCache) != "HIT" || rec.Body.String() != "fresh:" {
+		t.Fatalf("routed response = %q (%s)", rec.Body.String(), rec.Header().Get(HeaderCache))
+	}
+	if ownerStore.Len() == 0 {
+		t.Fatalf("response was not stored on the owner")
+	}
+	if got := hits.Load(); got != 1 {
+		t.Fatalf("origin hits = %d, want 1", got)
+	}
+}
+
+func TestProxyAlwaysRoutesPublicRequests(t *testing.T) {
+	var hits atomic.Int32
+	origin := newOrigin(t, &hits)
+	u, _ := url.Parse(origin.URL)
+
+	var routed atomic.Int32
+	owner := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if strings.HasPrefix(req.URL.Path, RoutedPath+"/") {
+			routed.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer owner.Close()
+	ownerAddr := strings.TrimPrefix(owner.URL, "http://")
+
+	edgeStore := kv.NewStore(1 << 20)
+	edge := New(u, edgeStore, func(string) (string, bool, bool) { return ownerAddr, false, true })
+	get(t, edge, RoutedPath+"/fresh", http.Header{"X-Zephyr-Proxy-Routed": {"1"}})
+
+	if routed.Load() != 1 {
+		t.Fatalf("request was not routed to the owner")
+	}
+	if edgeStore.Len() != 0 || hits.Load() != 0 {
+		t.Fatalf("non-owner filled its cache: stored %d, origin hits %d", edgeStore.Len(), hits.Load())
+	}
+}
+
+func TestFreshness(t *testing.T) {
+	now := time.Now()
+	resp := func(h http.Header) *http.Response { return &http.Response{StatusCode: http.StatusOK, Header: h} }
+
+	cases := []struct {
+		name string
+		h    http.Header
+		want time.Duration
+		ok   bool
+	}{
+		{"max-age", http.Header{"Cache-Control": {"max-age=30"}}, 30 * time.Second, true},
+		{"s-maxage wins", http.Header{"Cache-Control": {"max-age=30, s-maxage=90"}}, 90 * time.Second, true},
+		{"age subtracted", http.Header{"Cache-Control": {"max-age=30"}, "Age": {"10"}}, 20 * time.Second, true},
+		{"expires", http.Header{"Date": {now.UTC().Format(http.TimeFormat)}, "Expires": {now.Add(time.Minute).UTC().Format(http.TimeFormat)}}, time.Minute, true},
+		{"no-store", http.Header{"Cache-Control": {"no-store, max-age=30"}}, 0, false},
+		{"no freshness", http.Header{}, 0, false},
+		{"vary star", http.Header{"Cache-Control": {"max-age=30"}, "Vary": {"*"}}, 0, false},
+	}
+	for _, c := range cases {
+		got, ok := freshness(resp(c.h), now)
+		if ok != c.ok || got.Round(time.Second) != c.want {
+			t.Errorf("%s: freshness = %v,%v want %v,%v", c.name, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestProxyLooksUpTheStorePerRequest(t *testing.T) {
+	var hits atomic.Int32
+	origin := newOrigin(t, &hits)
+	u, _ := url.Parse(origin.URL)
+	var current atomic.Pointer[kv.Store]
+	p := New(u, nil, selfOwner)
+	p.StoreFunc = func() (*kv.Store, bool) {
+		st := current.Load()
+		return st, st != nil
+	}
+
+	// without a store the origin answers every request
+	for range 2 {
+		if rec := get(t, p, "/fresh", nil); rec.Body.String() != "fresh:" || rec.Header().Get(HeaderCache) != "" {
+			t.Fatalf("uncached response = %q (X-Cache %q)", rec.Body.String(), rec.Header().Get(HeaderCache))
+		}
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("origin hits without a store = %d, want 2", got)
+	}
+
+	current.Store(kv.NewStore(1 << 20))
+	get(t, p, "/fresh", nil)
+	if rec := get(t, p, "/fresh", nil); rec.Header().Get(HeaderCache) != "HIT" {
+		t.Fatalf("X-Cache once the store exists = %q, want HIT", rec.Header().Get(HeaderCache))
+	}
+	if got := hits.Load(); got != 3 {
+		t.Fatalf("origin hits = %d, want 3", got)
+	}
+}
@@ -0,0 +1,95 @@
+// Package jsondoc reads and patches JSON documents: sub-documents addressed by
+// JSON Pointer (RFC 6901), JSON Patch (RFC 6902) and JSON Merge Patch
+// (RFC 7396). Numbers are kept as json.Number so they survive a round trip
+// unchanged.
+package jsondoc
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	// ErrNotFound is returned for a pointer that does not resolve.
+	ErrNotFound = errors.New("jsondoc: path not found")
+	// ErrTestFailed is returned when a JSON Patch "test" op does not match.
+	ErrTestFailed = errors.New("jsondoc: test failed")
+	// ErrInvalidPointer is returned for a malformed JSON Pointer.
+	ErrInvalidPointer = errors.New("jsondoc: invalid pointer")
+)
+
+// Decode parses a single JSON value.
+func Decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("jsondoc: trailing data after JSON value")
+	}
+	return v, nil
+}
+
+// Get returns the sub-document of doc at pointer, e.g. "/items/0/name". The
+// empty pointer selects the whole document.
+func Get(doc []byte, pointer string) ([]byte, error) {
+	tokens, err := parsePointer(pointer)
+	if err != nil {
+		return nil, err
+	}
+	v, err := Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	for _, tok := range tokens {
+		if v, err = child(v, tok); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(v)
+}
+
+// parsePointer splits a JSON Pointer into its unescaped reference tokens.
+func parsePointer(p string) ([]string, error) {
+	if p == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(p, "/") {
+		return nil, fmt.Errorf("%w %q: must start with /", ErrInvalidPointer, p)
+	}
+	tokens := strings.Split(p[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.NewReplacer("~1", "/", "~0", "~").Replace(t)
+	}
+	return tokens, nil
+}
+
+// child returns the member tok of an object or the element tok of an array.
+func child(v any, tok string) (any, error) {
+	switch c := v.(type) {
+	case map[string]any:
+		if m, ok := c[tok]; ok {
+			return m, nil
+		}
+	case []any:
+		if i, err := index(tok, len(c)); err == nil && i < len(c) {
+			return c[i], nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+// index parses an array index token, which must lie within [0, n].
+func index(tok string, n int) (int, error) {
+	i, err := strconv.Atoi(tok)
+	if err != nil || i < 0 || i > n || (len(tok) > 1 && tok[0] == '0') {
+		return 0, ErrNotFound
+	}
+	return i, nil
+}
@@ -0,0 +1,78 @@
+package jsondoc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGet(t *testing.T) {
+	doc := []byte(`{"a/b": {"c~d": [10, {"e": 1.50}]}, "n": null}`)
+	for ptr, want := range map[string]string{
+		"":               `{"a/b":{"c~d":[10,{"e":1.50}]},"n":null}`,
+		"/a~1b/c~0d/1":   `{"e":1.50}`,
+		"/a~1b/c~0d/1/e": `1.50`,
+		"/n":             `null`,
+	} {
+		got, err := Get(doc, ptr)
+		if err != nil || string(got) != want {
+			t.Errorf("Get(%q) = %s, %v; want %s", ptr, got, err, want)
+		}
+	}
+	for _, ptr := range []string{"/missing", "/a~1b/c~0d/2", "/a~1b/c~0d/01"} {
+		if _, err := Get(doc, ptr); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get(%q) err = %v, want ErrNotFound", ptr, err)
+		}
+	}
+}
+
+func TestPatch(t *testing.T) {
+	for _, tc := range []struct {
+		doc, patch, want string
+	}{
+		{`{"foo": "bar"}`, `[{"op": "add", "path": "/baz", "value": "qux"}]`, `{"baz":"qux","foo":"bar"}`},
+		{`{"foo": ["bar", "baz"]}`, `[{"op": "add", "path": "/foo/1", "value": "qux"}]`, `{"foo":["bar","qux","baz"]}`},
+		{`{"foo": ["bar"]}`, `[{"op": "add", "path": "/foo/-", "value": 1}]`, `{"foo":["bar",1]}`},
+		{`{"baz": "qux", "foo": "bar"}`, `[{"op": "remove", "path": "/baz"}]`, `{"foo":"bar"}`},
+		{`{"foo": ["bar", "qux", "baz"]}`, `[{"op": "remove", "path": "/foo/1"}]`, `{"foo":["bar","baz"]}`},
+		{`{"baz": "qux"}`, `[{"op": "replace", "path": "/baz", "value": "boo"}]`, `{"baz":"boo"}`},
+		{`{"foo": {"bar": "baz"}}`, `[{"op": "move", "from": "/foo/bar", "path": "/qux"}]`, `{"foo":{},"qux":"baz"}`},
+		{`{"foo": {"bar": 1}}`, `[{"op": "copy", "from": "/foo", "path": "/c"}, {"op": "replace", "path": "/c/bar", "value": 2}]`, `{"c":{"bar":2},"foo":{"bar":1}}`},
+		{`{"n": 1}`, `[{"op": "test", "path": "/n", "value": 1.0}]`, `{"n":1}`},
+	} {
+		p, err := ParsePatch([]byte(tc.patch))
+		if err != nil {
+			t.Fatalf("ParsePatch(%s): %v", tc.patch, err)
+		}
+		got, err := p.Apply([]byte(tc.doc))
+		if err != nil || string(got) != tc.want {
+			t.Errorf("%s on %s = %s, %v; want %s", tc.patch, tc.doc, got, err, tc.want)
+		}
+	}
+}
+
+func TestPatchErrors(t *testing.T) {
+	p, _ := ParsePatch([]byte(`[{"op": "replace", "path": "/a", "value": 2}, {"op": "test", "path": "/b", "value": "x"}]`))
+	if _, err := p.Apply([]byte(`{"a": 1, "b": "y"}`)); !errors.Is(err, ErrTestFailed) {
+		t.Fatalf("failing test op err = %v, want ErrTestFailed", err)
+	}
+	p, _ = ParsePatch([]byte(`[{"op": "remove", "path": "/missing"}]`))
+	if _, err := p.Apply([]byte(`{}`)); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("remove of missing member err = %v, want ErrNotFound", err)
+	}
+	for _, bad := range []string{`{}`, `[{"op": "add", "path": "/a"}]`, `[{"op": "jump", "path": "/a"}]`, `[{"op": "remove", "path": "a"}]`} {
+		if _, err := ParsePatch([]byte(bad)); err == nil {
+			t.Errorf("ParsePatch(%s) succeeded", bad)
+		}
+	}
+}
+
+func TestMergePatch(t *testing.T) {
+	got, err := MergePatch(
+		[]byte(`{"title": "Goodbye!", "author": {"givenName": "John", "familyName": "Doe"}, "tags": ["example", "sample"]}`),
+		[]byte(`{"title": "Hello!", "phoneNumber": "+01-123-456-7890", "author": {"familyName": null}, "tags": ["example"]}`),
+	)
+	want := `{"author":{"givenName":"John"},"phoneNumber":"+01-123-456-7890","tags":["example"],"title":"Hello!"}`
+	if err != nil || string(got) != want {
+		t.Fatalf("MergePatch = %s, %v; want %s", got, err, want)
+	}
+}
@@ -0,0 +1,271 @@
+package jsondoc
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Operation is one operation of a JSON Patch.
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Patch is a parsed JSON Patch document.
+type Patch []Operation
+
+// ParsePatch parses and validates a JSON Patch document.
+func ParsePatch(data []byte) (Patch, error) {
+	var p Patch
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("jsondoc: invalid patch: %w", err)
+	}
+	for i, op := range p {
+		switch op.Op {
+		case "add", "replace", "test":
+			if op.Value == nil {
+				return nil, fmt.Errorf("jsondoc: op %d (%s) needs a value", i, op.Op)
+			}
+		case "move", "copy":
+			if _, err := parsePointer(op.From); err != nil {
+				return nil, fmt.Errorf("jsondoc: op %d: %w", i, err)
+			}
+		case "remove":
+		default:
+			return nil, fmt.Errorf("jsondoc: op %d: unknown op %q", i, op.Op)
+		}
+		if _, err := parsePointer(op.Path); err != nil {
+			return nil, fmt.Errorf("jsondoc: op %d: %w", i, err)
+		}
+	}
+	return p, nil
+}
+
+// Apply applies the patch to doc and returns the result. The operations are
+// applied in order and either all of them succeed or doc is left as it was;
+// errors wrap ErrNotFound or ErrTestFailed where they apply.
+func (p Patch) Apply(doc []byte) ([]byte, error) {
+	v, err := Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	for i, op := range p {
+		if v, err = applyOp(v, op); err != nil {
+			return nil, fmt.Errorf("op %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(v)
+}
+
+func applyOp(doc any, op Operation) (any, error) {
+	path, _ := parsePointer(op.Path)
+	var val any
+	if op.Value != nil {
+		var err error
+		if val, err = Decode(op.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	switch op.Op {
+	case "add":
+		return add(doc, path, val)
+	case "remove":
+		return remove(doc, path)
+	case "replace":
+		return replace(doc, path, val)
+	case "test":
+		cur, err := get(doc, path)
+		if err != nil {
+			return nil, err
+		}
+		if !equal(cur, val) {
+			return nil, ErrTestFailed
+		}
+		return doc, nil
+	}
+
+	from, _ := parsePointer(op.From)
+	v, err := get(doc, from)
+	if err != nil {
+		return nil, err
+	}
+	if op.Op == "copy" {
+		// the copy must not share maps with the original
+		data, _ := json.Marshal(v)
+		v, _ = Decode(data)
+		return add(doc, path, v)
+	}
+	if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+		return nil, fmt.Errorf("jsondoc: cannot move %s into its own child", op.From)
+	}
+	if doc, err = remove(doc, from); err != nil {
+		return nil, err
+	}
+	return add(doc, path, v)
+}
+
+func get(doc any, path []string) (any, error) {
+	var err error
+	for _, tok := range path {
+		if doc, err = child(doc, tok); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// edit descends doc along path and replaces the container holding its last
+// token with what fn returns, so that arrays can grow and shrink. It returns
+// the new root.
+func edit(doc any, path []string, fn func(container any, last string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(doc, path[0])
+	}
+	c, err := child(doc, path[0])
+	if err != nil {
+		return nil, err
+	}
+	if c, err = edit(c, path[1:], fn); err != nil {
+		return nil, err
+	}
+	switch p := doc.(type) {
+	case map[string]any:
+		p[path[0]] = c
+	case []any:
+		i, _ := index(path[0], len(p))
+		p[i] = c
+	}
+	return doc, nil
+}
+
+func add(doc any, path []string, val any) (any, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	return edit(doc, path, func(c any, last string) (any, error) {
+		switch c := c.(type) {
+		case map[string]any:
+			c[last] = val
+			return c, nil
+		case []any:
+			if last == "-" {
+				return append(c, val), nil
+			}
+			i, err := index(last, len(c))
+			if err != nil {
+				return nil, err
+			}
+			return slices.Insert(c, i, val), nil
+		}
+		return nil, ErrNotFound
+	})
+}
+
+func remove(doc any, path []string) (any, error) {
+	if len(path) == 0 {
+		return nil, fmt.Errorf("jsondoc: cannot remove the whole document")
+	}
+	return edit(doc, path, func(c any, last string) (any, error) {
+		switch c := c.(type) {
+		case map[string]any:
+			if _, ok := c[last]; ok {
+				delete(c, last)
+				return c, nil
+			}
+		case []any:
+			if i, err := index(last, len(c)); err == nil && i < len(c) {
+				return slices.Delete(c, i, i+1), nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+}
+
+func replace(doc any, path []string, val any) (any, error) {
+	if len(path) == 0 {
+		return val, nil
+	}
+	return edit(doc, path, func(c any, last string) (any, error) {
+		switch c := c.(type) {
+		case map[string]any:
+			if _, ok := c[last]; ok {
+				c[last] = val
+				return c, nil
+			}
+		case []any:
+			if i, err := index(last, len(c)); err == nil && i < len(c) {
+				c[i] = val
+				return c, nil
+			}
+		}
+		return nil, ErrNotFound
+	})
+}
+
+// equal compares two decoded JSON values, numbers by value.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			if w, ok := b[k]; !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	case []any:
+		b, ok := b.([]any)
+		return ok && slices.EqualFunc(a, b, equal)
+	}
+	return a == b
+}
+
+// MergePatch applies a JSON Merge Patch to doc: objects in the patch are
+// merged member by member, null members are removed and any other value
+// replaces what was there.
+func MergePatch(doc, patch []byte) ([]byte, error) {
+	p, err := Decode(patch)
+	if err != nil {
+		return nil, fmt.Errorf("jsondoc: invalid merge patch: %w", err)
+	}
+	v, err := Decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(merge(v, p))
+}
+
+func merge(target, patch any) any {
+	p, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	t, ok := target.(map[string]any)
+	if !ok {
+		t = make(map[string]any)
+	}
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+		} else {
+			t[k] = merge(t[k], v)
+		}
+	}
+	return t
+}
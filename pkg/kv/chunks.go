@@ -0,0 +1,95 @@
+package kv
+
+import (
+	"bytes"
+	"io"
+)
+
+// ChunkSize is the size of the chunks PutStream stores large values in, so
+// that no single allocation grows with the value.
+const ChunkSize = 64 << 10
+
+// PutStream stores the value read from r under key like PutWithOptions. Values
+// larger than ChunkSize are kept in chunks of that size as they are read,
+// instead of being buffered into one contiguous slice, and are stored
+// uncompressed. If reading r fails the previous value is left in place.
+func (s *Store) PutStream(key string, r io.Reader, opts PutOptions) error {
+	chunks, err := readChunks(r)
+	if err != nil {
+		return err
+	}
+	if len(chunks) <= 1 {
+		var val []byte
+		if len(chunks) == 1 {
+			val = chunks[0]
+		}
+		return s.PutWithOptions(key, val, opts)
+	}
+	return s.put(&entry{key: key, chunks: chunks}, opts, nil)
+}
+
+// readChunks reads r to EOF into chunks of ChunkSize bytes. The last chunk is
+// trimmed to its length so that capacity accounting matches memory use. Unlike
+// io.ReadFull it passes on io.ErrUnexpectedEOF from r, e.g. for a request body
+// cut short, rather than treating it as the end of the value.
+func readChunks(r io.Reader) ([][]byte, error) {
+	var chunks [][]byte
+	for {
+		buf := make([]byte, ChunkSize)
+		var (
+			n   int
+			err error
+		)
+		for n < len(buf) && err == nil {
+			var m int
+			m, err = r.Read(buf[n:])
+			n += m
+		}
+		if n == ChunkSize {
+			chunks = append(chunks, buf)
+		} else if n > 0 {
+			chunks = append(chunks, append([]byte(nil), buf[:n]...))
+		}
+		switch {
+		case err == io.EOF:
+			return chunks, nil
+		case err != nil:
+			return nil, err
+		}
+	}
+}
+
+// Len returns the length of the item's value.
+func (it Item) Len() int {
+	n := len(it.Value)
+	for _, c := range it.chunks {
+		n += len(c)
+	}
+	return n
+}
+
+// Bytes returns the item's value, joining it into one slice if it is stored in
+// chunks.
+func (it Item) Bytes() []byte {
+	if it.chunks == nil {
+		return it.Value
+	}
+	return bytes.Join(it.chunks, nil)
+}
+
+// WriteTo writes the item's value to w chunk by chunk.
+func (it Item) WriteTo(w io.Writer) (int64, error) {
+	if it.chunks == nil {
+		n, err := w.Write(it.Value)
+		return int64(n), err
+	}
+	var total int64
+	for _, c := range it.chunks {
+		n, err := w.Write(c)
+		total += int64(n)
+		if err != nil {
+			return total, err
+		}
+	}
+	return total, nil
+}
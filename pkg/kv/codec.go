@@ -0,0 +1,74 @@
+package kv
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// Codec is a compression format values can be stored in. The names match the
+// HTTP content-codings where one exists, so compressed values can be handed to
+// clients as-is.
+type Codec string
+
+const (
+	CodecNone   Codec = ""
+	CodecGzip   Codec = "gzip"
+	CodecZstd   Codec = "zstd"
+	CodecSnappy Codec = "snappy"
+)
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil)
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// ParseCodec validates a codec name.
+func ParseCodec(name string) (Codec, error) {
+	switch c := Codec(name); c {
+	case CodecNone, CodecGzip, CodecZstd, CodecSnappy:
+		return c, nil
+	default:
+		return CodecNone, fmt.Errorf("kv: unknown codec %q", name)
+	}
+}
+
+func (c Codec) compress(src []byte) ([]byte, error) {
+	switch c {
+	case CodecGzip:
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(src); err != nil {
+			return nil, err
+		}
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case CodecZstd:
+		return zstdEncoder.EncodeAll(src, nil), nil
+	case CodecSnappy:
+		return snappy.Encode(nil, src), nil
+	}
+	return src, nil
+}
+
+func (c Codec) decompress(src []byte) ([]byte, error) {
+	switch c {
+	case CodecGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(src))
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(zr)
+	case CodecZstd:
+		return zstdDecoder.DecodeAll(src, nil)
+	case CodecSnappy:
+		return snappy.Decode(nil, src)
+	}
+	return append([]byte(nil), src...), nil
+}
@@ -0,0 +1,558 @@
+package kv
+
+import (
+	"cmp"
+	"errors"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kind is the type of value a key holds.
+type Kind int
+
+const (
+	KindString    Kind = iota // an opaque value written with Put
+	KindHash                  // fields mapped to values
+	KindList                  // an ordered list of values
+	KindSet                   // a set of unique members
+	KindZSet                  // members ordered by a score
+	KindSiblings              // concurrent values written with PutSibling
+	KindLock                  // a lock taken with Acquire
+	KindRateLimit             // the counters of a rate limit checked with Allow
+)
+
+func (k Kind) String() string {
+	switch k {
+	case KindHash:
+		return "hash"
+	case KindList:
+		return "list"
+	case KindSet:
+		return "set"
+	case KindZSet:
+		return "zset"
+	case KindSiblings:
+		return "siblings"
+	case KindLock:
+		return "lock"
+	case KindRateLimit:
+		return "ratelimit"
+	}
+	return "string"
+}
+
+// ErrWrongType is returned by operations against a key holding a different
+// kind of value. Put replaces a key of any kind.
+var ErrWrongType = errors.New("kv: key holds the wrong kind of value")
+
+// collection is a typed value updated in place. Each implementation keeps
+// track of the bytes it holds for capacity accounting.
+type collection interface {
+	kind() Kind
+	len() int
+	size() int
+}
+
+func (e *entry) kind() Kind {
+	if e.coll == nil {
+		return KindString
+	}
+	return e.coll.kind()
+}
+
+func newCollection(k Kind) collection {
+	switch k {
+	case KindHash:
+		return &hashValue{fields: make(map[string][]byte)}
+	case KindList:
+		return &listValue{}
+	case KindSet:
+		return &setValue{members: make(map[string]struct{})}
+	case KindZSet:
+		return &zsetValue{scores: make(map[string]float64)}
+	case KindSiblings:
+		return &siblingsValue{}
+	}
+	panic("kv: not a collection kind: " + k.String())
+}
+
+// update runs fn against the collection of kind k under key. A missing key
+// is created empty with the default TTL if create is set and left alone
+// otherwise. grow bounds the bytes fn can add and is checked up front against
+// the capacity of a PolicyNoEviction store. Collections fn leaves empty are
+// deleted, as in Redis.
+func (s *Store) update(key string, k Kind, create bool, grow int, fn func(c collection)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.live(key)
+	switch {
+	case ok && el.Value.(*entry).kind() != k:
+		return ErrWrongType
+	case !ok && !create:
+		return nil
+	}
+	if s.policy == PolicyNoEviction && !s.fits(grow) {
+		return ErrFull
+	}
+	created := !ok
+	if created {
+		e := &entry{key: key, coll: newCollection(k)}
+		s.prepare(e, PutOptions{}, time.Now())
+		el = s.ll.PushFront(e)
+		s.data[key] = el
+	} else {
+		s.touch(el)
+	}
+
+	e := el.Value.(*entry)
+	before := e.coll.size()
+	fn(e.coll)
+	s.used += e.coll.size() - before
+	e.version = s.clock.Now()
+	switch {
+	case e.coll.len() == 0 && created:
+		// nothing was stored; the key never existed
+		s.used -= e.coll.size() - before
+		delete(s.data, key)
+		s.ll.Remove(el)
+		return nil
+	case e.coll.len() == 0:
+		s.removeElement(el, OpDelete)
+		return nil
+	case created:
+		s.unbury(key)
+	}
+	s.emit(Mutation{Op: OpUpdate, Key: key, ExpireAt: e.expireAt})
+	s.evictIfNeeded()
+	return nil
+}
+
+// view runs fn against the collection of kind k under key, counting as a
+// read. It reports whether key exists.
+func (s *Store) view(key string, k Kind, fn func(c collection)) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.live(key)
+	if !ok {
+		return false, nil
+	}
+	e := el.Value.(*entry)
+	if e.kind() != k {
+		return true, ErrWrongType
+	}
+	s.touch(el)
+	if e.sliding {
+		e.expireAt = time.Now().Add(e.ttl)
+	}
+	fn(e.coll)
+	return true, nil
+}
+
+// hashValue is a KindHash value.
+type hashValue struct {
+	fields map[string][]byte
+	bytes  int
+}
+
+func (h *hashValue) kind() Kind { return KindHash }
+func (h *hashValue) len() int   { return len(h.fields) }
+func (h *hashValue) size() int  { return h.bytes }
+
+// HSet sets field of the hash under key to val and reports whether the field
+// is new.
+func (s *Store) HSet(key, field string, val []byte) (bool, error) {
+	var added bool
+	err := s.update(key, KindHash, true, len(field)+len(val), func(c collection) {
+		h := c.(*hashValue)
+		old, ok := h.fields[field]
+		if ok {
+			h.bytes -= len(field) + len(old)
+		}
+		h.fields[field] = append([]byte(nil), val...)
+		h.bytes += len(field) + len(val)
+		added = !ok
+	})
+	return added, err
+}
+
+// HGet returns field of the hash under key.
+func (s *Store) HGet(key, field string) ([]byte, bool, error) {
+	var (
+		val   []byte
+		found bool
+	)
+	_, err := s.view(key, KindHash, func(c collection) {
+		var v []byte
+		if v, found = c.(*hashValue).fields[field]; found {
+			val = append([]byte(nil), v...)
+		}
+	})
+	return val, found, err
+}
+
+// HGetAll returns every field of the hash under key, or nil if key is missing.
+func (s *Store) HGetAll(key string) (map[string][]byte, error) {
+	var out map[string][]byte
+	_, err := s.view(key, KindHash, func(c collection) {
+		out = make(map[string][]byte, c.len())
+		for f, v := range c.(*hashValue).fields {
+			out[f] = append([]byte(nil), v...)
+		}
+	})
+	return out, err
+}
+
+// HDel removes fields from the hash under key and returns how many existed.
+func (s *Store) HDel(key string, fields ...string) (int, error) {
+	n := 0
+	err := s.update(key, KindHash, false, 0, func(c collection) {
+		h := c.(*hashValue)
+		for _, f := range fields {
+			if v, ok := h.fields[f]; ok {
+				delete(h.fields, f)
+				h.bytes -= len(f) + len(v)
+				n++
+			}
+		}
+	})
+	return n, err
+}
+
+// listItemBytes is what each item of a list counts against capacity on top
+// of its value, for the slice header it is kept in.
+const listItemBytes = 24
+
+// listValue is a KindList value: a deque kept in a ring buffer, so that
+// pushes and pops at either end take constant time.
+type listValue struct {
+	buf   [][]byte // ring buffer, empty or a power of two long
+	head  int      // position of the first item in buf
+	n     int      // number of items
+	bytes int
+}
+
+func (l *listValue) kind() Kind { return KindList }
+func (l *listValue) len() int   { return l.n }
+func (l *listValue) size() int  { return l.bytes }
+
+// at returns the i-th item of the list.
+func (l *listValue) at(i int) []byte {
+	return l.buf[(l.head+i)&(len(l.buf)-1)]
+}
+
+// resize moves the items into a buffer of capacity size.
+func (l *listValue) resize(size int) {
+	buf := make([][]byte, size)
+	for i := range l.n {
+		buf[i] = l.at(i)
+	}
+	l.buf, l.head = buf, 0
+}
+
+func (l *listValue) pushFront(v []byte) {
+	if l.n == len(l.buf) {
+		l.resize(max(2*len(l.buf), 8))
+	}
+	l.head = (l.head - 1) & (len(l.buf) - 1)
+	l.buf[l.head] = v
+	l.n++
+	l.bytes += len(v) + listItemBytes
+}
+
+func (l *listValue) pushBack(v []byte) {
+	if l.n == len(l.buf) {
+		l.resize(max(2*len(l.buf), 8))
+	}
+	l.buf[(l.head+l.n)&(len(l.buf)-1)] = v
+	l.n++
+	l.bytes += len(v) + listItemBytes
+}
+
+// pop removes the first or last item. The list must not be empty.
+func (l *listValue) pop(front bool) []byte {
+	i := (l.head + l.n - 1) & (len(l.buf) - 1)
+	if front {
+		i = l.head
+		l.head = (l.head + 1) & (len(l.buf) - 1)
+	}
+	v := l.buf[i]
+	l.buf[i] = nil
+	l.n--
+	l.bytes -= len(v) + listItemBytes
+	if len(l.buf) > 8 && l.n <= len(l.buf)/4 {
+		l.resize(len(l.buf) / 2)
+	}
+	return v
+}
+
+// LPush prepends vals to the list under key, so that the last of them ends
+// up first, and returns the new length.
+func (s *Store) LPush(key string, vals ...[]byte) (int, error) {
+	return s.push(key, true, vals)
+}
+
+// RPush appends vals to the list under key and returns the new length.
+func (s *Store) RPush(key string, vals ...[]byte) (int, error) {
+	return s.push(key, false, vals)
+}
+
+func (s *Store) push(key string, front bool, vals [][]byte) (int, error) {
+	grow := 0
+	for _, v := range vals {
+		grow += len(v) + listItemBytes
+	}
+	n := 0
+	err := s.update(key, KindList, true, grow, func(c collection) {
+		l := c.(*listValue)
+		for _, v := range vals {
+			v = append([]byte(nil), v...)
+			if front {
+				l.pushFront(v)
+			} else {
+				l.pushBack(v)
+			}
+		}
+		n = l.len()
+	})
+	return n, err
+}
+
+// LPop removes and returns the first value of the list under key.
+func (s *Store) LPop(key string) ([]byte, bool, error) {
+	return s.pop(key, true)
+}
+
+// RPop removes and returns the last value of the list under key.
+func (s *Store) RPop(key string) ([]byte, bool, error) {
+	return s.pop(key, false)
+}
+
+func (s *Store) pop(key string, front bool) ([]byte, bool, error) {
+	var (
+		val   []byte
+		found bool
+	)
+	err := s.update(key, KindList, false, 0, func(c collection) {
+		l := c.(*listValue)
+		if found = l.len() > 0; found {
+			val = l.pop(front)
+		}
+	})
+	return val, found, err
+}
+
+// LRange returns the values of the list under key from start to stop
+// inclusive. Negative indexes count from the end, -1 being the last value.
+func (s *Store) LRange(key string, start, stop int) ([][]byte, error) {
+	var out [][]byte
+	_, err := s.view(key, KindList, func(c collection) {
+		l := c.(*listValue)
+		start, stop = clampRange(start, stop, l.len())
+		for i := start; i < stop; i++ {
+			out = append(out, append([]byte(nil), l.at(i)...))
+		}
+	})
+	return out, err
+}
+
+// clampRange turns an inclusive Redis-style range into slice bounds.
+func clampRange(start, stop, n int) (int, int) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	start = max(start, 0)
+	stop = min(stop+1, n)
+	if start >= stop {
+		return 0, 0
+	}
+	return start, stop
+}
+
+// setValue is a KindSet value.
+type setValue struct {
+	members map[string]struct{}
+	bytes   int
+}
+
+func (st *setValue) kind() Kind { return KindSet }
+func (st *setValue) len() int   { return len(st.members) }
+func (st *setValue) size() int  { return st.bytes }
+
+// SAdd adds members to the set under key and returns how many were new.
+func (s *Store) SAdd(key string, members ...string) (int, error) {
+	grow := 0
+	for _, m := range members {
+		grow += len(m)
+	}
+	n := 0
+	err := s.update(key, KindSet, true, grow, func(c collection) {
+		st := c.(*setValue)
+		for _, m := range members {
+			if _, ok := st.members[m]; !ok {
+				st.members[m] = struct{}{}
+				st.bytes += len(m)
+				n++
+			}
+		}
+	})
+	return n, err
+}
+
+// SRem removes members from the set under key and returns how many existed.
+func (s *Store) SRem(key string, members ...string) (int, error) {
+	n := 0
+	err := s.update(key, KindSet, false, 0, func(c collection) {
+		st := c.(*setValue)
+		for _, m := range members {
+			if _, ok := st.members[m]; ok {
+				delete(st.members, m)
+				st.bytes -= len(m)
+				n++
+			}
+		}
+	})
+	return n, err
+}
+
+// SIsMember reports whether member is in the set under key.
+func (s *Store) SIsMember(key, member string) (bool, error) {
+	var found bool
+	_, err := s.view(key, KindSet, func(c collection) {
+		_, found = c.(*setValue).members[member]
+	})
+	return found, err
+}
+
+// SMembers returns the members of the set under key in sorted order.
+func (s *Store) SMembers(key string) ([]string, error) {
+	var out []string
+	_, err := s.view(key, KindSet, func(c collection) {
+		out = slices.Sorted(maps.Keys(c.(*setValue).members))
+	})
+	return out, err
+}
+
+// zsetValue is a KindZSet value. Besides the score of each member it keeps
+// the members ordered by score and then by member, so that a range is found
+// by binary search.
+type zsetValue struct {
+	scores map[string]float64
+	order  []ZMember
+	bytes  int
+}
+
+// zsetEntryBytes is what each member counts against capacity besides its
+// name: its score and its slot in the ordered slice.
+const zsetEntryBytes = 32
+
+func (z *zsetValue) kind() Kind { return KindZSet }
+func (z *zsetValue) len() int   { return len(z.scores) }
+func (z *zsetValue) size() int  { return z.bytes }
+
+// compareZMembers orders members by score and then by member.
+func compareZMembers(a, b ZMember) int {
+	if c := cmp.Compare(a.Score, b.Score); c != 0 {
+		return c
+	}
+	return strings.Compare(a.Member, b.Member)
+}
+
+// set gives member score and reports whether it is new.
+func (z *zsetValue) set(member string, score float64) bool {
+	old, exists := z.scores[member]
+	if exists {
+		if old == score {
+			return false
+		}
+		z.remove(member, old)
+	}
+	z.scores[member] = score
+	m := ZMember{Member: member, Score: score}
+	i, _ := slices.BinarySearchFunc(z.order, m, compareZMembers)
+	z.order = slices.Insert(z.order, i, m)
+	if !exists {
+		z.bytes += len(member) + zsetEntryBytes
+	}
+	return !exists
+}
+
+// remove drops member, which has score, from the ordered slice.
+func (z *zsetValue) remove(member string, score float64) {
+	if i, ok := slices.BinarySearchFunc(z.order, ZMember{Member: member, Score: score}, compareZMembers); ok {
+		z.order = slices.Delete(z.order, i, i+1)
+	}
+}
+
+// between returns the members scored within [lo, hi], in order.
+func (z *zsetValue) between(lo, hi float64) []ZMember {
+	start := sort.Search(len(z.order), func(i int) bool { return cmp.Compare(z.order[i].Score, lo) >= 0 })
+	end := start + sort.Search(len(z.order)-start, func(i int) bool { return cmp.Compare(z.order[start+i].Score, hi) > 0 })
+	return slices.Clone(z.order[start:end])
+}
+
+// ZMember is a member of a sorted set with its score.
+type ZMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// ZAdd sets the score of member in the sorted set under key and reports
+// whether the member is new.
+func (s *Store) ZAdd(key, member string, score float64) (bool, error) {
+	var added bool
+	err := s.update(key, KindZSet, true, len(member)+zsetEntryBytes, func(c collection) {
+		added = c.(*zsetValue).set(member, score)
+	})
+	return added, err
+}
+
+// ZRem removes members from the sorted set under key and returns how many
+// existed.
+func (s *Store) ZRem(key string, members ...string) (int, error) {
+	n := 0
+	err := s.update(key, KindZSet, false, 0, func(c collection) {
+		z := c.(*zsetValue)
+		for _, m := range members {
+			if score, ok := z.scores[m]; ok {
+				z.remove(m, score)
+				delete(z.scores, m)
+				z.bytes -= len(m) + zsetEntryBytes
+				n++
+			}
+		}
+	})
+	return n, err
+}
+
+// ZScore returns the score of member in the sorted set under key.
+func (s *Store) ZScore(key, member string) (float64, bool, error) {
+	var (
+		score float64
+		found bool
+	)
+	_, err := s.view(key, KindZSet, func(c collection) {
+		score, found = c.(*zsetValue).scores[member]
+	})
+	return score, found, err
+}
+
+// ZRangeByScore returns the members of the sorted set under key whose score
+// lies within [lo, hi], ordered by score and then by member. It takes
+// O(log n + k) for k members in range.
+func (s *Store) ZRangeByScore(key string, lo, hi float64) ([]ZMember, error) {
+	var out []ZMember
+	_, err := s.view(key, KindZSet, func(c collection) {
+		if z := c.(*zsetValue); len(z.order) > 0 {
+			out = z.between(lo, hi)
+		}
+	})
+	return out, err
+}
@@ -0,0 +1,391 @@
+package kv
+
+import (
+	"errors"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/vclock"
+)
+
+func TestHash(t *testing.T) {
+	s := NewStore(1 << 20)
+	if added, _ := s.HSet("h", "name", []byte("ada")); !added {
+		t.Fatalf("HSet of new field reported existing")
+	}
+	if added, _ := s.HSet("h", "name", []byte("grace")); added {
+		t.Fatalf("HSet of existing field reported new")
+	}
+	s.HSet("h", "lang", []byte("cobol"))
+	if got := s.Stats().UsedBytes; got != len("name")+len("grace")+len("lang")+len("cobol") {
+		t.Fatalf("UsedBytes = %d", got)
+	}
+	if v, ok, _ := s.HGet("h", "name"); !ok || string(v) != "grace" {
+		t.Fatalf("HGet = %q,%v", v, ok)
+	}
+	if all, _ := s.HGetAll("h"); len(all) != 2 || string(all["lang"]) != "cobol" {
+		t.Fatalf("HGetAll = %q", all)
+	}
+	if n, _ := s.HDel("h", "name", "lang", "missing"); n != 2 {
+		t.Fatalf("HDel = %d, want 2", n)
+	}
+	// only the tombstone of the deleted hash is left
+	if _, ok := s.GetItem("h"); ok || s.Stats().UsedBytes != len("h")+tombstoneOverhead {
+		t.Fatalf("emptied hash not deleted")
+	}
+}
+
+func TestList(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.RPush("l", []byte("b"), []byte("c"))
+	if n, _ := s.LPush("l", []byte("a")); n != 3 {
+		t.Fatalf("LPush len = %d, want 3", n)
+	}
+	for _, tc := range []struct {
+		start, stop int
+		want        []string
+	}{
+		{0, -1, []string{"a", "b", "c"}},
+		{1, 1, []string{"b"}},
+		{-2, 10, []string{"b", "c"}},
+		{2, 1, nil},
+	} {
+		got, _ := s.LRange("l", tc.start, tc.stop)
+		var strs []string
+		for _, v := range got {
+			strs = append(strs, string(v))
+		}
+		if !slices.Equal(strs, tc.want) {
+			t.Errorf("LRange(%d, %d) = %q, want %q", tc.start, tc.stop, strs, tc.want)
+		}
+	}
+	if v, ok, _ := s.LPop("l"); !ok || string(v) != "a" {
+		t.Fatalf("LPop = %q,%v", v, ok)
+	}
+	if v, ok, _ := s.RPop("l"); !ok || string(v) != "c" {
+		t.Fatalf("RPop = %q,%v", v, ok)
+	}
+	if got := s.Stats().UsedBytes; got != 1+listItemBytes {
+		t.Fatalf("UsedBytes = %d, want %d", got, 1+listItemBytes)
+	}
+	s.RPop("l")
+	if _, ok, _ := s.RPop("l"); ok {
+		t.Fatalf("RPop on emptied list succeeded")
+	}
+}
+
+func TestSetAndSortedSet(t *testing.T) {
+	s := NewStore(1 << 20)
+	if n, _ := s.SAdd("s", "x", "y", "x"); n != 2 {
+		t.Fatalf("SAdd = %d, want 2", n)
+	}
+	if ok, _ := s.SIsMember("s", "y"); !ok {
+		t.Fatalf("y not a member")
+	}
+	s.SRem("s", "y")
+	if m, _ := s.SMembers("s"); !slices.Equal(m, []string{"x"}) {
+		t.Fatalf("SMembers = %q", m)
+	}
+
+	s.ZAdd("z", "carol", 3)
+	s.ZAdd("z", "alice", 1)
+	s.ZAdd("z", "bob", 2)
+	s.ZAdd("z", "bob", 5) // rescoring does not grow the set
+	if got := s.Stats().UsedBytes; got != len("x")+len("carolalicebob")+3*zsetEntryBytes {
+		t.Fatalf("UsedBytes = %d", got)
+	}
+	got, _ := s.ZRangeByScore("z", 1, 4)
+	if want := []ZMember{{"alice", 1}, {"carol", 3}}; !slices.Equal(got, want) {
+		t.Fatalf("ZRangeByScore = %v, want %v", got, want)
+	}
+	if score, ok, _ := s.ZScore("z", "bob"); !ok || score != 5 {
+		t.Fatalf("ZScore = %v,%v", score, ok)
+	}
+}
+
+func TestZRangeByScoreMatchesAFullScan(t *testing.T) {
+	s := NewStore(1 << 20)
+	rng := rand.New(rand.NewPCG(1, 2))
+	scores := make(map[string]float64)
+	for range 2000 {
+		m := "m" + strconv.Itoa(rng.IntN(300))
+		if rng.IntN(4) == 0 {
+			s.ZRem("z", m)
+			delete(scores, m)
+			continue
+		}
+		score := float64(rng.IntN(50))
+		s.ZAdd("z", m, score)
+		scores[m] = score
+	}
+	for _, r := range [][2]float64{{0, 49}, {10, 20}, {17, 17}, {-1, 3}, {48, 100}, {30, 10}} {
+		var want []ZMember
+		for m, score := range scores {
+			if score >= r[0] && score <= r[1] {
+				want = append(want, ZMember{Member: m, Score: score})
+			}
+		}
+		slices.SortFunc(want, compareZMembers)
+		if got, _ := s.ZRangeByScore("z", r[0], r[1]); !slices.Equal(got, want) {
+			t.Fatalf("ZRangeByScore(%v, %v) = %v, want %v", r[0], r[1], got, want)
+		}
+	}
+}
+
+func TestCreatingCollectionsAndTombstones(t *testing.T) {
+	s := NewStore(1 << 20)
+	var ops []Op
+	s.SetObserver(func(m Mutation) { ops = append(ops, m.Op) })
+
+	// a collection left empty on creation was never there
+	if n, err := s.SAdd("s"); n != 0 || err != nil {
+		t.Fatalf("SAdd with no members = %d, %v", n, err)
+	}
+	if _, ok := s.Version("s"); ok || len(ops) != 0 || s.Stats().Items != 0 {
+		t.Fatalf("empty SAdd left a trace: ops %v, stats %+v", ops, s.Stats())
+	}
+
+	// creating a collection over a deleted key clears its tombstone
+	s.Put("h", []byte("v"), 0)
+	s.Delete("h")
+	s.HSet("h", "f", []byte("v"))
+	if got, want := s.Stats().UsedBytes, len("f")+len("v"); got != want {
+		t.Fatalf("UsedBytes = %d, want %d without the tombstone", got, want)
+	}
+}
+
+func TestCollectionsTypeChecksAndTTL(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 1 << 20, DefaultTTL: time.Hour})
+	s.Put("str", []byte("v"), 0)
+	if _, err := s.HSet("str", "f", nil); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("HSet on string err = %v, want ErrWrongType", err)
+	}
+	s.SAdd("set", "m")
+	if _, err := s.LRange("set", 0, -1); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("LRange on set err = %v, want ErrWrongType", err)
+	}
+	if it, ok := s.GetItem("set"); !ok || it.Kind != KindSet {
+		t.Fatalf("GetItem(set) = %+v,%v", it, ok)
+	}
+	if info, _ := s.TTL("set"); info.ExpireAt.IsZero() {
+		t.Fatalf("new collection did not get the default TTL")
+	}
+	s.ExpireAt("set", time.Now().Add(-time.Second))
+	if ok, _ := s.SIsMember("set", "m"); ok {
+		t.Fatalf("expired set still readable")
+	}
+	// Put replaces a collection of any kind
+	s.Put("set", []byte("v"), 0)
+	if v, _ := s.Get("set"); string(v) != "v" {
+		t.Fatalf("Put over set = %q", v)
+	}
+}
+
+func TestCollectionsNoEviction(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 8 + 2*listItemBytes, Eviction: PolicyNoEviction})
+	if _, err := s.RPush("l", []byte("1234")); err != nil {
+		t.Fatalf("RPush: %v", err)
+	}
+	if _, err := s.RPush("l", []byte("12345")); !errors.Is(err, ErrFull) {
+		t.Fatalf("RPush over capacity err = %v, want ErrFull", err)
+	}
+	if got, _ := s.LRange("l", 0, -1); len(got) != 1 {
+		t.Fatalf("rejected push changed the list: %q", got)
+	}
+}
+
+func TestListIsADeque(t *testing.T) {
+	s := NewStore(1 << 20)
+	// grow the ring buffer several times with pushes at both ends
+	var want []string
+	for i := range 100 {
+		v := strconv.Itoa(i)
+		if i%3 == 0 {
+			s.LPush("l", []byte(v))
+			want = slices.Insert(want, 0, v)
+		} else {
+			s.RPush("l", []byte(v))
+			want = append(want, v)
+		}
+	}
+	for i := range 60 {
+		var (
+			v  []byte
+			ok bool
+		)
+		if i%2 == 0 {
+			v, ok, _ = s.LPop("l")
+			if !ok || string(v) != want[0] {
+				t.Fatalf("LPop = %q, want %q", v, want[0])
+			}
+			want = want[1:]
+		} else {
+			v, ok, _ = s.RPop("l")
+			if !ok || string(v) != want[len(want)-1] {
+				t.Fatalf("RPop = %q, want %q", v, want[len(want)-1])
+			}
+			want = want[:len(want)-1]
+		}
+	}
+	got, _ := s.LRange("l", 0, -1)
+	var strs []string
+	for _, v := range got {
+		strs = append(strs, string(v))
+	}
+	if !slices.Equal(strs, want) {
+		t.Fatalf("LRange = %q, want %q", strs, want)
+	}
+}
+
+func TestEmptyListItemsCountAgainstCapacity(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 10 * listItemBytes, Eviction: PolicyNoEviction})
+	pushed := 0
+	for range 100 {
+		if _, err := s.RPush("l", nil); err != nil {
+			break
+		}
+		pushed++
+	}
+	if pushed != 10 {
+		t.Fatalf("pushed %d empty items into room for 10", pushed)
+	}
+}
+
+func TestSiblings(t *testing.T) {
+	s := NewStore(1 << 20)
+	c1, _ := s.PutSibling("k", []byte("a"), nil, "n1")
+	c2, _ := s.PutSibling("k", []byte("b"), nil, "n2") // has not seen a
+	sibs, _ := s.Siblings("k")
+	if len(sibs) != 2 || !c1.Concurrent(c2) {
+		t.Fatalf("concurrent writes = %d siblings, clocks %v and %v", len(sibs), c1, c2)
+	}
+
+	// a write with the context of both resolves them, even on a third node
+	c3, _ := s.PutSibling("k", []byte("c"), vclock.Merge(c1, c2), "n1")
+	if sibs, _ = s.Siblings("k"); len(sibs) != 1 || string(sibs[0].Value) != "c" || !c3.Descends(c2) {
+		t.Fatalf("resolved siblings = %+v", sibs)
+	}
+	if got := s.Stats().UsedBytes; got != siblingBytes([]byte("c"), c3) {
+		t.Fatalf("UsedBytes = %d after resolving", got)
+	}
+
+	// a stale context only replaces what it saw
+	s.PutSibling("k", []byte("d"), c1, "n2")
+	if sibs, _ = s.Siblings("k"); len(sibs) != 2 {
+		t.Fatalf("write with a stale context left %d siblings, want 2", len(sibs))
+	}
+	// so does a blind write through the same actor
+	s.PutSibling("k", []byte("e"), nil, "n1")
+	if sibs, _ = s.Siblings("k"); len(sibs) != 3 {
+		t.Fatalf("blind write through the same actor left %d siblings, want 3", len(sibs))
+	}
+	if left, _ := s.DeleteSiblings("k", c3); left != 2 {
+		t.Fatalf("DeleteSiblings left %d, want the concurrent one", left)
+	}
+	sibs, _ = s.Siblings("k")
+	if left, _ := s.DeleteSiblings("k", vclock.Merge(sibs[0].Clock, sibs[1].Clock)); left != 0 || s.Len() != 0 {
+		t.Fatalf("deleting the last sibling left %d, store len %d", left, s.Len())
+	}
+}
+
+func TestLocks(t *testing.T) {
+	s := NewStore(1 << 20)
+	a, err := s.Acquire("job", "a", time.Minute)
+	if err != nil || a.Holder != "a" || a.Fence == 0 {
+		t.Fatalf("Acquire = %+v, %v", a, err)
+	}
+	if again, err := s.Acquire("job", "a", time.Minute); err != nil || again.Fence != a.Fence {
+		t.Fatalf("re-Acquire by the holder = %+v, %v; want the same fence", again, err)
+	}
+	if got, err := s.Acquire("job", "b", time.Minute); !errors.Is(err, ErrLocked) || got.Holder != "" || got.Fence != a.Fence {
+		t.Fatalf("Acquire of a held lock = %+v, %v; want ErrLocked without the holder", got, err)
+	}
+	if _, err := s.Renew("job", "b", time.Minute); !errors.Is(err, ErrNotHeld) {
+		t.Fatalf("Renew by another holder err = %v, want ErrNotHeld", err)
+	}
+	if err := s.Release("job", "b"); !errors.Is(err, ErrNotHeld) {
+		t.Fatalf("Release by another holder err = %v, want ErrNotHeld", err)
+	}
+	if err := s.Release("job", "a"); err != nil {
+		t.Fatalf("Release = %v", err)
+	}
+
+	b, _ := s.Acquire("job", "b", time.Minute)
+	if b.Fence <= a.Fence {
+		t.Fatalf("fence went from %v to %v", a.Fence, b.Fence)
+	}
+	s.ExpireAt("job", time.Now().Add(-time.Second))
+	if _, err := s.Renew("job", "b", time.Minute); !errors.Is(err, ErrNotHeld) {
+		t.Fatalf("Renew of an expired lock err = %v, want ErrNotHeld", err)
+	}
+	if c, err := s.Acquire("job", "c", time.Minute); err != nil || c.Fence <= b.Fence {
+		t.Fatalf("Acquire after expiry = %+v, %v", c, err)
+	}
+	if _, err := s.Acquire("other", "a", 0); !errors.Is(err, ErrLockTTL) {
+		t.Fatalf("Acquire without a ttl err = %v, want ErrLockTTL", err)
+	}
+	if _, err := s.Renew("job", "c", -time.Second); !errors.Is(err, ErrLockTTL) {
+		t.Fatalf("Renew with a negative ttl err = %v, want ErrLockTTL", err)
+	}
+}
+
+func TestAcquireClearsTombstone(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.Put("job", []byte("v"), 0)
+	s.Delete("job")
+	if _, ok := s.Version("job"); !ok {
+		t.Fatal("Delete left no tombstone")
+	}
+	l, err := s.Acquire("job", "a", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := s.Version("job"); v != l.Fence {
+		t.Fatalf("Version = %v, want the lock's fence %v over the tombstone", v, l.Fence)
+	}
+	s.Release("job", "a")
+	if st := s.Stats(); st.UsedBytes != 0 {
+		t.Fatalf("UsedBytes after release = %d, want the tombstone's room freed", st.UsedBytes)
+	}
+}
+
+func TestAllow(t *testing.T) {
+	s := NewStore(1 << 20)
+	for _, algo := range []RateAlgorithm{TokenBucket, SlidingWindow} {
+		rl := RateLimit{Algorithm: algo, Limit: 3, Window: time.Hour}
+		key := string(algo)
+		for i := range 3 {
+			if res, err := s.Allow(key, rl, 1); err != nil || !res.Allowed || res.Remaining != 2-i {
+				t.Fatalf("%s: request %d = %+v, %v", algo, i, res, err)
+			}
+		}
+		res, _ := s.Allow(key, rl, 1)
+		if res.Allowed || res.Remaining != 0 || res.RetryAfter <= 0 || res.RetryAfter > time.Hour || res.Reset < res.RetryAfter {
+			t.Fatalf("%s: request over the limit = %+v", algo, res)
+		}
+		if info, _ := s.TTL(key); info.ExpireAt.IsZero() || info.ExpireAt.After(time.Now().Add(2*time.Hour)) {
+			t.Fatalf("%s: expiry = %v", algo, info.ExpireAt)
+		}
+	}
+
+	// a token bucket refills continuously
+	rl := RateLimit{Algorithm: TokenBucket, Limit: 100, Window: 100 * time.Millisecond}
+	if res, _ := s.Allow("fast", rl, 100); !res.Allowed || res.Remaining != 0 {
+		t.Fatalf("burst = %+v", res)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if res, _ := s.Allow("fast", rl, 10); !res.Allowed {
+		t.Fatalf("request after refill = %+v", res)
+	}
+
+	if _, err := s.Allow("fast", RateLimit{Algorithm: "leaky", Limit: 1, Window: time.Second}, 1); !errors.Is(err, ErrInvalidRateLimit) {
+		t.Fatalf("unknown algorithm err = %v", err)
+	}
+	s.Put("str", []byte("v"), 0)
+	if _, err := s.Allow("str", rl, 1); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("Allow on a string err = %v, want ErrWrongType", err)
+	}
+}
@@ -2,99 +2,716 @@ package kv
 
 import (
 	"container/list"
+	"errors"
+	"path"
+	"slices"
+	"strings"
 	"sync"
 	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
 )
 
+// RevalidateWindow is how long a stale entry waits for the caller that was
+// asked to refresh it before another reader is asked instead.
+const RevalidateWindow = 5 * time.Second
+
 type entry struct {
 	key      string
 	value    []byte
-	expireAt time.Time
+	expireAt time.Time // hard TTL: the entry is gone after this
+	staleAt  time.Time // soft TTL: the entry is served flagged stale after this
+	// revalidateAt is when the current refresh of a stale entry was handed out
+	revalidateAt time.Time
+	ttl          time.Duration // TTL the entry was written with, reapplied by Touch
+	sliding      bool          // reads push expireAt out by ttl
+	tags         []string
+	meta         *Meta // nil when the writer supplied no metadata
+	codec        Codec // codec value is compressed with
+	// chunks holds values written by PutStream that span several chunks, in
+	// place of value. Like value, they are never modified once stored.
+	chunks [][]byte
+	coll   collection // set instead of value for hashes, lists, sets and sorted sets
+	// version is the hybrid logical clock timestamp of the last write, which
+	// decides between versions of the key written on different nodes
+	version hlc.Timestamp
+}
+
+// Meta is the small set of attributes stored alongside a value and replayed
+// to readers.
+type Meta struct {
+	ContentType     string
+	ContentEncoding string
+	Flags           uint32 // opaque to the store, for the client's own use
+}
+
+// size is the number of bytes m counts against the store's capacity.
+func (m *Meta) size() int {
+	if m == nil {
+		return 0
+	}
+	return len(m.ContentType) + len(m.ContentEncoding) + 4
+}
+
+// PutOptions controls how a value is written by PutWithOptions.
+type PutOptions struct {
+	TTL      time.Duration // zero means the entry never expires
+	ExpireAt time.Time     // absolute expiry, takes precedence over TTL
+	SoftTTL  time.Duration // zero means the entry never goes stale
+	Sliding  bool          // every read resets the expiry to now+TTL
+	Tags     []string      // tags that InvalidateTag can later remove the entry by
+	Meta     Meta          // replayed to readers in Item.Meta
+	// Version is the write's hybrid logical clock timestamp; zero stamps it
+	// from the store's clock.
+	Version hlc.Timestamp
+}
+
+// TTLInfo describes when an entry expires.
+type TTLInfo struct {
+	ExpireAt time.Time     // zero if the entry never expires
+	TTL      time.Duration // TTL reapplied by Touch and sliding reads
+	Sliding  bool
+}
+
+// Remaining returns the time left until expiry, or -1 if the entry never expires.
+func (t TTLInfo) Remaining(now time.Time) time.Duration {
+	if t.ExpireAt.IsZero() {
+		return -1
+	}
+	return max(t.ExpireAt.Sub(now), 0)
+}
+
+// Item is a value read by GetItem together with its freshness.
+type Item struct {
+	// Value is nil for values stored in chunks; Bytes and WriteTo read any
+	// value.
+	Value  []byte
+	chunks [][]byte
+	Meta   Meta
+	// Encoding is the codec Value is still compressed with; it is only set
+	// by GetItemEncoded.
+	Encoding Codec
+	// Kind is the type of value the key holds. Value is empty for anything
+	// but KindString.
+	Kind Kind
+	TTLInfo
+	StaleAt time.Time
+	// Stale is set once the soft TTL has passed but the hard TTL has not.
+	Stale bool
+	// Revalidate is set for the one stale reader that should refresh the value;
+	// other readers keep getting the stale value until it is rewritten.
+	Revalidate bool
+	// Version is the hybrid logical clock timestamp of the last write.
+	Version hlc.Timestamp
+}
+
+// Policy selects which entries a Store evicts once it is over capacity.
+type Policy string
+
+const (
+	// PolicyLRU evicts the least recently read or written entry.
+	PolicyLRU Policy = "lru"
+	// PolicyFIFO evicts the oldest inserted entry regardless of reads.
+	PolicyFIFO Policy = "fifo"
+	// PolicyNoEviction never evicts and rejects writes with ErrFull instead.
+	PolicyNoEviction Policy = "noeviction"
+)
+
+// ErrFull is returned by writes to a PolicyNoEviction store that would exceed
+// its capacity.
+var ErrFull = errors.New("kv: store is full")
+
+// Config describes a Store's capacity and defaults.
+type Config struct {
+	CapacityBytes int
+	Eviction      Policy        // empty means PolicyLRU
+	DefaultTTL    time.Duration // applied to writes that carry no TTL
+	// Compression is the codec values of at least CompressMinBytes are stored
+	// in. Values that do not shrink are stored as-is.
+	Compression      Codec
+	CompressMinBytes int
+	// TombstoneGC is how long deleted keys are remembered, so that older
+	// versions arriving late cannot bring them back. Zero means
+	// DefaultTombstoneGC.
+	TombstoneGC time.Duration
+}
+
+// Stats is a point-in-time view of a Store's usage.
+type Stats struct {
+	Items         int
+	UsedBytes     int
+	CapacityBytes int
+	Evictions     uint64
 }
 
 // Store is a minimal in-memory KV with TTL and LRU eviction by bytes capacity.
 type Store struct {
-	mu   sync.RWMutex
-	data map[string]*list.Element
-	ll   *list.List
-	used int
-	cap  int
+	mu        sync.RWMutex
+	data      map[string]*list.Element
+	ll        *list.List
+	used      int
+	cap       int
+	policy    Policy
+	defTTL    time.Duration
+	codec     Codec
+	minComp   int
+	evictions uint64
+	// tags indexes keys by tag: tag -> set of keys carrying it
+	tags     map[string]map[string]struct{}
+	observer func(Mutation)
+	clock    *hlc.Clock
+	tombs    tombstones
+	tombGC   time.Duration
 }
 
 func NewStore(capacityBytes int) *Store {
-	return &Store{
-		data: make(map[string]*list.Element),
-		ll:   list.New(),
-		cap:  capacityBytes,
+	return NewStoreWithConfig(Config{CapacityBytes: capacityBytes})
+}
+
+func NewStoreWithConfig(cfg Config) *Store {
+	s := &Store{
+		data:  make(map[string]*list.Element),
+		ll:    list.New(),
+		tags:  make(map[string]map[string]struct{}),
+		clock: hlc.NewClock(),
+		tombs: tombstones{byKey: make(map[string]*tombstone)},
 	}
+	s.applyConfig(cfg)
+	return s
 }
 
-func (s *Store) Put(key string, val []byte, ttl time.Duration) {
+// Reconfigure changes the capacity, eviction policy and default TTL of a live
+// store, evicting entries if the new capacity is smaller than what is in use.
+func (s *Store) Reconfigure(cfg Config) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
+	s.applyConfig(cfg)
+	s.evictIfNeeded()
+}
 
-	var exp time.Time
-	if ttl > 0 {
-		exp = time.Now().Add(ttl)
+// Config returns the store's current configuration.
+func (s *Store) Config() Config {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Config{
+		CapacityBytes:    s.cap,
+		Eviction:         s.policy,
+		DefaultTTL:       s.defTTL,
+		Compression:      s.codec,
+		CompressMinBytes: s.minComp,
+		TombstoneGC:      s.tombGC,
+	}
+}
+
+func (s *Store) applyConfig(cfg Config) {
+	s.cap = cfg.CapacityBytes
+	s.policy = cfg.Eviction
+	if s.policy == "" {
+		s.policy = PolicyLRU
+	}
+	s.defTTL = cfg.DefaultTTL
+	s.codec = cfg.Compression
+	s.minComp = cfg.CompressMinBytes
+	s.tombGC = cfg.TombstoneGC
+	if s.tombGC <= 0 {
+		s.tombGC = DefaultTombstoneGC
+	}
+}
+
+func (s *Store) Put(key string, val []byte, ttl time.Duration) error {
+	return s.PutWithOptions(key, val, PutOptions{TTL: ttl})
+}
+
+// PutWithOptions stores val under key, replacing any previous value and tags.
+func (s *Store) PutWithOptions(key string, val []byte, opts PutOptions) error {
+	stored, codec := s.encode(val, opts.Meta)
+	return s.put(&entry{key: key, value: stored, codec: codec}, opts, val)
+}
+
+// put stores e, whose value is already set, with the rest of opts applied.
+// raw is the value as written, handed to the observer if e is compressed.
+func (s *Store) put(e *entry, opts PutOptions, raw []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.putLocked(e, opts, raw)
+}
+
+// putLocked is put for callers holding s.mu.
+func (s *Store) putLocked(e *entry, opts PutOptions, raw []byte) error {
+	s.prepare(e, opts, time.Now())
+	if s.policy == PolicyNoEviction {
+		grow := e.size()
+		if el, ok := s.data[e.key]; ok {
+			grow -= el.Value.(*entry).size()
+		}
+		if !s.fits(grow) {
+			return ErrFull
+		}
 	}
+	s.insert(e, raw)
+	s.evictIfNeeded()
+	return nil
+}
+
+// prepare applies the expiry, tags, metadata and version of opts to e.
+func (s *Store) prepare(e *entry, opts PutOptions, now time.Time) {
+	e.version = opts.Version
+	if e.version == 0 {
+		e.version = s.clock.Now()
+	}
+	e.ttl = opts.TTL
+	e.sliding = opts.Sliding
+	e.tags = dedupTags(opts.Tags)
+	if opts.Meta != (Meta{}) {
+		meta := opts.Meta
+		e.meta = &meta
+	}
+	switch {
+	case !opts.ExpireAt.IsZero():
+		e.expireAt = opts.ExpireAt
+		e.ttl = opts.ExpireAt.Sub(now)
+	case e.ttl <= 0 && s.defTTL > 0:
+		e.ttl = s.defTTL
+		fallthrough
+	case e.ttl > 0:
+		e.expireAt = now.Add(e.ttl)
+	}
+	if e.ttl <= 0 {
+		e.sliding = false
+	}
+	if opts.SoftTTL > 0 {
+		e.staleAt = now.Add(opts.SoftTTL)
+	}
+}
 
-	if el, ok := s.data[key]; ok {
+// insert stores e, replacing any entry under the same key, without checking
+// capacity. raw is the value as written, handed to the observer if e is
+// compressed.
+func (s *Store) insert(e *entry, raw []byte) {
+	if el, ok := s.data[e.key]; ok {
 		old := el.Value.(*entry)
-		s.used -= len(old.value)
-		old.value = append([]byte(nil), val...)
-		old.expireAt = exp
-		s.used += len(old.value)
-		s.ll.MoveToFront(el)
+		s.used -= old.size()
+		s.untag(old)
+		el.Value = e
+		s.touch(el)
 	} else {
-		e := &entry{key: key, value: append([]byte(nil), val...), expireAt: exp}
-		el := s.ll.PushFront(e)
-		s.data[key] = el
-		s.used += len(e.value)
+		s.data[e.key] = s.ll.PushFront(e)
 	}
-	s.evictIfNeeded()
+	s.tag(e)
+	s.used += e.size()
+	s.unbury(e.key)
+	if s.observer != nil {
+		// observers always see the value as written; chunks are passed on
+		// as they are and joined only by observers that need the bytes
+		val := e.value
+		switch {
+		case e.chunks != nil:
+			val = nil
+		case e.codec != CodecNone:
+			val = append([]byte(nil), raw...)
+		}
+		s.emit(Mutation{Op: OpPut, Key: e.key, Value: val, Meta: e.metadata(), ExpireAt: e.expireAt, Version: e.version, chunks: e.chunks})
+	}
+}
+
+// encode returns the copy of val to store and the codec it is compressed
+// with. Values the writer already encoded are never compressed again. Only
+// the settings are read under the lock; compressing does not hold up other
+// callers.
+func (s *Store) encode(val []byte, meta Meta) ([]byte, Codec) {
+	s.mu.RLock()
+	codec, minComp := s.codec, s.minComp
+	s.mu.RUnlock()
+	return encodeWith(codec, minComp, val, meta)
+}
+
+// encodeWith is encode with the store's compression settings given.
+func encodeWith(codec Codec, minComp int, val []byte, meta Meta) ([]byte, Codec) {
+	if codec != CodecNone && len(val) >= minComp && meta.ContentEncoding == "" {
+		if out, err := codec.compress(val); err == nil && len(out) < len(val) {
+			return out, codec
+		}
+	}
+	return append([]byte(nil), val...), CodecNone
 }
 
 func (s *Store) Get(key string) ([]byte, bool) {
+	it, ok := s.GetItem(key)
+	return it.Bytes(), ok
+}
+
+// GetItem returns the value for key along with its TTLs and, for entries past
+// their soft TTL, whether this caller should revalidate it.
+func (s *Store) GetItem(key string) (Item, bool) {
+	return s.GetItemEncoded(key)
+}
+
+// GetItemEncoded is GetItem for callers that can take a compressed value: if
+// the entry is stored with one of the accepted codecs its bytes are returned
+// as-is with Item.Encoding set, otherwise they are decompressed.
+func (s *Store) GetItemEncoded(key string, accepted ...Codec) (Item, bool) {
+	it, codec, ok := s.getItem(key)
+	if !ok {
+		return Item{}, false
+	}
+	if codec == CodecNone || slices.Contains(accepted, codec) {
+		it.Encoding = codec
+		return it, true
+	}
+	val, err := codec.decompress(it.Value)
+	if err != nil {
+		return Item{}, false
+	}
+	it.Value = val
+	return it, true
+}
+
+// getItem reads key without decompressing it, so that the work happens
+// outside the store lock.
+func (s *Store) getItem(key string) (Item, Codec, bool) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
-	if el, ok := s.data[key]; ok {
-		e := el.Value.(*entry)
-		if !e.expireAt.IsZero() && time.Now().After(e.expireAt) {
-			s.removeElement(el)
-			return nil, false
+	el, ok := s.live(key)
+	if !ok {
+		return Item{}, CodecNone, false
+	}
+	e := el.Value.(*entry)
+	now := time.Now()
+	s.touch(el)
+	if e.sliding {
+		e.expireAt = now.Add(e.ttl)
+	}
+
+	it := e.item(now)
+	if it.Stale && (e.revalidateAt.IsZero() || now.Sub(e.revalidateAt) > RevalidateWindow) {
+		e.revalidateAt = now
+		it.Revalidate = true
+	}
+	return it, e.codec, true
+}
+
+// Peek is GetItem without counting as a read: the key's recency, sliding
+// TTL and revalidation are left alone.
+func (s *Store) Peek(key string) (Item, bool) {
+	s.mu.RLock()
+	el, ok := s.data[key]
+	if !ok || el.Value.(*entry).expired(time.Now()) {
+		s.mu.RUnlock()
+		return Item{}, false
+	}
+	e := el.Value.(*entry)
+	it, codec := e.item(time.Now()), e.codec
+	s.mu.RUnlock()
+	if codec != CodecNone {
+		val, err := codec.decompress(it.Value)
+		if err != nil {
+			return Item{}, false
+		}
+		it.Value = val
+	}
+	return it, true
+}
+
+// Keys returns the keys of the store's live entries, in no particular order.
+func (s *Store) Keys() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	keys := make([]string, 0, len(s.data))
+	for key, el := range s.data {
+		if !el.Value.(*entry).expired(now) {
+			keys = append(keys, key)
 		}
-		s.ll.MoveToFront(el)
-		return append([]byte(nil), e.value...), true
 	}
-	return nil, false
+	return keys
+}
+
+// TTL reports when key expires without counting as a read.
+func (s *Store) TTL(key string) (TTLInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	el, ok := s.data[key]
+	if !ok || el.Value.(*entry).expired(time.Now()) {
+		return TTLInfo{}, false
+	}
+	return el.Value.(*entry).ttlInfo(), true
+}
+
+// Touch resets key's expiry to now+ttl without rewriting its value. A zero ttl
+// reapplies the TTL the key was written with. It reports whether key exists.
+func (s *Store) Touch(key string, ttl time.Duration) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.live(key)
+	if !ok {
+		return false
+	}
+	e := el.Value.(*entry)
+	if ttl > 0 {
+		e.ttl = ttl
+	}
+	if e.ttl > 0 {
+		e.expireAt = time.Now().Add(e.ttl)
+	}
+	s.emit(Mutation{Op: OpTouch, Key: key, ExpireAt: e.expireAt})
+	return true
+}
+
+// ExpireAt sets an absolute expiry for key without rewriting its value. A zero
+// time removes the expiry. It reports whether key exists.
+func (s *Store) ExpireAt(key string, at time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.live(key)
+	if !ok {
+		return false
+	}
+	e := el.Value.(*entry)
+	e.expireAt = at
+	e.ttl = 0
+	if !at.IsZero() {
+		e.ttl = time.Until(at)
+	}
+	e.sliding = e.sliding && e.ttl > 0
+	s.emit(Mutation{Op: OpTouch, Key: key, ExpireAt: e.expireAt})
+	return true
 }
 
 func (s *Store) Delete(key string) bool {
 	s.mu.Lock()
 	defer s.mu.Unlock()
-	if el, ok := s.data[key]; ok {
-		s.removeElement(el)
+	if el, ok := s.live(key); ok {
+		s.removeElement(el, OpDelete)
 		return true
 	}
 	return false
 }
 
+// DeletePrefix removes every key that starts with prefix and returns how many
+// keys were removed.
+func (s *Store) DeletePrefix(prefix string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for key, el := range s.data {
+		if strings.HasPrefix(key, prefix) && s.drop(el, now) {
+			n++
+		}
+	}
+	return n
+}
+
+// DeleteMatch removes every key matching the glob pattern and returns how many
+// keys were removed. Patterns use path.Match syntax, so '*' does not cross '/'.
+func (s *Store) DeleteMatch(pattern string) (int, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for key, el := range s.data {
+		if ok, _ := path.Match(pattern, key); ok && s.drop(el, now) {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// InvalidateTag removes every key carrying tag and returns how many live keys
+// were removed. Keys that had already expired are dropped but not counted.
+func (s *Store) InvalidateTag(tag string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	n := 0
+	for key := range s.tags[tag] {
+		if s.drop(s.data[key], now) {
+			n++
+		}
+	}
+	return n
+}
+
+// Tags returns the tags attached to key.
+func (s *Store) Tags(key string) ([]string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	el, ok := s.data[key]
+	if !ok || el.Value.(*entry).expired(time.Now()) {
+		return nil, false
+	}
+	return append([]string(nil), el.Value.(*entry).tags...), true
+}
+
 func (s *Store) Len() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 	return len(s.data)
 }
 
+// Stats returns the store's current usage.
+func (s *Store) Stats() Stats {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return Stats{
+		Items:         len(s.data),
+		UsedBytes:     s.used,
+		CapacityBytes: s.cap,
+		Evictions:     s.evictions,
+	}
+}
+
+// fits reports whether grow more bytes fit within the store's capacity,
+// shedding the oldest tombstones to make room if needed. s.mu must be held.
+func (s *Store) fits(grow int) bool {
+	for s.used+grow > s.cap && s.shedTombstone() {
+	}
+	return s.used+grow <= s.cap
+}
+
+// touch records an access to el. Only LRU stores track recency; FIFO stores
+// keep insertion order.
+func (s *Store) touch(el *list.Element) {
+	if s.policy == PolicyLRU {
+		s.ll.MoveToFront(el)
+	}
+}
+
 func (s *Store) evictIfNeeded() {
+	// tombstones give way before any value does
+	for s.used > s.cap && s.shedTombstone() {
+	}
+	if s.policy == PolicyNoEviction {
+		return
+	}
 	for s.used > s.cap && s.ll.Back() != nil {
-		s.removeElement(s.ll.Back())
+		s.removeElement(s.ll.Back(), OpEvict)
+		s.evictions++
 	}
 }
 
-func (s *Store) removeElement(el *list.Element) {
+// removeElement unlinks el from the store and reports the removal to the
+// observer as op. Deletes leave a tombstone.
+func (s *Store) removeElement(el *list.Element, op Op) {
+	s.removeElementAt(el, op, 0)
+}
+
+// removeElementAt is removeElement for a delete with version v, or one
+// stamped from the store's clock if v is zero.
+func (s *Store) removeElementAt(el *list.Element, op Op, v hlc.Timestamp) {
 	e := el.Value.(*entry)
 	delete(s.data, e.key)
-	s.used -= len(e.value)
+	s.untag(e)
+	s.used -= e.size()
 	s.ll.Remove(el)
+	if op == OpDelete {
+		if v == 0 {
+			v = s.clock.Now()
+		}
+		s.bury(e.key, v)
+	}
+	s.emit(Mutation{Op: op, Key: e.key, Version: v})
+}
+
+// drop removes el as a delete, or as an expiry if it had already expired. It
+// reports whether a live entry was deleted.
+func (s *Store) drop(el *list.Element, now time.Time) bool {
+	if el.Value.(*entry).expired(now) {
+		s.removeElement(el, OpExpire)
+		return false
+	}
+	s.removeElement(el, OpDelete)
+	return true
+}
+
+func (s *Store) tag(e *entry) {
+	for _, t := range e.tags {
+		keys, ok := s.tags[t]
+		if !ok {
+			keys = make(map[string]struct{})
+			s.tags[t] = keys
+		}
+		keys[e.key] = struct{}{}
+	}
+}
+
+func (s *Store) untag(e *entry) {
+	for _, t := range e.tags {
+		delete(s.tags[t], e.key)
+		if len(s.tags[t]) == 0 {
+			delete(s.tags, t)
+		}
+	}
+}
+
+// live returns key's element, dropping it first if it has expired.
+func (s *Store) live(key string) (*list.Element, bool) {
+	el, ok := s.data[key]
+	if !ok {
+		return nil, false
+	}
+	if el.Value.(*entry).expired(time.Now()) {
+		s.removeElement(el, OpExpire)
+		return nil, false
+	}
+	return el, true
+}
+
+// size is the number of bytes an entry counts against the store's capacity.
+func (e *entry) size() int {
+	n := len(e.value) + e.meta.size()
+	for _, c := range e.chunks {
+		n += len(c)
+	}
+	if e.coll != nil {
+		n += e.coll.size()
+	}
+	return n
+}
+
+func (e *entry) metadata() Meta {
+	if e.meta == nil {
+		return Meta{}
+	}
+	return *e.meta
+}
+
+// item copies the entry out for a reader; the value stays encoded.
+func (e *entry) item(now time.Time) Item {
+	return Item{
+		Value:   append([]byte(nil), e.value...),
+		chunks:  e.chunks,
+		Kind:    e.kind(),
+		Meta:    e.metadata(),
+		TTLInfo: e.ttlInfo(),
+		StaleAt: e.staleAt,
+		Stale:   !e.staleAt.IsZero() && now.After(e.staleAt),
+		Version: e.version,
+	}
+}
+
+func (e *entry) ttlInfo() TTLInfo {
+	return TTLInfo{ExpireAt: e.expireAt, TTL: e.ttl, Sliding: e.sliding}
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && now.After(e.expireAt)
+}
+
+// dedupTags returns a copy of tags without empty or repeated values.
+func dedupTags(tags []string) []string {
+	if len(tags) == 0 {
+		return nil
+	}
+	out := make([]string, 0, len(tags))
+	for _, t := range tags {
+		if t != "" && !slices.Contains(out, t) {
+			out = append(out, t)
+		}
+	}
+	return out
 }
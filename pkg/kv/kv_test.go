@@ -2,11 +2,17 @@ package kv
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
+	"io"
+	"slices"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
 )
 
 func TestPutGetDelete_NoTTL(t *testing.T) {
@@ -176,6 +182,39 @@ func TestLRU_GetUpdatesRecency(t *testing.T) {
 	}
 }
 
+func TestPeekAndKeysDoNotCountAsReads(t *testing.T) {
+	s := NewStore(100)
+	a := bytes.Repeat([]byte("a"), 40)
+	s.Put("a", a, 0)
+	s.Put("b", bytes.Repeat([]byte("b"), 40), 0)
+	s.Put("gone", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+
+	keys := s.Keys()
+	slices.Sort(keys)
+	if !slices.Equal(keys, []string{"a", "b"}) {
+		t.Fatalf("Keys = %q, want [a b]", keys)
+	}
+	if it, ok := s.Peek("a"); !ok || !bytes.Equal(it.Value, a) || it.Kind != KindString {
+		t.Fatalf("Peek = %q %v, %v", it.Value, it.Kind, ok)
+	}
+	if _, ok := s.Peek("gone"); ok {
+		t.Fatalf("Peek returned an expired key")
+	}
+
+	// a was peeked, not read, so it is still the LRU victim
+	s.Put("c", bytes.Repeat([]byte("c"), 90), 0)
+	if _, ok := s.Get("a"); ok {
+		t.Fatalf("Peek updated recency")
+	}
+
+	z := NewStoreWithConfig(Config{CapacityBytes: 1 << 20, Compression: CodecGzip, CompressMinBytes: 1})
+	z.Put("a", a, 0)
+	if it, ok := z.Peek("a"); !ok || !bytes.Equal(it.Value, a) {
+		t.Fatalf("Peek of a compressed value = %q, %v", it.Value, ok)
+	}
+}
+
 func TestOverwrite_SizeAndLen(t *testing.T) {
 	s := NewStore(200)
 
@@ -229,3 +268,603 @@ func TestTTL_Expires(t *testing.T) {
 		t.Fatalf("noTTL key unexpectedly missing")
 	}
 }
+
+func TestDeletePrefix(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.Put("user:v3:1", []byte("a"), 0)
+	s.Put("user:v3:2", []byte("b"), 0)
+	s.Put("user:v4:1", []byte("c"), 0)
+
+	if got := s.DeletePrefix("user:v3:"); got != 2 {
+		t.Fatalf("DeletePrefix = %d, want 2", got)
+	}
+	if _, ok := s.Get("user:v3:1"); ok {
+		t.Fatalf("user:v3:1 still present after DeletePrefix")
+	}
+	if _, ok := s.Get("user:v4:1"); !ok {
+		t.Fatalf("user:v4:1 removed by unrelated prefix")
+	}
+}
+
+func TestDeleteMatch(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.Put("user:v3:1", []byte("a"), 0)
+	s.Put("user:v3:2", []byte("b"), 0)
+	s.Put("order:v3:1", []byte("c"), 0)
+
+	got, err := s.DeleteMatch("*:v3:1")
+	if err != nil {
+		t.Fatalf("DeleteMatch error: %v", err)
+	}
+	if got != 2 {
+		t.Fatalf("DeleteMatch = %d, want 2", got)
+	}
+	if s.Len() != 1 {
+		t.Fatalf("Len = %d, want 1", s.Len())
+	}
+
+	if _, err := s.DeleteMatch("[bad"); err == nil {
+		t.Fatalf("expected error for malformed pattern")
+	}
+}
+
+func TestInvalidateTag(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.PutWithOptions("p1", []byte("a"), PutOptions{Tags: []string{"product:42", "catalog"}})
+	s.PutWithOptions("p2", []byte("b"), PutOptions{Tags: []string{"product:42"}})
+	s.PutWithOptions("p3", []byte("c"), PutOptions{Tags: []string{"catalog"}})
+
+	if got := s.InvalidateTag("product:42"); got != 2 {
+		t.Fatalf("InvalidateTag(product:42) = %d, want 2", got)
+	}
+	if _, ok := s.Get("p1"); ok {
+		t.Fatalf("p1 still present after tag invalidation")
+	}
+	if got := s.InvalidateTag("catalog"); got != 1 {
+		t.Fatalf("InvalidateTag(catalog) = %d, want 1 (p1 already gone)", got)
+	}
+	if s.Len() != 0 {
+		t.Fatalf("Len = %d, want 0", s.Len())
+	}
+}
+
+func TestTagIndexMaintained(t *testing.T) {
+	s := NewStore(10)
+
+	// overwrite replaces tags
+	s.PutWithOptions("k", []byte("1"), PutOptions{Tags: []string{"old"}})
+	s.PutWithOptions("k", []byte("2"), PutOptions{Tags: []string{"new"}})
+	if got := s.InvalidateTag("old"); got != 0 {
+		t.Fatalf("overwritten tag still indexed: removed %d", got)
+	}
+
+	// delete drops the key from the index
+	s.Delete("k")
+	if len(s.tags) != 0 {
+		t.Fatalf("tag index not cleaned on delete: %v", s.tags)
+	}
+
+	// eviction drops the key from the index
+	s.PutWithOptions("a", []byte("123456"), PutOptions{Tags: []string{"t"}})
+	s.PutWithOptions("b", []byte("123456"), PutOptions{Tags: []string{"t"}})
+	if _, ok := s.tags["t"]["a"]; ok {
+		t.Fatalf("evicted key still indexed")
+	}
+
+	// expiry drops the key from the index once observed
+	s.PutWithOptions("e", []byte("v"), PutOptions{TTL: 20 * time.Millisecond, Tags: []string{"x"}})
+	time.Sleep(40 * time.Millisecond)
+	if _, ok := s.Get("e"); ok {
+		t.Fatalf("expected e to expire")
+	}
+	if _, ok := s.tags["x"]; ok {
+		t.Fatalf("expired key still indexed")
+	}
+}
+
+func TestEviction_FIFOIgnoresReads(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 9, Eviction: PolicyFIFO})
+
+	s.Put("a", []byte("1234"), 0)
+	s.Put("b", []byte("56"), 0)
+	if _, ok := s.Get("a"); !ok { // a read must not protect "a" under FIFO
+		t.Fatalf("precondition: a missing")
+	}
+	s.Put("c", []byte("7890"), 0)
+
+	if _, ok := s.Get("a"); ok {
+		t.Fatalf("expected a (oldest insert) to be evicted")
+	}
+	if _, ok := s.Get("b"); !ok {
+		t.Fatalf("expected b to remain")
+	}
+	if got := s.Stats().Evictions; got != 1 {
+		t.Fatalf("Evictions = %d, want 1", got)
+	}
+}
+
+func TestNoEvictionRejectsWrites(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 8, Eviction: PolicyNoEviction})
+
+	if err := s.Put("a", []byte("1234"), 0); err != nil {
+		t.Fatalf("Put(a) = %v", err)
+	}
+	if err := s.Put("b", []byte("56789"), 0); !errors.Is(err, ErrFull) {
+		t.Fatalf("Put(b) = %v, want ErrFull", err)
+	}
+	// shrinking an existing key still fits
+	if err := s.Put("a", []byte("12"), 0); err != nil {
+		t.Fatalf("overwrite a = %v", err)
+	}
+	if st := s.Stats(); st.Items != 1 || st.UsedBytes != 2 || st.Evictions != 0 {
+		t.Fatalf("Stats = %+v", st)
+	}
+}
+
+func TestDefaultTTLAndReconfigure(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 100, DefaultTTL: 30 * time.Millisecond})
+
+	s.Put("d", []byte("v"), 0)
+	s.Put("long", []byte("v"), time.Hour)
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := s.Get("d"); ok {
+		t.Fatalf("expected default TTL to apply")
+	}
+	if _, ok := s.Get("long"); !ok {
+		t.Fatalf("explicit TTL should override default")
+	}
+
+	s.Put("x", bytes.Repeat([]byte("x"), 50), 0)
+	s.Reconfigure(Config{CapacityBytes: 10})
+	if st := s.Stats(); st.UsedBytes > 10 || st.CapacityBytes != 10 {
+		t.Fatalf("Stats after shrink = %+v", st)
+	}
+}
+
+func TestSoftTTL_ServesStaleAndElectsOneRevalidator(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.PutWithOptions("k", []byte("v1"), PutOptions{SoftTTL: 20 * time.Millisecond, TTL: time.Hour})
+
+	it, ok := s.GetItem("k")
+	if !ok || it.Stale || it.Revalidate {
+		t.Fatalf("fresh read = %+v,%v want fresh", it, ok)
+	}
+
+	time.Sleep(40 * time.Millisecond)
+
+	first, ok := s.GetItem("k")
+	if !ok || !first.Stale || !first.Revalidate || string(first.Value) != "v1" {
+		t.Fatalf("first stale read = %+v,%v want stale value with revalidate", first, ok)
+	}
+	second, ok := s.GetItem("k")
+	if !ok || !second.Stale || second.Revalidate {
+		t.Fatalf("second stale read = %+v,%v want stale without revalidate", second, ok)
+	}
+
+	// the refresh makes the value fresh again
+	s.PutWithOptions("k", []byte("v2"), PutOptions{SoftTTL: time.Hour, TTL: 2 * time.Hour})
+	if it, _ := s.GetItem("k"); it.Stale || string(it.Value) != "v2" {
+		t.Fatalf("after refresh = %+v", it)
+	}
+}
+
+func TestSoftTTL_HardTTLStillExpires(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.PutWithOptions("k", []byte("v"), PutOptions{SoftTTL: 10 * time.Millisecond, TTL: 30 * time.Millisecond})
+	time.Sleep(60 * time.Millisecond)
+	if _, ok := s.GetItem("k"); ok {
+		t.Fatalf("expected hard TTL expiry")
+	}
+}
+
+func TestSlidingExpiration(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.PutWithOptions("k", []byte("v"), PutOptions{TTL: 60 * time.Millisecond, Sliding: true})
+
+	// keep reading within the TTL; each read pushes the expiry out
+	for range 4 {
+		time.Sleep(30 * time.Millisecond)
+		if _, ok := s.Get("k"); !ok {
+			t.Fatalf("sliding key expired despite reads")
+		}
+	}
+	time.Sleep(90 * time.Millisecond)
+	if _, ok := s.Get("k"); ok {
+		t.Fatalf("sliding key should expire once reads stop")
+	}
+}
+
+func TestTouchAndExpireAt(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.Put("k", []byte("v"), 50*time.Millisecond)
+
+	time.Sleep(30 * time.Millisecond)
+	if !s.Touch("k", 0) { // reapply the original 50ms
+		t.Fatalf("Touch(k) = false")
+	}
+	time.Sleep(30 * time.Millisecond)
+	if _, ok := s.Get("k"); !ok {
+		t.Fatalf("touched key expired early")
+	}
+
+	if !s.Touch("k", time.Hour) {
+		t.Fatalf("Touch(k, 1h) = false")
+	}
+	info, ok := s.TTL("k")
+	if !ok || info.TTL != time.Hour || info.Remaining(time.Now()) < 59*time.Minute {
+		t.Fatalf("TTL after touch = %+v,%v", info, ok)
+	}
+
+	at := time.Now().Add(2 * time.Hour).Truncate(time.Millisecond)
+	s.ExpireAt("k", at)
+	if info, _ := s.TTL("k"); !info.ExpireAt.Equal(at) {
+		t.Fatalf("ExpireAt = %v, want %v", info.ExpireAt, at)
+	}
+
+	s.ExpireAt("k", time.Time{})
+	if info, _ := s.TTL("k"); !info.ExpireAt.IsZero() || info.Remaining(time.Now()) != -1 {
+		t.Fatalf("persisted key still has expiry: %+v", info)
+	}
+
+	if s.Touch("missing", time.Second) {
+		t.Fatalf("Touch on missing key = true")
+	}
+}
+
+func TestObserverSeesMutations(t *testing.T) {
+	s := NewStore(8)
+	var got []Op
+	s.SetObserver(func(m Mutation) { got = append(got, m.Op) })
+
+	s.Put("a", []byte("1234"), 0)
+	s.Put("b", []byte("5678"), 0)
+	s.Put("c", []byte("9"), 0) // evicts a
+	s.Touch("b", time.Hour)
+	s.Delete("b")
+	s.Put("e", []byte("v"), 10*time.Millisecond)
+	time.Sleep(20 * time.Millisecond)
+	s.Get("e")
+
+	want := []Op{OpPut, OpPut, OpPut, OpEvict, OpTouch, OpDelete, OpPut, OpExpire}
+	if !slices.Equal(got, want) {
+		t.Fatalf("observed %v, want %v", got, want)
+	}
+}
+
+func TestMetaStoredAndCounted(t *testing.T) {
+	s := NewStore(1 << 20)
+	meta := Meta{ContentType: "application/json", ContentEncoding: "gzip", Flags: 7}
+	s.PutWithOptions("k", []byte("{}"), PutOptions{Meta: meta})
+
+	it, ok := s.GetItem("k")
+	if !ok || it.Meta != meta {
+		t.Fatalf("GetItem meta = %+v,%v want %+v", it.Meta, ok, meta)
+	}
+	if got, want := s.Stats().UsedBytes, 2+len("application/json")+len("gzip")+4; got != want {
+		t.Fatalf("UsedBytes = %d, want %d", got, want)
+	}
+
+	// overwriting without metadata clears it
+	s.Put("k", []byte("{}"), 0)
+	if it, _ := s.GetItem("k"); it.Meta != (Meta{}) {
+		t.Fatalf("meta after plain overwrite = %+v", it.Meta)
+	}
+	if got := s.Stats().UsedBytes; got != 2 {
+		t.Fatalf("UsedBytes after overwrite = %d, want 2", got)
+	}
+}
+
+func TestCompression(t *testing.T) {
+	val := bytes.Repeat([]byte("zephyr "), 200)
+	for _, codec := range []Codec{CodecGzip, CodecZstd, CodecSnappy} {
+		t.Run(string(codec), func(t *testing.T) {
+			s := NewStoreWithConfig(Config{CapacityBytes: 1 << 20, Compression: codec, CompressMinBytes: 64})
+			s.Put("big", val, 0)
+			s.Put("small", []byte("tiny"), 0)
+
+			if got, ok := s.Get("big"); !ok || !bytes.Equal(got, val) {
+				t.Fatalf("Get(big) did not round trip")
+			}
+			used := s.Stats().UsedBytes
+			if used >= len(val) {
+				t.Fatalf("UsedBytes = %d, want compressed size below %d", used, len(val))
+			}
+
+			it, ok := s.GetItemEncoded("big", codec)
+			if !ok || it.Encoding != codec || len(it.Value) != used-len("tiny") {
+				t.Fatalf("GetItemEncoded = %d bytes in %q, want %d in %q", len(it.Value), it.Encoding, used-len("tiny"), codec)
+			}
+			if it, _ := s.GetItemEncoded("small", codec); it.Encoding != CodecNone || string(it.Value) != "tiny" {
+				t.Fatalf("small value stored compressed: %+v", it)
+			}
+		})
+	}
+}
+
+func TestCompressionSkipsEncodedValues(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 1 << 20, Compression: CodecGzip})
+	var seen []byte
+	s.SetObserver(func(m Mutation) { seen = m.Value })
+
+	val := bytes.Repeat([]byte("a"), 1000)
+	s.PutWithOptions("k", val, PutOptions{Meta: Meta{ContentEncoding: "br"}})
+	if it, _ := s.GetItemEncoded("k", CodecGzip); it.Encoding != CodecNone || !bytes.Equal(it.Value, val) {
+		t.Fatalf("pre-encoded value was compressed again")
+	}
+
+	s.Put("k", val, 0)
+	if !bytes.Equal(seen, val) {
+		t.Fatalf("observer saw %d bytes, want the uncompressed value", len(seen))
+	}
+}
+
+func TestPutStreamChunksLargeValues(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 1 << 20, Compression: CodecGzip})
+	val := bytes.Repeat([]byte("0123456789"), ChunkSize/10*3+7)
+
+	if err := s.PutStream("big", bytes.NewReader(val), PutOptions{}); err != nil {
+		t.Fatalf("PutStream: %v", err)
+	}
+	if got := s.Stats().UsedBytes; got != len(val) {
+		t.Fatalf("UsedBytes = %d, want %d", got, len(val))
+	}
+	it, ok := s.GetItem("big")
+	if !ok || it.Value != nil || it.Len() != len(val) {
+		t.Fatalf("GetItem = %d bytes, Value %d bytes; want chunked %d", it.Len(), len(it.Value), len(val))
+	}
+	var buf bytes.Buffer
+	if _, err := it.WriteTo(&buf); err != nil || !bytes.Equal(buf.Bytes(), val) {
+		t.Fatalf("WriteTo did not round trip: %v", err)
+	}
+	if got, _ := s.Get("big"); !bytes.Equal(got, val) {
+		t.Fatalf("Get did not round trip")
+	}
+
+	// small streamed values take the regular path, compression included
+	small := bytes.Repeat([]byte("a"), 1000)
+	s.PutStream("small", bytes.NewReader(small), PutOptions{})
+	if it, _ := s.GetItemEncoded("small", CodecGzip); it.Encoding != CodecGzip {
+		t.Fatalf("small streamed value not compressed")
+	}
+
+	// a failed read leaves the previous value alone
+	boom := errors.New("boom")
+	r := io.MultiReader(bytes.NewReader(val), iotest.ErrReader(boom))
+	if err := s.PutStream("big", r, PutOptions{}); !errors.Is(err, boom) {
+		t.Fatalf("PutStream err = %v, want %v", err, boom)
+	}
+	if got, _ := s.Get("big"); !bytes.Equal(got, val) {
+		t.Fatalf("failed PutStream replaced the value")
+	}
+}
+
+func TestObserverSeesChunkedValuesLazily(t *testing.T) {
+	s := NewStore(1 << 20)
+	var seen Mutation
+	s.SetObserver(func(m Mutation) { seen = m })
+
+	val := bytes.Repeat([]byte("0123456789"), ChunkSize/10*2+3)
+	if err := s.PutStream("big", bytes.NewReader(val), PutOptions{}); err != nil {
+		t.Fatalf("PutStream: %v", err)
+	}
+	if seen.Value != nil || seen.Len() != len(val) {
+		t.Fatalf("mutation = Value %d bytes, Len %d; want the chunks of %d bytes unjoined", len(seen.Value), seen.Len(), len(val))
+	}
+	if !bytes.Equal(seen.Bytes(), val) {
+		t.Fatalf("Bytes did not round trip")
+	}
+}
+
+func TestTxnAllOrNothing(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.Put("{u}:a", []byte("1"), 0)
+
+	err := s.Txn([]TxnOp{
+		{Key: "{u}:a", Value: []byte("2"), Cond: CondEquals, Expect: []byte("1")},
+		{Key: "{u}:b", Value: []byte("x"), Cond: CondPresent},
+	})
+	var ce *ConditionError
+	if !errors.As(err, &ce) || ce.Index != 1 || ce.Key != "{u}:b" {
+		t.Fatalf("Txn err = %v, want condition failure on op 1", err)
+	}
+	if v, _ := s.Get("{u}:a"); string(v) != "1" {
+		t.Fatalf("failed Txn applied op 0: a = %q", v)
+	}
+
+	err = s.Txn([]TxnOp{
+		{Key: "{u}:a", Value: []byte("2"), Cond: CondEquals, Expect: []byte("1")},
+		{Key: "{u}:b", Value: []byte("x"), Cond: CondAbsent},
+		{Key: "{u}:a", Delete: true},
+	})
+	if err != nil {
+		t.Fatalf("Txn: %v", err)
+	}
+	if _, ok := s.Get("{u}:a"); ok {
+		t.Fatalf("ops not applied in order: a still present")
+	}
+	if v, _ := s.Get("{u}:b"); string(v) != "x" {
+		t.Fatalf("b = %q, want x", v)
+	}
+}
+
+func TestTxnNoEvictionChecksEndState(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 10, Eviction: PolicyNoEviction})
+	s.Put("a", []byte("12345678"), 0)
+
+	// fits only because a is deleted first
+	if err := s.Txn([]TxnOp{{Key: "a", Delete: true}, {Key: "b", Value: []byte("abcdefgh")}}); err != nil {
+		t.Fatalf("Txn: %v", err)
+	}
+	if err := s.Txn([]TxnOp{{Key: "c", Value: []byte("1")}, {Key: "d", Value: []byte("12345")}}); !errors.Is(err, ErrFull) {
+		t.Fatalf("Txn over capacity err = %v, want ErrFull", err)
+	}
+	if _, ok := s.Get("c"); ok {
+		t.Fatalf("rejected Txn stored c")
+	}
+}
+
+func TestModifyKeepsExpiryAndMeta(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 1 << 20, Compression: CodecGzip})
+	big := bytes.Repeat([]byte("a"), 1000)
+	s.PutWithOptions("k", big, PutOptions{TTL: time.Hour, Meta: Meta{ContentType: "text/plain"}, Tags: []string{"t"}})
+	before, _ := s.TTL("k")
+
+	ok, err := s.Modify("k", func(old []byte) ([]byte, error) {
+		if !bytes.Equal(old, big) {
+			t.Fatalf("Modify saw %d compressed bytes, want the plain value", len(old))
+		}
+		return append(old, 'b'), nil
+	})
+	if !ok || err != nil {
+		t.Fatalf("Modify = %v, %v", ok, err)
+	}
+	it, _ := s.GetItem("k")
+	if !bytes.Equal(it.Value, append(big, 'b')) || it.Meta.ContentType != "text/plain" || it.ExpireAt != before.ExpireAt {
+		t.Fatalf("after Modify item = %d bytes, meta %+v, expiry %v", len(it.Value), it.Meta, it.ExpireAt)
+	}
+	if got, _ := s.Tags("k"); !slices.Equal(got, []string{"t"}) {
+		t.Fatalf("tags after Modify = %v", got)
+	}
+
+	boom := errors.New("boom")
+	if _, err := s.Modify("k", func([]byte) ([]byte, error) { return nil, boom }); !errors.Is(err, boom) {
+		t.Fatalf("Modify err = %v, want %v", err, boom)
+	}
+	if ok, _ := s.Modify("missing", func([]byte) ([]byte, error) { return nil, nil }); ok {
+		t.Fatalf("Modify of missing key reported it exists")
+	}
+}
+
+func TestModifyRetriesAfterConcurrentWrite(t *testing.T) {
+	s := NewStore(1 << 20)
+	s.Put("k", []byte("a"), 0)
+
+	// fn runs unlocked, so it may write the key itself; the write wins and fn
+	// is called again on top of it
+	var seen []string
+	ok, err := s.Modify("k", func(old []byte) ([]byte, error) {
+		seen = append(seen, string(old))
+		if len(seen) == 1 {
+			s.Put("k", []byte("b"), 0)
+		}
+		return append(old, '!'), nil
+	})
+	if !ok || err != nil {
+		t.Fatalf("Modify = %v, %v", ok, err)
+	}
+	if got, _ := s.Get("k"); string(got) != "b!" || !slices.Equal(seen, []string{"a", "b"}) {
+		t.Fatalf("value %q after fn saw %q, want b! after a, b", got, seen)
+	}
+}
+
+func TestPutIfNewerKeepsLatestVersion(t *testing.T) {
+	s := NewStore(1 << 20)
+	t0 := hlc.New(time.Now().Add(-time.Minute), 0)
+	var seen []Mutation
+	s.SetObserver(func(m Mutation) { seen = append(seen, m) })
+
+	if ok, err := s.PutIfNewer("k", []byte("new"), PutOptions{Version: t0 + 2}); !ok || err != nil {
+		t.Fatalf("PutIfNewer on missing key = %v, %v", ok, err)
+	}
+	if ok, _ := s.PutIfNewer("k", []byte("old"), PutOptions{Version: t0}); ok {
+		t.Fatal("older version replaced a newer one")
+	}
+	if ok, _ := s.PutIfNewer("k", []byte("same"), PutOptions{Version: t0 + 2}); ok {
+		t.Fatal("write of an equal version was applied")
+	}
+	it, _ := s.GetItem("k")
+	if string(it.Value) != "new" || it.Version != t0+2 {
+		t.Fatalf("item = %q at version %v", it.Value, it.Version)
+	}
+	if len(seen) != 1 || seen[0].Version != t0+2 {
+		t.Fatalf("observer saw %+v, want one put at the write's version", seen)
+	}
+
+	if ok, _ := s.DeleteIfNewer("k", t0+1); ok {
+		t.Fatal("older delete removed a newer value")
+	}
+	if ok, err := s.DeleteIfNewer("k", t0+3); !ok || err != nil {
+		t.Fatal("newer delete was not applied")
+	}
+	// the tombstone keeps older writes from bringing the key back
+	if ok, _ := s.PutIfNewer("k", []byte("late"), PutOptions{Version: t0 + 2}); ok {
+		t.Fatal("write older than the delete resurrected the key")
+	}
+	if v, ok := s.Version("k"); !ok || v != t0+3 {
+		t.Fatalf("Version of deleted key = %v, %v; want the delete's", v, ok)
+	}
+	if _, ok := s.Get("k"); ok || s.Len() != 0 {
+		t.Fatal("key is visible after a newer delete")
+	}
+
+	// a delete arriving before the write it supersedes still wins
+	if ok, _ := s.DeleteIfNewer("early", t0+5); ok {
+		t.Fatal("delete of a missing key reported a deletion")
+	}
+	if ok, _ := s.PutIfNewer("early", []byte("x"), PutOptions{Version: t0 + 4}); ok {
+		t.Fatal("write older than an earlier-arriving delete was applied")
+	}
+
+	// local writes are stamped after every version the store has seen
+	s.Put("k", []byte("local"), 0)
+	if it, _ := s.GetItem("k"); it.Version <= t0+5 {
+		t.Fatalf("local write version %v is not after the versions seen", it.Version)
+	}
+
+	// a version far in the future would win forever; it is refused
+	future := hlc.New(time.Now().Add(time.Hour), 0)
+	if ok, err := s.PutIfNewer("k", []byte("future"), PutOptions{Version: future}); ok || !errors.Is(err, hlc.ErrOffset) {
+		t.Fatalf("PutIfNewer from the future = %v, %v; want ErrOffset", ok, err)
+	}
+	if ok, err := s.DeleteIfNewer("k", future); ok || !errors.Is(err, hlc.ErrOffset) {
+		t.Fatalf("DeleteIfNewer from the future = %v, %v; want ErrOffset", ok, err)
+	}
+	if v, _ := s.Get("k"); string(v) != "local" {
+		t.Fatalf("k = %q after refused writes", v)
+	}
+}
+
+func TestTombstonesAreCollected(t *testing.T) {
+	s := NewStoreWithConfig(Config{CapacityBytes: 1 << 20, TombstoneGC: 10 * time.Millisecond})
+	s.Put("k", []byte("v"), 0)
+	it, _ := s.GetItem("k")
+	s.Delete("k")
+	if ok, _ := s.PutIfNewer("k", []byte("old"), PutOptions{Version: it.Version}); ok {
+		t.Fatal("write as old as the deleted value was applied within the GC window")
+	}
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := s.Version("k"); ok {
+		t.Fatal("tombstone outlived its GC window")
+	}
+	if ok, _ := s.PutIfNewer("k", []byte("old"), PutOptions{Version: it.Version}); !ok {
+		t.Fatal("write was rejected after the tombstone was collected")
+	}
+}
+
+func TestTombstonesCountAgainstCapacity(t *testing.T) {
+	s := NewStore(100 * (4 + tombstoneOverhead))
+	for i := range 1000 {
+		s.Put(fmt.Sprintf("k%03d", i), []byte("v"), 0)
+		s.Delete(fmt.Sprintf("k%03d", i))
+	}
+	if st := s.Stats(); st.UsedBytes > st.CapacityBytes || st.Items != 0 {
+		t.Fatalf("stats after 1000 deletes = %+v, want tombstones within capacity", st)
+	}
+	// the newest tombstones are kept, the oldest were shed
+	if _, ok := s.Version("k999"); !ok {
+		t.Fatal("newest tombstone was shed")
+	}
+	if _, ok := s.Version("k000"); ok {
+		t.Fatal("oldest tombstone outlived the capacity")
+	}
+
+	// a store with no room to evict sheds tombstones rather than refuse writes
+	full := NewStoreWithConfig(Config{CapacityBytes: 10 * (4 + tombstoneOverhead), Eviction: PolicyNoEviction})
+	for i := range 10 {
+		full.Put(fmt.Sprintf("k%03d", i), []byte("v"), 0)
+		full.Delete(fmt.Sprintf("k%03d", i))
+	}
+	if err := full.Put("big", bytes.Repeat([]byte("x"), 5*tombstoneOverhead), 0); err != nil {
+		t.Fatalf("Put into a store full of tombstones: %v", err)
+	}
+}
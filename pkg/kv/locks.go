@@ -0,0 +1,157 @@
+package kv
+
+import (
+	"container/list"
+	"errors"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
+)
+
+// ErrLocked is returned by Acquire for a lock held by another holder.
+var ErrLocked = errors.New("kv: lock is held by another holder")
+
+// ErrNotHeld is returned by Renew and Release when the caller does not hold
+// the lock, because it never did, released it or let it expire.
+var ErrNotHeld = errors.New("kv: lock is not held by this holder")
+
+// ErrLockTTL is returned by Acquire and Renew for a TTL that is not
+// positive; a lock must expire on its own.
+var ErrLockTTL = errors.New("kv: lock ttl must be positive")
+
+// Lock describes a held lock.
+type Lock struct {
+	Holder string
+	// Fence is the fencing token of the acquisition. Every acquisition of a
+	// lock on a store gets a larger one, so a resource guarded by the lock
+	// can refuse requests carrying a token older than one it has seen. It is
+	// a reading of the store's clock, so fences handed out by another store,
+	// e.g. a key's previous owner, may be larger by as much as the skew
+	// between the two clocks, up to hlc.MaxOffset.
+	Fence    hlc.Timestamp
+	ExpireAt time.Time
+}
+
+// lockValue is a KindLock value.
+type lockValue struct {
+	holder string
+	fence  hlc.Timestamp
+}
+
+func (l *lockValue) kind() Kind { return KindLock }
+func (l *lockValue) len() int   { return 1 }
+func (l *lockValue) size() int  { return len(l.holder) + 8 }
+
+// Acquire takes the lock under key for holder until ttl has passed, or
+// returns ErrLockTTL if ttl is not positive. A holder acquiring a lock it already holds extends
+// it and keeps its fencing token, so a retried Acquire is harmless. If
+// another holder has the lock, Acquire returns that lock, without its
+// holder, and ErrLocked.
+func (s *Store) Acquire(key, holder string, ttl time.Duration) (Lock, error) {
+	if ttl <= 0 {
+		return Lock{}, ErrLockTTL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if el, ok := s.live(key); ok {
+		e := el.Value.(*entry)
+		l, isLock := e.coll.(*lockValue)
+		switch {
+		case !isLock:
+			return Lock{}, ErrWrongType
+		case l.holder != holder:
+			return Lock{Fence: l.fence, ExpireAt: e.expireAt}, ErrLocked
+		}
+		return s.extend(el, now, ttl), nil
+	}
+
+	// the clock never hands out the same reading twice, so fencing tokens
+	// grow with every acquisition of every lock in the store
+	l := &lockValue{holder: holder, fence: s.clock.Now()}
+	e := &entry{key: key, coll: l}
+	s.prepare(e, PutOptions{TTL: ttl, Version: l.fence}, now)
+	if s.policy == PolicyNoEviction && !s.fits(e.size()) {
+		return Lock{}, ErrFull
+	}
+	s.data[key] = s.ll.PushFront(e)
+	s.used += e.size()
+	s.unbury(key)
+	s.emit(Mutation{Op: OpLock, Key: key, ExpireAt: e.expireAt, Version: e.version})
+	s.evictIfNeeded()
+	return Lock{Holder: holder, Fence: l.fence, ExpireAt: e.expireAt}, nil
+}
+
+// Renew extends the lock under key, held by holder, until ttl from now. Like
+// Acquire, it returns ErrLockTTL if ttl is not positive.
+func (s *Store) Renew(key, holder string, ttl time.Duration) (Lock, error) {
+	if ttl <= 0 {
+		return Lock{}, ErrLockTTL
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, err := s.held(key, holder)
+	if err != nil {
+		return Lock{}, err
+	}
+	return s.extend(el, time.Now(), ttl), nil
+}
+
+// Release frees the lock under key, held by holder.
+func (s *Store) Release(key, holder string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, err := s.held(key, holder)
+	if err != nil {
+		return err
+	}
+	s.removeElement(el, OpUnlock)
+	return nil
+}
+
+// LockState returns the lock under key, without its holder, and whether it
+// is held.
+func (s *Store) LockState(key string) (Lock, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	el, ok := s.data[key]
+	if !ok || el.Value.(*entry).expired(time.Now()) {
+		return Lock{}, false, nil
+	}
+	e := el.Value.(*entry)
+	l, isLock := e.coll.(*lockValue)
+	if !isLock {
+		return Lock{}, false, ErrWrongType
+	}
+	return Lock{Fence: l.fence, ExpireAt: e.expireAt}, true, nil
+}
+
+// held returns the element of the lock under key if holder holds it. s.mu
+// must be held.
+func (s *Store) held(key, holder string) (*list.Element, error) {
+	el, ok := s.live(key)
+	if !ok {
+		return nil, ErrNotHeld
+	}
+	l, isLock := el.Value.(*entry).coll.(*lockValue)
+	switch {
+	case !isLock:
+		return nil, ErrWrongType
+	case l.holder != holder:
+		return nil, ErrNotHeld
+	}
+	return el, nil
+}
+
+// extend pushes the expiry of the lock at el to ttl from now. s.mu must be
+// held.
+func (s *Store) extend(el *list.Element, now time.Time, ttl time.Duration) Lock {
+	e := el.Value.(*entry)
+	l := e.coll.(*lockValue)
+	e.ttl = ttl
+	e.expireAt = now.Add(ttl)
+	s.touch(el)
+	s.emit(Mutation{Op: OpTouch, Key: e.key, ExpireAt: e.expireAt})
+	return Lock{Holder: l.holder, Fence: l.fence, ExpireAt: e.expireAt}
+}
@@ -0,0 +1,167 @@
+package kv
+
+import (
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
+)
+
+// DefaultTombstoneGC is how long a Store remembers deleted keys unless its
+// Config says otherwise.
+const DefaultTombstoneGC = 10 * time.Minute
+
+// SetClock makes the store stamp writes from c, so that the stores of a node
+// share one clock. Stores start out with a clock of their own.
+func (s *Store) SetClock(c *hlc.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+}
+
+// PutIfNewer stores val like PutWithOptions unless key holds, or was deleted
+// at, a version at least as new as opts.Version, so that versions of a key
+// written on different nodes settle on the latest whatever order they arrive
+// in. A zero version stamps val from the store's clock, which is advanced
+// past opts.Version. A version more than hlc.MaxOffset ahead of the clock is
+// rejected with hlc.ErrOffset, since it would win over every later write of
+// key. It reports whether val was stored.
+func (s *Store) PutIfNewer(key string, val []byte, opts PutOptions) (bool, error) {
+	stored, codec := s.encode(val, opts.Meta)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if opts.Version == 0 {
+		opts.Version = s.clock.Now()
+	}
+	if _, err := s.clock.Update(opts.Version); err != nil {
+		return false, err
+	}
+	if s.newest(key) >= opts.Version {
+		return false, nil
+	}
+	if err := s.putLocked(&entry{key: key, value: stored, codec: codec}, opts, val); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// DeleteIfNewer deletes key at version v unless it holds, or was deleted at,
+// a version at least as new. The delete leaves a tombstone even if key held
+// no value, since the write it supersedes may still be on its way. Versions
+// too far ahead are rejected as by PutIfNewer. It reports whether a value was
+// deleted.
+func (s *Store) DeleteIfNewer(key string, v hlc.Timestamp) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.clock.Update(v); err != nil {
+		return false, err
+	}
+	if s.newest(key) >= v {
+		return false, nil
+	}
+	el, ok := s.live(key)
+	if !ok {
+		s.bury(key, v)
+		return false, nil
+	}
+	s.removeElementAt(el, OpDelete, v)
+	return true, nil
+}
+
+// Version returns the version key was last written or deleted at, and
+// whether the store knows of either.
+func (s *Store) Version(key string) (hlc.Timestamp, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v := s.newest(key)
+	return v, v != 0
+}
+
+// newest returns the version of key's live value or of its tombstone, zero
+// if it has neither. s.mu must be held.
+func (s *Store) newest(key string) hlc.Timestamp {
+	if el, ok := s.live(key); ok {
+		return el.Value.(*entry).version
+	}
+	s.collectTombstones(time.Now())
+	if t, ok := s.tombs.byKey[key]; ok {
+		return t.version
+	}
+	return 0
+}
+
+// bury records that key was deleted at version v. s.mu must be held.
+func (s *Store) bury(key string, v hlc.Timestamp) {
+	now := time.Now()
+	s.collectTombstones(now)
+	s.unbury(key)
+	t := &tombstone{key: key, version: v, until: now.Add(s.tombGC)}
+	s.tombs.byKey[key] = t
+	s.tombs.queue = append(s.tombs.queue, t)
+	s.used += t.size()
+	for s.used > s.cap && s.shedTombstone() {
+	}
+}
+
+// unbury forgets the tombstone of key, which has been written again, and
+// frees the room it took. s.mu must be held.
+func (s *Store) unbury(key string) {
+	if t, ok := s.tombs.byKey[key]; ok {
+		delete(s.tombs.byKey, key)
+		s.used -= t.size()
+	}
+}
+
+// collectTombstones drops the tombstones whose window has passed by now.
+// s.mu must be held.
+func (s *Store) collectTombstones(now time.Time) {
+	for len(s.tombs.queue) > 0 && now.After(s.tombs.queue[0].until) {
+		s.shedTombstone()
+	}
+}
+
+// shedTombstone drops the oldest tombstone, even if its window has not
+// passed, and reports whether there was one. Tombstones count against the
+// store's capacity, and a store short of room sheds them before it evicts or
+// refuses any value; a key whose tombstone is shed early can be brought back
+// by a write older than its delete. s.mu must be held.
+func (s *Store) shedTombstone() bool {
+	if len(s.tombs.queue) == 0 {
+		return false
+	}
+	t := s.tombs.queue[0]
+	s.tombs.queue[0] = nil
+	s.tombs.queue = s.tombs.queue[1:]
+	// a tombstone already unburied took no room any more
+	if s.tombs.byKey[t.key] == t {
+		delete(s.tombs.byKey, t.key)
+		s.used -= t.size()
+	}
+	return true
+}
+
+// tombstoneOverhead approximates the memory a tombstone takes besides its
+// key: the struct, its map entry and its slot in the queue.
+const tombstoneOverhead = 64
+
+// tombstone remembers the version a key was deleted at.
+type tombstone struct {
+	key     string
+	version hlc.Timestamp
+	until   time.Time // collected after this
+}
+
+// size is the number of bytes a tombstone counts against the store's
+// capacity, from when it is queued until it is collected, shed or superseded.
+func (t *tombstone) size() int {
+	return len(t.key) + tombstoneOverhead
+}
+
+// tombstones holds the tombstones of a store, queued in the order they are
+// collected in. A tombstone superseded by a later delete or write of its key
+// is dropped from byKey at once but stays queued, taking no room, until its
+// turn comes.
+type tombstones struct {
+	byKey map[string]*tombstone
+	queue []*tombstone
+}
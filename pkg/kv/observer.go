@@ -0,0 +1,75 @@
+package kv
+
+import (
+	"bytes"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
+)
+
+// Op identifies the kind of change a Mutation describes.
+type Op string
+
+const (
+	OpPut    Op = "put"    // a value was written
+	OpDelete Op = "delete" // a key was deleted or invalidated
+	OpTouch  Op = "touch"  // a key's expiry changed without its value changing
+	OpUpdate Op = "update" // a hash, list, set or sorted set was changed in place
+	OpExpire Op = "expire" // a key was dropped after its TTL passed
+	OpEvict  Op = "evict"  // a key was dropped to stay within capacity
+	OpLock   Op = "lock"   // a lock was acquired
+	OpUnlock Op = "unlock" // a lock was released by its holder
+)
+
+// Mutation describes a single change applied to a Store.
+type Mutation struct {
+	Op  Op
+	Key string
+	// Value is the written value for OpPut. It is shared with the store and
+	// must not be modified. Values the store keeps in chunks leave it nil;
+	// Len and Bytes see those too.
+	Value    []byte
+	Meta     Meta      // metadata written with the value for OpPut
+	ExpireAt time.Time // new expiry for OpPut and OpTouch, zero if none
+	Time     time.Time
+	// Version is the hybrid logical clock timestamp of an OpPut or OpDelete.
+	Version hlc.Timestamp
+
+	chunks [][]byte // the value of an OpPut stored in chunks, shared
+}
+
+// Len returns the length of the written value.
+func (m Mutation) Len() int {
+	n := len(m.Value)
+	for _, c := range m.chunks {
+		n += len(c)
+	}
+	return n
+}
+
+// Bytes returns the written value, joining it into a new slice if the store
+// keeps it in chunks. Observers call it only when they need the bytes.
+func (m Mutation) Bytes() []byte {
+	if m.chunks == nil {
+		return m.Value
+	}
+	return bytes.Join(m.chunks, nil)
+}
+
+// SetObserver registers fn to be called with every mutation of the store, in
+// the order they are applied. fn runs while the store is locked, so it must be
+// quick, must not block and must not call back into the store. A nil fn
+// removes the observer.
+func (s *Store) SetObserver(fn func(Mutation)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.observer = fn
+}
+
+func (s *Store) emit(m Mutation) {
+	if s.observer == nil {
+		return
+	}
+	m.Time = time.Now()
+	s.observer(m)
+}
@@ -0,0 +1,172 @@
+package kv
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+// RateAlgorithm selects how Allow counts requests against a limit.
+type RateAlgorithm string
+
+const (
+	// TokenBucket refills Limit tokens evenly over Window and lets bursts
+	// spend up to Limit at once.
+	TokenBucket RateAlgorithm = "token_bucket"
+	// SlidingWindow allows Limit requests in any Window, estimated from the
+	// counts of the current and previous fixed windows.
+	SlidingWindow RateAlgorithm = "sliding_window"
+)
+
+// RateLimit is the policy Allow enforces.
+type RateLimit struct {
+	Algorithm RateAlgorithm
+	Limit     int
+	Window    time.Duration
+}
+
+// RateResult is the outcome of Allow.
+type RateResult struct {
+	Allowed   bool
+	Remaining int // requests still allowed right now
+	// Reset is how long until the full limit is available again.
+	Reset time.Duration
+	// RetryAfter is how long a denied request should wait before it would
+	// be allowed, zero if it was allowed.
+	RetryAfter time.Duration
+}
+
+// ErrInvalidRateLimit is returned by Allow for a policy it cannot enforce.
+var ErrInvalidRateLimit = errors.New("kv: rate limit needs a known algorithm, a positive limit and window, and a cost within the limit")
+
+// rateValue is a KindRateLimit value.
+type rateValue struct {
+	limit RateLimit
+	// token bucket: tokens left as of at
+	tokens float64
+	at     time.Time
+	// sliding window: counts of the window starting at start and the one
+	// before it
+	start     time.Time
+	cur, prev int
+}
+
+// rateValueBytes is what a rate limit counts against capacity.
+const rateValueBytes = 48
+
+func (r *rateValue) kind() Kind { return KindRateLimit }
+func (r *rateValue) len() int   { return 1 }
+func (r *rateValue) size() int  { return rateValueBytes }
+
+// Allow counts a request of the given cost against the rate limit under key
+// and reports whether it is within rl. Denied requests are not counted. The
+// key expires once its counters would have reset on their own. A key last
+// used with a different algorithm or window starts over.
+//
+// Unlike other writes, counting is not published to the store's observer:
+// counters are bookkeeping, and a busy limit would flood watchers.
+func (s *Store) Allow(key string, rl RateLimit, cost int) (RateResult, error) {
+	if rl.Algorithm != TokenBucket && rl.Algorithm != SlidingWindow || rl.Limit <= 0 || rl.Window <= 0 || cost <= 0 || cost > rl.Limit {
+		return RateResult{}, ErrInvalidRateLimit
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	el, ok := s.live(key)
+	if ok {
+		if _, isRate := el.Value.(*entry).coll.(*rateValue); !isRate {
+			return RateResult{}, ErrWrongType
+		}
+		s.touch(el)
+	} else {
+		e := &entry{key: key, coll: &rateValue{}}
+		s.prepare(e, PutOptions{TTL: rl.Window}, now)
+		if s.policy == PolicyNoEviction && !s.fits(e.size()) {
+			return RateResult{}, ErrFull
+		}
+		el = s.ll.PushFront(e)
+		s.data[key] = el
+		s.used += e.size()
+		s.evictIfNeeded()
+	}
+
+	e := el.Value.(*entry)
+	r := e.coll.(*rateValue)
+	if r.limit.Algorithm != rl.Algorithm || r.limit.Window != rl.Window {
+		*r = rateValue{limit: rl, tokens: float64(rl.Limit), at: now, start: now.Truncate(rl.Window)}
+	}
+	r.limit = rl
+
+	var res RateResult
+	if rl.Algorithm == TokenBucket {
+		res = r.takeTokens(now, cost)
+		e.ttl = res.Reset
+	} else {
+		res = r.countInWindow(now, cost)
+		// the current window's count matters until the end of the next one
+		e.ttl = r.start.Add(2 * rl.Window).Sub(now)
+	}
+	e.expireAt = now.Add(max(e.ttl, time.Millisecond))
+	return res, nil
+}
+
+// takeTokens refills the bucket up to now and takes cost tokens from it.
+func (r *rateValue) takeTokens(now time.Time, cost int) RateResult {
+	limit := float64(r.limit.Limit)
+	perToken := float64(r.limit.Window) / limit // nanoseconds to refill one token
+	r.tokens = min(limit, r.tokens+float64(now.Sub(r.at))/perToken)
+	r.at = now
+
+	res := RateResult{Allowed: r.tokens >= float64(cost)}
+	if res.Allowed {
+		r.tokens -= float64(cost)
+	} else {
+		res.RetryAfter = time.Duration(math.Ceil((float64(cost) - r.tokens) * perToken))
+	}
+	res.Remaining = int(math.Floor(r.tokens))
+	res.Reset = time.Duration(math.Ceil((limit - r.tokens) * perToken))
+	return res
+}
+
+// countInWindow rolls the windows forward to now and counts cost in the
+// current one. The sliding count weighs the previous window by how much of
+// it still overlaps the last Window.
+func (r *rateValue) countInWindow(now time.Time, cost int) RateResult {
+	w := r.limit.Window
+	switch start := now.Truncate(w); {
+	case start.Sub(r.start) >= 2*w:
+		r.prev, r.cur = 0, 0
+		r.start = start
+	case start.After(r.start):
+		r.prev, r.cur = r.cur, 0
+		r.start = start
+	}
+	elapsed := now.Sub(r.start)
+	overlap := 1 - float64(elapsed)/float64(w)
+	used := float64(r.prev)*overlap + float64(r.cur)
+	limit := float64(r.limit.Limit)
+	end := w - elapsed
+
+	res := RateResult{Allowed: used+float64(cost) <= limit}
+	if res.Allowed {
+		r.cur += cost
+		used += float64(cost)
+	} else {
+		// wait for the previous window to slide out far enough, or for the
+		// current one to end if its own count is too high
+		res.RetryAfter = end
+		if r.prev > 0 && float64(r.cur+cost) <= limit {
+			needed := time.Duration((1 - (limit-float64(r.cur+cost))/float64(r.prev)) * float64(w))
+			res.RetryAfter = max(needed-elapsed, time.Millisecond)
+		}
+	}
+	res.Remaining = max(int(math.Floor(limit-used)), 0)
+	// nothing counted before the current window weighs on the next one;
+	// the current count does, until the next window ends
+	res.Reset = end
+	if r.cur > 0 {
+		res.Reset += w
+	}
+	return res
+}
@@ -0,0 +1,101 @@
+package kv
+
+import "github.com/ryandielhenn/zephyrcache/pkg/vclock"
+
+// Sibling is one of the values of a key written concurrently with
+// PutSibling, with the vector clock of its write.
+type Sibling struct {
+	Value []byte
+	Clock vclock.Clock
+}
+
+// siblingsValue is a KindSiblings value.
+type siblingsValue struct {
+	sibs  []Sibling
+	bytes int
+}
+
+func (v *siblingsValue) kind() Kind { return KindSiblings }
+func (v *siblingsValue) len() int   { return len(v.sibs) }
+func (v *siblingsValue) size() int  { return v.bytes }
+
+// siblingBytes is what a sibling counts against capacity.
+func siblingBytes(val []byte, c vclock.Clock) int {
+	n := len(val)
+	for a := range c {
+		n += len(a) + 8
+	}
+	return n
+}
+
+// keep retains the siblings for which fn returns true.
+func (v *siblingsValue) keep(fn func(Sibling) bool) {
+	kept := v.sibs[:0]
+	for _, sib := range v.sibs {
+		if fn(sib) {
+			kept = append(kept, sib)
+		} else {
+			v.bytes -= siblingBytes(sib.Value, sib.Clock)
+		}
+	}
+	clear(v.sibs[len(kept):])
+	v.sibs = kept
+}
+
+// PutSibling writes val to key as a successor of the siblings the context
+// clock ctx has seen, coordinated by actor. Those siblings are replaced;
+// siblings ctx has not seen, because they were written concurrently, are
+// kept alongside val. A nil ctx has seen nothing, so val joins whatever the
+// key holds. It returns the clock of the new sibling: ctx plus a fresh count
+// of actor.
+//
+// Siblings are replaced based on ctx alone, not on the new clock, as with
+// dotted version vectors: every write of a key is coordinated by its owner,
+// so two blind writes share an actor and the clock of the second would
+// otherwise swallow the first.
+func (s *Store) PutSibling(key string, val []byte, ctx vclock.Clock, actor string) (vclock.Clock, error) {
+	clock := ctx.Copy()
+	grow := siblingBytes(val, clock) + len(actor) + 8
+	err := s.update(key, KindSiblings, true, grow, func(c collection) {
+		v := c.(*siblingsValue)
+		// count past every write of actor, so that the new sibling is told
+		// apart from all of them
+		n := clock[actor]
+		for _, sib := range v.sibs {
+			n = max(n, sib.Clock[actor])
+		}
+		clock[actor] = n + 1
+		v.keep(func(sib Sibling) bool { return !ctx.Descends(sib.Clock) })
+		v.sibs = append(v.sibs, Sibling{Value: append([]byte(nil), val...), Clock: clock})
+		v.bytes += siblingBytes(val, clock)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return clock.Copy(), nil
+}
+
+// Siblings returns the values of key written with PutSibling, oldest first,
+// or nil if key is missing.
+func (s *Store) Siblings(key string) ([]Sibling, error) {
+	var out []Sibling
+	_, err := s.view(key, KindSiblings, func(c collection) {
+		for _, sib := range c.(*siblingsValue).sibs {
+			out = append(out, Sibling{Value: append([]byte(nil), sib.Value...), Clock: sib.Clock.Copy()})
+		}
+	})
+	return out, err
+}
+
+// DeleteSiblings removes the siblings of key the context clock ctx has seen
+// and returns how many are left; the key is deleted once none are. Siblings
+// written concurrently with ctx survive.
+func (s *Store) DeleteSiblings(key string, ctx vclock.Clock) (int, error) {
+	left := 0
+	err := s.update(key, KindSiblings, false, 0, func(c collection) {
+		v := c.(*siblingsValue)
+		v.keep(func(sib Sibling) bool { return !ctx.Descends(sib.Clock) })
+		left = len(v.sibs)
+	})
+	return left, err
+}
@@ -0,0 +1,188 @@
+package kv
+
+import (
+	"bytes"
+	"fmt"
+	"time"
+)
+
+// Cond is a precondition of a TxnOp on the value its key holds before the
+// transaction.
+type Cond int
+
+const (
+	CondNone    Cond = iota
+	CondAbsent       // the key does not exist
+	CondPresent      // the key exists
+	CondEquals       // the key exists and its value equals TxnOp.Expect
+)
+
+// TxnOp is one conditional write of a transaction.
+type TxnOp struct {
+	Key    string
+	Delete bool // delete Key instead of putting Value
+	Value  []byte
+	Opts   PutOptions
+	Cond   Cond
+	Expect []byte // compared with the current value for CondEquals
+}
+
+// ConditionError reports the first op of a transaction whose condition did
+// not hold.
+type ConditionError struct {
+	Index int
+	Key   string
+}
+
+func (e *ConditionError) Error() string {
+	return fmt.Sprintf("kv: condition of op %d on %q failed", e.Index, e.Key)
+}
+
+// Txn applies ops atomically. Every condition is checked against the store as
+// it was before the transaction; if all of them hold the ops are applied in
+// order, otherwise nothing is and a *ConditionError names the first op that
+// failed. Readers never see part of a transaction. A PolicyNoEviction store
+// rejects the whole transaction with ErrFull if its end state does not fit.
+func (s *Store) Txn(ops []TxnOp) error {
+	entries := make([]*entry, len(ops))
+	for i, op := range ops {
+		if !op.Delete {
+			stored, codec := s.encode(op.Value, op.Opts.Meta)
+			entries[i] = &entry{key: op.Key, value: stored, codec: codec}
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i, op := range ops {
+		if !s.holds(op) {
+			return &ConditionError{Index: i, Key: op.Key}
+		}
+	}
+
+	now := time.Now()
+	final := make(map[string]int, len(ops)) // size of each key once applied
+	for i, op := range ops {
+		if op.Delete {
+			final[op.Key] = 0
+			continue
+		}
+		s.prepare(entries[i], op.Opts, now)
+		final[op.Key] = entries[i].size()
+	}
+	if s.policy == PolicyNoEviction {
+		grow := 0
+		for key, size := range final {
+			grow += size
+			if el, ok := s.data[key]; ok {
+				grow -= el.Value.(*entry).size()
+			}
+		}
+		if !s.fits(grow) {
+			return ErrFull
+		}
+	}
+
+	for i, op := range ops {
+		if !op.Delete {
+			s.insert(entries[i], op.Value)
+		} else if el, ok := s.live(op.Key); ok {
+			s.removeElement(el, OpDelete)
+		}
+	}
+	s.evictIfNeeded()
+	return nil
+}
+
+// holds reports whether the condition of op is met. Callers hold s.mu.
+func (s *Store) holds(op TxnOp) bool {
+	if op.Cond == CondNone {
+		return true
+	}
+	el, ok := s.live(op.Key)
+	switch op.Cond {
+	case CondAbsent:
+		return !ok
+	case CondPresent:
+		return ok
+	case CondEquals:
+		if !ok {
+			return false
+		}
+		val, err := el.Value.(*entry).bytes()
+		return err == nil && bytes.Equal(val, op.Expect)
+	}
+	return false
+}
+
+// bytes returns the value of e as written, decompressed and joined.
+func (e *entry) bytes() ([]byte, error) {
+	switch {
+	case e.chunks != nil:
+		return bytes.Join(e.chunks, nil), nil
+	case e.codec != CodecNone:
+		return e.codec.decompress(e.value)
+	}
+	return e.value, nil
+}
+
+// Modify atomically replaces the value of key with what fn returns for the
+// current one, keeping the key's expiry, tags and metadata. fn runs without
+// the store locked; if key is written meanwhile the new value is discarded and
+// fn is called again with the value that won. If fn fails nothing changes and
+// its error is returned. Modify reports whether key exists; fn is not called
+// for a missing key.
+func (s *Store) Modify(key string, fn func(old []byte) ([]byte, error)) (bool, error) {
+	for {
+		s.mu.Lock()
+		el, ok := s.live(key)
+		if !ok {
+			s.mu.Unlock()
+			return false, nil
+		}
+		old := el.Value.(*entry)
+		codec, minComp := s.codec, s.minComp
+		s.mu.Unlock()
+		if old.kind() != KindString {
+			return true, ErrWrongType
+		}
+
+		// values are never changed in place, so old can be read unlocked
+		cur, err := old.bytes()
+		if err != nil {
+			return true, err
+		}
+		val, err := fn(cur)
+		if err != nil {
+			return true, err
+		}
+		stored, enc := encodeWith(codec, minComp, val, old.metadata())
+
+		s.mu.Lock()
+		applied, err := s.replaceIfUnchanged(key, old, stored, enc, val)
+		s.mu.Unlock()
+		if applied || err != nil {
+			return true, err
+		}
+	}
+}
+
+// replaceIfUnchanged stores value under key, encoded with codec, if the
+// key still holds old. Callers hold s.mu.
+func (s *Store) replaceIfUnchanged(key string, old *entry, value []byte, codec Codec, raw []byte) (bool, error) {
+	el, ok := s.live(key)
+	if !ok || el.Value.(*entry) != old {
+		return false, nil
+	}
+	e := *old
+	e.value, e.codec = value, codec
+	e.chunks = nil
+	e.version = s.clock.Now()
+	if s.policy == PolicyNoEviction && !s.fits(e.size()-old.size()) {
+		return false, ErrFull
+	}
+	s.insert(&e, raw)
+	s.evictIfNeeded()
+	return true, nil
+}
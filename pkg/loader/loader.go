@@ -0,0 +1,98 @@
+// Package loader fetches values from an origin on cache misses. A node calls
+// the Loader registered for a namespace when Get misses on the key's owner,
+// stores the result and returns it, collapsing concurrent misses for the same
+// key into one origin call through a Group.
+package loader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// ErrNotFound is returned by a Loader when the origin has no value for the key.
+var ErrNotFound = errors.New("loader: not found")
+
+// ErrTooLarge is returned when the origin's value is larger than a node
+// accepts.
+var ErrTooLarge = errors.New("loader: value too large")
+
+// DefaultMaxBytes is the largest value HTTP reads from the origin unless
+// MaxBytes says otherwise.
+const DefaultMaxBytes = 64 << 20
+
+// Result is a value fetched from the origin.
+type Result struct {
+	Value []byte
+	Meta  kv.Meta       // metadata stored with the value, e.g. its content type
+	TTL   time.Duration // zero leaves the namespace default TTL in effect
+}
+
+// Loader fetches the value for key from an origin.
+type Loader interface {
+	Load(ctx context.Context, key string) (Result, error)
+}
+
+// Func adapts an ordinary function to the Loader interface.
+type Func func(ctx context.Context, key string) (Result, error)
+
+func (f Func) Load(ctx context.Context, key string) (Result, error) {
+	return f(ctx, key)
+}
+
+// HTTP loads values with a GET against an origin URL built from a template in
+// which "{key}" is replaced by the path-escaped key, e.g.
+// "http://users-api/users/{key}". A 404 from the origin maps to ErrNotFound.
+type HTTP struct {
+	URLTemplate string
+	TTL         time.Duration // TTL stored with every loaded value
+	Client      *http.Client  // nil means http.DefaultClient
+	MaxBytes    int64         // largest value read from the origin; zero means DefaultMaxBytes
+}
+
+func (h *HTTP) Load(ctx context.Context, key string) (Result, error) {
+	target := strings.ReplaceAll(h.URLTemplate, "{key}", url.PathEscape(key))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, target, nil)
+	if err != nil {
+		return Result{}, err
+	}
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Result{}, err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Result{}, ErrNotFound
+	case resp.StatusCode/100 != 2:
+		return Result{}, fmt.Errorf("loader: origin returned %s", resp.Status)
+	}
+	limit := h.MaxBytes
+	if limit <= 0 {
+		limit = DefaultMaxBytes
+	}
+	val, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return Result{}, err
+	}
+	if int64(len(val)) > limit {
+		return Result{}, fmt.Errorf("%w: origin sent more than %d bytes", ErrTooLarge, limit)
+	}
+	meta := kv.Meta{
+		ContentType:     resp.Header.Get("Content-Type"),
+		ContentEncoding: resp.Header.Get("Content-Encoding"),
+	}
+	return Result{Value: val, Meta: meta, TTL: h.TTL}, nil
+}
@@ -0,0 +1,104 @@
+package loader
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGroupCollapsesConcurrentCalls(t *testing.T) {
+	var g Group
+	var calls atomic.Int32
+	release := make(chan struct{})
+
+	const N = 16
+	var wg sync.WaitGroup
+	results := make(chan Result, N)
+	for range N {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			res, err, _ := g.Do("k", func() (Result, error) {
+				calls.Add(1)
+				<-release
+				return Result{Value: []byte("v")}, nil
+			})
+			if err != nil {
+				t.Errorf("Do: %v", err)
+			}
+			results <- res
+		}()
+	}
+
+	// give every goroutine a chance to join the in-flight call
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("fn called %d times, want 1", got)
+	}
+	for res := range results {
+		if string(res.Value) != "v" {
+			t.Fatalf("result = %q, want v", res.Value)
+		}
+	}
+
+	// once the call completed, the next Do runs fn again
+	g.Do("k", func() (Result, error) {
+		calls.Add(1)
+		return Result{}, nil
+	})
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("fn called %d times after completion, want 2", got)
+	}
+}
+
+func TestHTTPLoader(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.EscapedPath() {
+		case "/users/a%2Fb":
+			w.Write([]byte("alice"))
+		case "/users/broken":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer origin.Close()
+
+	l := &HTTP{URLTemplate: origin.URL + "/users/{key}", TTL: time.Minute}
+
+	res, err := l.Load(context.Background(), "a/b")
+	if err != nil || string(res.Value) != "alice" || res.TTL != time.Minute {
+		t.Fatalf("Load(a/b) = %+v, %v", res, err)
+	}
+	if _, err := l.Load(context.Background(), "missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load(missing) err = %v, want ErrNotFound", err)
+	}
+	if _, err := l.Load(context.Background(), "broken"); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("Load(broken) err = %v, want origin error", err)
+	}
+}
+
+func TestHTTPLoaderLimitsValueSize(t *testing.T) {
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(make([]byte, 1000))
+	}))
+	defer origin.Close()
+
+	l := &HTTP{URLTemplate: origin.URL + "/{key}", MaxBytes: 1000}
+	if res, err := l.Load(context.Background(), "k"); err != nil || len(res.Value) != 1000 {
+		t.Fatalf("Load at the limit = %d bytes, %v", len(res.Value), err)
+	}
+	l.MaxBytes = 999
+	if _, err := l.Load(context.Background(), "k"); !errors.Is(err, ErrTooLarge) {
+		t.Fatalf("Load over the limit err = %v, want ErrTooLarge", err)
+	}
+}
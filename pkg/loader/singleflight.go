@@ -0,0 +1,45 @@
+package loader
+
+import "sync"
+
+// call is an in-flight or completed Group.Do call.
+type call struct {
+	wg  sync.WaitGroup
+	val Result
+	err error
+}
+
+// Group de-duplicates concurrent loads of the same key: while one load is in
+// flight, later callers for that key wait for it and share its result.
+type Group struct {
+	mu    sync.Mutex
+	calls map[string]*call
+}
+
+// Do runs fn for key unless a call for key is already in flight, in which case
+// it waits for that call instead. shared reports whether the result came from
+// another caller's call.
+func (g *Group) Do(key string, fn func() (Result, error)) (res Result, err error, shared bool) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*call)
+	}
+	if c, ok := g.calls[key]; ok {
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := new(call)
+	c.wg.Add(1)
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	defer func() {
+		g.mu.Lock()
+		delete(g.calls, key)
+		g.mu.Unlock()
+		c.wg.Done()
+	}()
+	c.val, c.err = fn()
+	return c.val, c.err, false
+}
@@ -0,0 +1,264 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/loader"
+)
+
+// batchRequest is the body of a batch call: keys for MGet and MDel, items
+// for MSet.
+type batchRequest struct {
+	Keys  []string    `json:"keys,omitempty"`
+	Items []batchItem `json:"items,omitempty"`
+}
+
+// batchItem is one write of an MSet.
+type batchItem struct {
+	Key   string   `json:"key"`
+	Value []byte   `json:"value"` // base64 in JSON
+	TTLMs int64    `json:"ttl_ms,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+// batchResult is the outcome for one key, with the status code the single-key
+// endpoint would have answered with.
+type batchResult struct {
+	Key    string `json:"key"`
+	Status int    `json:"status"`
+	Value  []byte `json:"value,omitempty"` // base64 in JSON, MGet hits only
+	Error  string `json:"error,omitempty"`
+}
+
+type batchResponse struct {
+	Results []batchResult `json:"results"`
+}
+
+// batchLoads is how many misses of an MGet read through at once.
+const batchLoads = 16
+
+type batchOp int
+
+const (
+	batchGet batchOp = iota
+	batchSet
+	batchDel
+)
+
+// MGet reads the keys in the JSON body {"keys": [...]} of namespace ?ns= and
+// answers {"results": [{"key", "status", "value"}]} in request order. Misses
+// read through the namespace's loader as GET does, a failed load answering
+// 502 for its key.
+func (n *Node) MGet(w http.ResponseWriter, req *http.Request) {
+	n.batch(w, req, batchGet)
+}
+
+// MSet writes the JSON body {"items": [{"key", "value", "ttl_ms", "tags"}]}
+// to namespace ?ns=, values base64 encoded, and reports a status per key.
+func (n *Node) MSet(w http.ResponseWriter, req *http.Request) {
+	n.batch(w, req, batchSet)
+}
+
+// MDel deletes the keys in the JSON body {"keys": [...]} from namespace ?ns=
+// and reports a status per key.
+func (n *Node) MDel(w http.ResponseWriter, req *http.Request) {
+	n.batch(w, req, batchDel)
+}
+
+// batch serves a batch call. Keys are grouped by owner; the local group is
+// served from the store and every other group is sent to its owner as one
+// local-only sub-batch, all in parallel. A failed sub-batch fails only its
+// own keys, with 502.
+func (n *Node) batch(w http.ResponseWriter, req *http.Request, op batchOp) {
+	n.witness(req)
+	name := req.URL.Query().Get("ns")
+	if name == "" {
+		name = DefaultNamespace
+	}
+	ns, ok := n.namespace(name)
+	if !ok {
+		http.Error(w, "unknown namespace", http.StatusNotFound)
+		return
+	}
+	if op == batchSet && ns.siblings {
+		http.Error(w, "MSET is "+errSiblingsNamespace.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var br batchRequest
+	body := http.MaxBytesReader(w, req.Body, n.maxValue.Load())
+	if err := json.NewDecoder(body).Decode(&br); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("invalid batch: %v", err), http.StatusBadRequest)
+		return
+	}
+	keys := br.Keys
+	if op == batchSet {
+		keys = make([]string, len(br.Items))
+		for i, it := range br.Items {
+			keys[i] = it.Key
+		}
+	}
+
+	if isLocal(req) {
+		writeJSON(w, http.StatusOK, batchResponse{Results: n.batchLocal(req.Context(), ns, op, br)})
+		return
+	}
+
+	// positions of the keys owned by each node
+	groups := make(map[string][]int)
+	results := make([]batchResult, len(keys))
+	self := NormalizeHostPort(n.addr, "8080")
+	for i, key := range keys {
+		owner, _, ok := n.OwnerForKey(key)
+		if !ok {
+			results[i] = batchResult{Status: http.StatusServiceUnavailable, Error: "no owner for key"}
+			continue
+		}
+		groups[owner] = append(groups[owner], i)
+	}
+
+	var wg sync.WaitGroup
+	for owner, idx := range groups {
+		sub := subBatch(op, br, idx)
+		if owner == self {
+			copyResults(results, idx, n.batchLocal(req.Context(), ns, op, sub), nil)
+			continue
+		}
+		wg.Add(1)
+		go func(owner string, idx []int, sub batchRequest) {
+			defer wg.Done()
+			data, err := json.Marshal(sub)
+			if err != nil {
+				copyResults(results, idx, nil, err)
+				return
+			}
+			_, raw, err := n.sendLocal(req.Context(), http.MethodPost, owner, req.URL.RequestURI(), data)
+			var resp batchResponse
+			if err == nil {
+				err = json.Unmarshal(raw, &resp)
+			}
+			if err == nil && len(resp.Results) != len(idx) {
+				err = fmt.Errorf("%s answered %d of %d keys", owner, len(resp.Results), len(idx))
+			}
+			copyResults(results, idx, resp.Results, err)
+		}(owner, idx, sub)
+	}
+	wg.Wait()
+
+	for i := range results {
+		results[i].Key = keys[i]
+	}
+	writeJSON(w, http.StatusOK, batchResponse{Results: results})
+}
+
+// subBatch returns the part of br at positions idx.
+func subBatch(op batchOp, br batchRequest, idx []int) batchRequest {
+	var sub batchRequest
+	for _, i := range idx {
+		if op == batchSet {
+			sub.Items = append(sub.Items, br.Items[i])
+		} else {
+			sub.Keys = append(sub.Keys, br.Keys[i])
+		}
+	}
+	return sub
+}
+
+// copyResults stores the results of a sub-batch at positions idx, or err for
+// each of them if the sub-batch failed. Every goroutine writes disjoint
+// positions, so no locking is needed.
+func copyResults(dst []batchResult, idx []int, src []batchResult, err error) {
+	for j, i := range idx {
+		if err != nil {
+			dst[i] = batchResult{Status: http.StatusBadGateway, Error: err.Error()}
+			continue
+		}
+		dst[i] = src[j]
+	}
+}
+
+// batchLocal applies br to the local store of ns.
+func (n *Node) batchLocal(ctx context.Context, ns namespace, op batchOp, br batchRequest) []batchResult {
+	st := ns.store
+	switch op {
+	case batchGet:
+		out := make([]batchResult, len(br.Keys))
+		var wg sync.WaitGroup
+		loading := make(chan struct{}, batchLoads)
+		for i, key := range br.Keys {
+			it, ok := st.GetItem(key)
+			switch {
+			case !ok && ns.loader != nil:
+				// misses load in parallel, each writing only its own result
+				wg.Add(1)
+				loading <- struct{}{}
+				go func(i int, key string) {
+					defer wg.Done()
+					out[i] = n.batchLoad(ctx, ns, key)
+					<-loading
+				}(i, key)
+			case !ok:
+				out[i] = batchResult{Key: key, Status: http.StatusNotFound}
+			case it.Kind != kv.KindString:
+				out[i] = batchResult{Key: key, Status: http.StatusConflict, Error: "key holds a " + it.Kind.String()}
+			default:
+				out[i] = batchResult{Key: key, Status: http.StatusOK, Value: it.Bytes()}
+			}
+		}
+		wg.Wait()
+		return out
+	case batchDel:
+		out := make([]batchResult, len(br.Keys))
+		for i, key := range br.Keys {
+			st.Delete(key)
+			out[i] = batchResult{Key: key, Status: http.StatusNoContent}
+		}
+		return out
+	}
+
+	limit := n.maxValue.Load()
+	out := make([]batchResult, len(br.Items))
+	for i, it := range br.Items {
+		res := batchResult{Key: it.Key, Status: http.StatusNoContent}
+		switch {
+		case it.Key == "":
+			res.Status, res.Error = http.StatusBadRequest, "empty key"
+		case it.TTLMs < 0:
+			res.Status, res.Error = http.StatusBadRequest, "invalid ttl_ms"
+		case int64(len(it.Value)) > limit:
+			res.Status, res.Error = http.StatusRequestEntityTooLarge, fmt.Sprintf("value exceeds %d bytes", limit)
+		default:
+			opts := kv.PutOptions{TTL: time.Duration(it.TTLMs) * time.Millisecond, Tags: it.Tags}
+			err := st.PutWithOptions(it.Key, it.Value, opts)
+			if errors.Is(err, kv.ErrFull) {
+				res.Status, res.Error = http.StatusInsufficientStorage, err.Error()
+			}
+		}
+		out[i] = res
+	}
+	return out
+}
+
+// batchLoad reads key through the loader of ns after an MGet miss.
+func (n *Node) batchLoad(ctx context.Context, ns namespace, key string) batchResult {
+	it, err := n.readThrough(ctx, ns, key)
+	switch {
+	case errors.Is(err, loader.ErrNotFound):
+		return batchResult{Key: key, Status: http.StatusNotFound}
+	case err != nil:
+		return batchResult{Key: key, Status: http.StatusBadGateway, Error: err.Error()}
+	}
+	return batchResult{Key: key, Status: http.StatusOK, Value: it.Bytes()}
+}
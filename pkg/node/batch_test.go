@@ -0,0 +1,148 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/loader"
+)
+
+func postBatch(t *testing.T, url string, br batchRequest) []batchResult {
+	t.Helper()
+	data, _ := json.Marshal(br)
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("POST %s = %s", url, resp.Status)
+	}
+	var out batchResponse
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return out.Results
+}
+
+func TestBatchGroupsKeysByOwner(t *testing.T) {
+	c := newTestCluster(t, 3)
+
+	var set batchRequest
+	var keys []string
+	for i := range 30 {
+		key := fmt.Sprintf("k%d", i)
+		keys = append(keys, key)
+		set.Items = append(set.Items, batchItem{Key: key, Value: []byte("v" + key)})
+	}
+	for i, res := range postBatch(t, c.url(0, "/mset"), set) {
+		if res.Key != keys[i] || res.Status != http.StatusNoContent {
+			t.Fatalf("mset result %d = %+v", i, res)
+		}
+	}
+	for _, key := range keys {
+		owner, _ := c.owner(t, key)
+		if _, ok := c.nodes[owner].kv.Get(key); !ok {
+			t.Fatalf("%q not stored on its owner", key)
+		}
+	}
+
+	got := postBatch(t, c.url(1, "/mget"), batchRequest{Keys: append(keys, "missing")})
+	for i, key := range keys {
+		if got[i].Key != key || got[i].Status != http.StatusOK || string(got[i].Value) != "v"+key {
+			t.Fatalf("mget result %d = %+v", i, got[i])
+		}
+	}
+	if last := got[len(keys)]; last.Key != "missing" || last.Status != http.StatusNotFound {
+		t.Fatalf("mget of missing key = %+v", last)
+	}
+
+	postBatch(t, c.url(2, "/mdel"), batchRequest{Keys: keys[:10]})
+	got = postBatch(t, c.url(0, "/mget"), batchRequest{Keys: keys})
+	for i, res := range got {
+		want := http.StatusOK
+		if i < 10 {
+			want = http.StatusNotFound
+		}
+		if res.Status != want {
+			t.Fatalf("after mdel, %q status = %d, want %d", res.Key, res.Status, want)
+		}
+	}
+}
+
+func TestBatchFailsOnlyKeysOfUnreachableOwner(t *testing.T) {
+	c := newTestCluster(t, 2)
+	c.servers[1].Close()
+
+	var keys []string
+	for i := range 20 {
+		keys = append(keys, fmt.Sprintf("k%d", i))
+	}
+	for i, res := range postBatch(t, c.url(0, "/mget"), batchRequest{Keys: keys}) {
+		owner, _ := c.owner(t, keys[i])
+		want := http.StatusNotFound
+		if owner == 1 {
+			want = http.StatusBadGateway
+		}
+		if res.Key != keys[i] || res.Status != want {
+			t.Fatalf("result for %q owned by node %d = %+v, want status %d", keys[i], owner, res, want)
+		}
+	}
+}
+
+func TestMSetRejectsNegativeTTL(t *testing.T) {
+	c := newTestCluster(t, 2)
+	got := postBatch(t, c.url(0, "/mset"), batchRequest{Items: []batchItem{
+		{Key: "a", Value: []byte("1"), TTLMs: -1},
+		{Key: "b", Value: []byte("2"), TTLMs: 60000},
+	}})
+	if got[0].Status != http.StatusBadRequest || got[1].Status != http.StatusNoContent {
+		t.Fatalf("mset results = %+v, want 400 for the negative ttl_ms only", got)
+	}
+	if status, _ := doRequest(t, http.MethodGet, c.url(0, "/kv/a"), ""); status != http.StatusNotFound {
+		t.Fatalf("GET a = %d, want it not written", status)
+	}
+}
+
+func TestMGetReadsThroughOnMiss(t *testing.T) {
+	n := newTestNode(t)
+	n.SetLoader(DefaultNamespace, loader.Func(func(ctx context.Context, key string) (loader.Result, error) {
+		switch key {
+		case "missing":
+			return loader.Result{}, loader.ErrNotFound
+		case "broken":
+			return loader.Result{}, errors.New("origin down")
+		}
+		return loader.Result{Value: []byte("loaded:" + key)}, nil
+	}))
+	n.kv.Put("cached", []byte("hit"), 0)
+
+	data, _ := json.Marshal(batchRequest{Keys: []string{"cached", "user:1", "missing", "broken"}})
+	rec := httptest.NewRecorder()
+	n.MGet(rec, httptest.NewRequest(http.MethodPost, "/mget", bytes.NewReader(data)))
+	var resp batchResponse
+	if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	want := []batchResult{
+		{Key: "cached", Status: http.StatusOK, Value: []byte("hit")},
+		{Key: "user:1", Status: http.StatusOK, Value: []byte("loaded:user:1")},
+		{Key: "missing", Status: http.StatusNotFound},
+		{Key: "broken", Status: http.StatusBadGateway},
+	}
+	for i, w := range want {
+		got := resp.Results[i]
+		if got.Key != w.Key || got.Status != w.Status || !bytes.Equal(got.Value, w.Value) {
+			t.Fatalf("mget result %d = %+v, want %+v", i, got, w)
+		}
+	}
+	if v, ok := n.kv.Get("user:1"); !ok || string(v) != "loaded:user:1" {
+		t.Fatalf("loaded value not stored: %q, %v", v, ok)
+	}
+}
@@ -0,0 +1,98 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/cdc"
+)
+
+const (
+	// cdcDefaultLimit and cdcMaxLimit bound the records of one feed response.
+	cdcDefaultLimit = 1000
+	cdcMaxLimit     = 10000
+	// cdcMaxWait caps how long a feed request may wait for new records.
+	cdcMaxWait = time.Minute
+)
+
+// cdcResponse is a page of the change feed. Next is the offset to resume
+// from; ID changes when the node restarts and its offsets start over.
+type cdcResponse struct {
+	ID      string       `json:"id"`
+	First   uint64       `json:"first"`
+	Next    uint64       `json:"next"`
+	Records []cdc.Record `json:"records"`
+	Error   string       `json:"error,omitempty"`
+}
+
+// Changes serves this node's change feed: the mutations applied to its local
+// stores, in order, starting at ?from= (default the oldest still buffered).
+// ?limit= caps the records returned and ?wait= long-polls for up to that
+// duration when there are none yet. A consumer passing the ?id= it was last
+// given, or an offset the buffer no longer holds, gets 410 Gone and must
+// resynchronize from first.
+func (n *Node) Changes(w http.ResponseWriter, req *http.Request) {
+	l := n.changes.Load()
+	if l == nil {
+		http.Error(w, "change feed disabled", http.StatusNotFound)
+		return
+	}
+	q := req.URL.Query()
+	first, next := l.Bounds()
+	from := first
+	if v := q.Get("from"); v != "" {
+		var err error
+		if from, err = strconv.ParseUint(v, 10, 64); err != nil {
+			http.Error(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+	}
+	limit := cdcDefaultLimit
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		limit = min(limit, cdcMaxLimit)
+	}
+	var wait time.Duration
+	if v := q.Get("wait"); v != "" {
+		var err error
+		if wait, err = time.ParseDuration(v); err != nil || wait < 0 {
+			http.Error(w, "invalid wait", http.StatusBadRequest)
+			return
+		}
+		wait = min(wait, cdcMaxWait)
+	}
+
+	resp := cdcResponse{ID: l.ID(), First: first, Next: next}
+	if id := q.Get("id"); id != "" && id != l.ID() {
+		resp.Error = "feed restarted"
+		writeJSON(w, http.StatusGone, resp)
+		return
+	}
+	if wait > 0 && from == next {
+		ctx, cancel := context.WithTimeout(req.Context(), wait)
+		l.Wait(ctx, from)
+		cancel()
+	}
+
+	recs, err := l.Read(from, limit)
+	resp.First, resp.Next = l.Bounds()
+	switch {
+	case errors.Is(err, cdc.ErrTruncated), errors.Is(err, cdc.ErrAhead):
+		resp.Error = err.Error()
+		writeJSON(w, http.StatusGone, resp)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	resp.Next = from + uint64(len(recs))
+	resp.Records = recs
+	writeJSON(w, http.StatusOK, resp)
+}
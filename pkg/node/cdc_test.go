@@ -0,0 +1,72 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+func getChanges(t *testing.T, url string) (int, cdcResponse) {
+	t.Helper()
+	status, body := doRequest(t, http.MethodGet, url, "")
+	var resp cdcResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("GET %s = %d %s", url, status, body)
+	}
+	return status, resp
+}
+
+func TestChangeFeedResumesFromOffset(t *testing.T) {
+	c := newTestCluster(t, 1)
+	c.nodes[0].SetCDCBuffer(4)
+	base := c.url(0, "/cdc")
+
+	doRequest(t, http.MethodPut, c.url(0, "/kv/a?ttl_ms=60000"), "1")
+	doRequest(t, http.MethodPut, c.url(0, "/kv/b"), "2")
+	doRequest(t, http.MethodDelete, c.url(0, "/kv/a"), "")
+
+	status, page := getChanges(t, base+"?limit=2")
+	if status != http.StatusOK || len(page.Records) != 2 || page.Next != 3 {
+		t.Fatalf("first page = %d %+v", status, page)
+	}
+	if r := page.Records[0]; r.Seq != 1 || r.Op != kv.OpPut || r.Key != "a" || string(r.Value) != "1" || r.ExpireAt == 0 {
+		t.Fatalf("record 1 = %+v", r)
+	}
+	_, page = getChanges(t, fmt.Sprintf("%s?from=%d&id=%s", base, page.Next, page.ID))
+	if len(page.Records) != 1 || page.Records[0].Op != kv.OpDelete || page.Next != 4 {
+		t.Fatalf("second page = %+v", page)
+	}
+
+	// a long poll at the end of the feed returns as soon as a write lands
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		doRequest(t, http.MethodPut, c.url(0, "/kv/c"), "3")
+	}()
+	_, page = getChanges(t, fmt.Sprintf("%s?from=%d&wait=5s", base, page.Next))
+	if len(page.Records) != 1 || page.Records[0].Key != "c" {
+		t.Fatalf("long poll = %+v", page)
+	}
+
+	// offsets pushed out of the buffer, or from another run, are gone
+	for _, k := range []string{"d", "e"} {
+		doRequest(t, http.MethodPut, c.url(0, "/kv/"+k), k)
+	}
+	if status, page := getChanges(t, base+"?from=1"); status != http.StatusGone || page.First != 3 {
+		t.Fatalf("truncated offset = %d %+v, want 410 with first 3", status, page)
+	}
+	if status, _ := getChanges(t, base+"?from=3&id=stale"); status != http.StatusGone {
+		t.Fatalf("stale id = %d, want 410", status)
+	}
+}
+
+func TestChangeFeedIsOffByDefault(t *testing.T) {
+	c := newTestCluster(t, 1)
+	doRequest(t, http.MethodPut, c.url(0, "/kv/a"), "1")
+	if status, body := doRequest(t, http.MethodGet, c.url(0, "/cdc?from=1"), ""); status != http.StatusNotFound {
+		t.Fatalf("GET /cdc = %d %s, want 404 until the feed is turned on", status, body)
+	}
+}
@@ -0,0 +1,218 @@
+package node
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/ring"
+)
+
+// testCluster is a set of nodes serving real HTTP on loopback, sharing one
+// view of the ring.
+type testCluster struct {
+	nodes   []*Node
+	servers []*httptest.Server
+}
+
+// newTestCluster starts size nodes that all know each other.
+func newTestCluster(t *testing.T, size int) *testCluster {
+	t.Helper()
+	c := &testCluster{}
+	peers := make(map[string]string, size)
+	for i := range size {
+		srv := httptest.NewUnstartedServer(nil)
+		addr := srv.Listener.Addr().String()
+		n := NewNode(kv.NewStore(1<<20), ring.New(64, nil), addr)
+		srv.Config.Handler = testHandler(n)
+		srv.Start()
+		t.Cleanup(srv.Close)
+
+		peers["node"+string(rune('a'+i))] = addr
+		c.nodes = append(c.nodes, n)
+		c.servers = append(c.servers, srv)
+	}
+	for _, n := range c.nodes {
+		n.SyncPeers(peers)
+	}
+	return c
+}
+
+// testHandler routes requests to n the way cmd/server does.
+func testHandler(n *Node) http.Handler {
+	mux := http.NewServeMux()
+	kvHandler := func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut, http.MethodPost:
+			n.Put(w, r)
+		case http.MethodGet:
+			n.Get(w, r)
+		case http.MethodDelete:
+			n.Del(w, r)
+		}
+	}
+	mux.HandleFunc("/kv/", kvHandler)
+	mux.HandleFunc("/ns/{ns}/kv/", kvHandler)
+	mux.HandleFunc("/ttl/", n.TTL)
+	mux.HandleFunc("/ns/{ns}/ttl/", n.TTL)
+	mux.HandleFunc("/invalidate", n.Invalidate)
+	mux.HandleFunc("/watch", n.Watch)
+	mux.HandleFunc("/cdc", n.Changes)
+	mux.HandleFunc("/replicate", n.Replicate)
+	for section, h := range map[string]http.HandlerFunc{"hash": n.Hash, "list": n.List, "set": n.Set, "zset": n.ZSet, "json": n.JSON, "lock": n.Lock, "ratelimit": n.RateLimit} {
+		mux.HandleFunc("/"+section+"/", h)
+		mux.HandleFunc("/ns/{ns}/"+section+"/", h)
+	}
+	mux.HandleFunc("/mget", n.MGet)
+	mux.HandleFunc("/mset", n.MSet)
+	mux.HandleFunc("/mdel", n.MDel)
+	mux.HandleFunc("/txn", n.Txn)
+	mux.HandleFunc("/ring", n.Ring)
+	mux.HandleFunc("/cluster", n.Cluster)
+	mux.HandleFunc("/locate", n.Locate)
+	mux.HandleFunc("/dump", n.Dump)
+	return n.WithRingEpoch(mux)
+}
+
+// owner returns the index of the node owning key and the index of another node.
+func (c *testCluster) owner(t *testing.T, key string) (owner, other int) {
+	t.Helper()
+	hp, _, ok := c.nodes[0].OwnerForKey(key)
+	if !ok {
+		t.Fatalf("no owner for %q", key)
+	}
+	owner = -1
+	for i, n := range c.nodes {
+		if n.Addr() == hp {
+			owner = i
+		}
+	}
+	if owner < 0 {
+		t.Fatalf("owner %q of %q is not a cluster member", hp, key)
+	}
+	return owner, (owner + 1) % len(c.nodes)
+}
+
+func (c *testCluster) url(i int, path string) string {
+	return c.servers[i].URL + path
+}
+
+func TestMetadataSurvivesForwarding(t *testing.T) {
+	c := newTestCluster(t, 2)
+	owner, other := c.owner(t, "doc")
+
+	req, _ := http.NewRequest(http.MethodPut, c.url(other, "/kv/doc"), strings.NewReader(`{"a":1}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Content-Encoding", "identity")
+	req.Header.Set(HeaderFlags, "42")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil || resp.StatusCode != http.StatusNoContent {
+		t.Fatalf("PUT via non-owner: %v %v", resp, err)
+	}
+	resp.Body.Close()
+
+	if it, ok := c.nodes[owner].kv.GetItem("doc"); !ok || it.Meta.ContentType != "application/json" || it.Meta.Flags != 42 {
+		t.Fatalf("owner stored %+v,%v", it, ok)
+	}
+
+	resp, err = http.Get(c.url(other, "/kv/doc"))
+	if err != nil {
+		t.Fatalf("GET via non-owner: %v", err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); got != "application/json" {
+		t.Fatalf("Content-Type = %q, want application/json", got)
+	}
+	if got := resp.Header.Get("Content-Encoding"); got != "identity" {
+		t.Fatalf("Content-Encoding = %q, want identity", got)
+	}
+	if got := resp.Header.Get(HeaderFlags); got != "42" {
+		t.Fatalf("%s = %q, want 42", HeaderFlags, got)
+	}
+}
+
+func TestGetHandsOutCompressedBytes(t *testing.T) {
+	c := newTestCluster(t, 2)
+	owner, other := c.owner(t, "page")
+	c.nodes[owner].kv.Reconfigure(kv.Config{CapacityBytes: 1 << 20, Compression: kv.CodecGzip})
+	val := strings.Repeat("<p>hello</p>", 100)
+	c.nodes[owner].kv.Put("page", []byte(val), 0)
+
+	req, _ := http.NewRequest(http.MethodGet, c.url(other, "/kv/page"), nil)
+	req.Header.Set("Accept-Encoding", "br, gzip;q=0.8")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp.Body.Close()
+	if got := resp.Header.Get("Content-Encoding"); got != "gzip" {
+		t.Fatalf("Content-Encoding = %q, want gzip", got)
+	}
+	zr, err := gzip.NewReader(resp.Body)
+	if err != nil {
+		t.Fatalf("gzip body: %v", err)
+	}
+	if got, _ := io.ReadAll(zr); string(got) != val {
+		t.Fatalf("decompressed body does not match")
+	}
+
+	// clients that do not accept the codec get the plain value
+	req.Header.Set("Accept-Encoding", "gzip;q=0")
+	resp2, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	defer resp2.Body.Close()
+	if got, _ := io.ReadAll(resp2.Body); resp2.Header.Get("Content-Encoding") != "" || string(got) != val {
+		t.Fatalf("plain GET = %q encoded %q", got, resp2.Header.Get("Content-Encoding"))
+	}
+}
+
+func TestPutEnforcesMaxValueSize(t *testing.T) {
+	c := newTestCluster(t, 2)
+	for _, n := range c.nodes {
+		n.SetMaxValueBytes(4 * kv.ChunkSize)
+	}
+	owner, other := c.owner(t, "blob")
+
+	put := func(body io.Reader) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPut, c.url(other, "/kv/blob"), body)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("PUT: %v", err)
+		}
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	big := strings.Repeat("x", 3*kv.ChunkSize+1)
+	if got := put(strings.NewReader(big)); got != http.StatusNoContent {
+		t.Fatalf("PUT of %d bytes = %d, want 204", len(big), got)
+	}
+	resp, err := http.Get(c.url(other, "/kv/blob"))
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != big {
+		t.Fatalf("GET returned %d bytes, want %d", len(body), len(big))
+	}
+
+	huge := strings.Repeat("x", 4*kv.ChunkSize+1)
+	if got := put(strings.NewReader(huge)); got != http.StatusRequestEntityTooLarge {
+		t.Fatalf("PUT with Content-Length over the limit = %d, want 413", got)
+	}
+	// without a Content-Length the limit is enforced while streaming
+	if got := put(io.MultiReader(strings.NewReader(huge))); got != http.StatusRequestEntityTooLarge {
+		t.Fatalf("chunked PUT over the limit = %d, want 413", got)
+	}
+	if got, _ := c.nodes[owner].kv.Get("blob"); len(got) != len(big) {
+		t.Fatalf("rejected PUT replaced the value: %d bytes stored", len(got))
+	}
+}
@@ -0,0 +1,358 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// routeKey resolves the key of req under section and forwards req to the
+// key's owner unless that is this node. ok reports whether the caller should
+// serve req from the local store.
+func (n *Node) routeKey(w http.ResponseWriter, req *http.Request, section string) (namespace, string, bool) {
+	ns, key, ok := n.resolveKey(w, req, section)
+	if !ok {
+		return namespace{}, "", false
+	}
+	owner, self, ok := n.OwnerForKey(key)
+	if !ok {
+		http.Error(w, "no owner for key", http.StatusServiceUnavailable)
+		return namespace{}, "", false
+	}
+	if owner != self {
+		log.Printf("[Forward %s %s] key=%q owner=%q self=%q", req.Method, strings.ToUpper(section), key, owner, self)
+		n.Forward(w, req, owner)
+		return namespace{}, "", false
+	}
+	return ns, key, true
+}
+
+// writeStoreError answers a failed collection operation.
+func writeStoreError(w http.ResponseWriter, key string, err error) {
+	switch {
+	case errors.Is(err, kv.ErrWrongType):
+		http.Error(w, fmt.Sprintf("%q holds a different kind of value", key), http.StatusConflict)
+	case errors.Is(err, kv.ErrFull):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// readValue reads a request body of at most the node's max value size.
+func (n *Node) readValue(w http.ResponseWriter, req *http.Request) ([]byte, bool) {
+	val, err := io.ReadAll(http.MaxBytesReader(w, req.Body, n.maxValue.Load()))
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return nil, false
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return val, true
+}
+
+// Hash serves the hash under /hash/{key}:
+//
+//	GET ?field=f           the field's value
+//	GET                    all fields as a JSON object of base64 values
+//	PUT ?field=f           set the field to the body; 201 if it is new
+//	DELETE ?field=f...     remove fields, answering {"deleted": n}
+func (n *Node) Hash(w http.ResponseWriter, req *http.Request) {
+	ns, key, ok := n.routeKey(w, req, "hash")
+	if !ok {
+		return
+	}
+	st, q := ns.store, req.URL.Query()
+	field := q.Get("field")
+
+	switch req.Method {
+	case http.MethodGet:
+		if field == "" {
+			all, err := st.HGetAll(key)
+			switch {
+			case err != nil:
+				writeStoreError(w, key, err)
+			case all == nil:
+				http.NotFound(w, req)
+			default:
+				writeJSON(w, http.StatusOK, all)
+			}
+			return
+		}
+		val, found, err := st.HGet(key, field)
+		switch {
+		case err != nil:
+			writeStoreError(w, key, err)
+		case !found:
+			http.NotFound(w, req)
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(val)
+		}
+	case http.MethodPut, http.MethodPost:
+		if field == "" {
+			http.Error(w, "field is required", http.StatusBadRequest)
+			return
+		}
+		val, ok := n.readValue(w, req)
+		if !ok {
+			return
+		}
+		added, err := st.HSet(key, field, val)
+		switch {
+		case err != nil:
+			writeStoreError(w, key, err)
+		case added:
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodDelete:
+		if field == "" {
+			http.Error(w, "field is required", http.StatusBadRequest)
+			return
+		}
+		deleted, err := st.HDel(key, q["field"]...)
+		if err != nil {
+			writeStoreError(w, key, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"deleted": deleted})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// List serves the list under /list/{key}:
+//
+//	GET ?start=0&stop=-1   the values in the range as a JSON array of base64
+//	POST ?side=right       push the body on the right (default) or left end,
+//	                       answering {"len": n}
+//	DELETE ?side=left      pop a value off the left (default) or right end
+func (n *Node) List(w http.ResponseWriter, req *http.Request) {
+	ns, key, ok := n.routeKey(w, req, "list")
+	if !ok {
+		return
+	}
+	st, q := ns.store, req.URL.Query()
+	side := q.Get("side")
+	if side != "" && side != "left" && side != "right" {
+		http.Error(w, "side must be left or right", http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		start, stop := 0, -1
+		var err error
+		if v := q.Get("start"); v != "" {
+			if start, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "invalid start", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("stop"); v != "" {
+			if stop, err = strconv.Atoi(v); err != nil {
+				http.Error(w, "invalid stop", http.StatusBadRequest)
+				return
+			}
+		}
+		vals, err := st.LRange(key, start, stop)
+		if err != nil {
+			writeStoreError(w, key, err)
+			return
+		}
+		if vals == nil {
+			vals = [][]byte{}
+		}
+		writeJSON(w, http.StatusOK, vals)
+	case http.MethodPost, http.MethodPut:
+		val, ok := n.readValue(w, req)
+		if !ok {
+			return
+		}
+		push := st.RPush
+		if side == "left" {
+			push = st.LPush
+		}
+		length, err := push(key, val)
+		if err != nil {
+			writeStoreError(w, key, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"len": length})
+	case http.MethodDelete:
+		pop := st.LPop
+		if side == "right" {
+			pop = st.RPop
+		}
+		val, found, err := pop(key)
+		switch {
+		case err != nil:
+			writeStoreError(w, key, err)
+		case !found:
+			http.NotFound(w, req)
+		default:
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write(val)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// Set serves the set under /set/{key}:
+//
+//	GET ?member=m          204 if m is a member, 404 otherwise
+//	GET                    the members as a sorted JSON array
+//	PUT ?member=m...       add members, answering {"added": n}
+//	DELETE ?member=m...    remove members, answering {"removed": n}
+func (n *Node) Set(w http.ResponseWriter, req *http.Request) {
+	ns, key, ok := n.routeKey(w, req, "set")
+	if !ok {
+		return
+	}
+	st, q := ns.store, req.URL.Query()
+	members := q["member"]
+
+	switch req.Method {
+	case http.MethodGet:
+		if len(members) == 0 {
+			all, err := st.SMembers(key)
+			if err != nil {
+				writeStoreError(w, key, err)
+				return
+			}
+			if all == nil {
+				all = []string{}
+			}
+			writeJSON(w, http.StatusOK, all)
+			return
+		}
+		found, err := st.SIsMember(key, members[0])
+		switch {
+		case err != nil:
+			writeStoreError(w, key, err)
+		case !found:
+			http.NotFound(w, req)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodPut, http.MethodPost:
+		if len(members) == 0 {
+			http.Error(w, "member is required", http.StatusBadRequest)
+			return
+		}
+		added, err := st.SAdd(key, members...)
+		if err != nil {
+			writeStoreError(w, key, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"added": added})
+	case http.MethodDelete:
+		if len(members) == 0 {
+			http.Error(w, "member is required", http.StatusBadRequest)
+			return
+		}
+		removed, err := st.SRem(key, members...)
+		if err != nil {
+			writeStoreError(w, key, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"removed": removed})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// ZSet serves the sorted set under /zset/{key}:
+//
+//	GET ?member=m          the member as {"member", "score"}
+//	GET ?min=&max=         members scored within [min, max], by score
+//	PUT ?member=m&score=s  set the member's score; 201 if it is new
+//	DELETE ?member=m...    remove members, answering {"removed": n}
+func (n *Node) ZSet(w http.ResponseWriter, req *http.Request) {
+	ns, key, ok := n.routeKey(w, req, "zset")
+	if !ok {
+		return
+	}
+	st, q := ns.store, req.URL.Query()
+	member := q.Get("member")
+
+	switch req.Method {
+	case http.MethodGet:
+		if member != "" {
+			score, found, err := st.ZScore(key, member)
+			switch {
+			case err != nil:
+				writeStoreError(w, key, err)
+			case !found:
+				http.NotFound(w, req)
+			default:
+				writeJSON(w, http.StatusOK, kv.ZMember{Member: member, Score: score})
+			}
+			return
+		}
+		lo, hi := math.Inf(-1), math.Inf(1)
+		var err error
+		if v := q.Get("min"); v != "" {
+			if lo, err = strconv.ParseFloat(v, 64); err != nil {
+				http.Error(w, "invalid min", http.StatusBadRequest)
+				return
+			}
+		}
+		if v := q.Get("max"); v != "" {
+			if hi, err = strconv.ParseFloat(v, 64); err != nil {
+				http.Error(w, "invalid max", http.StatusBadRequest)
+				return
+			}
+		}
+		members, err := st.ZRangeByScore(key, lo, hi)
+		if err != nil {
+			writeStoreError(w, key, err)
+			return
+		}
+		if members == nil {
+			members = []kv.ZMember{}
+		}
+		writeJSON(w, http.StatusOK, members)
+	case http.MethodPut, http.MethodPost:
+		score, err := strconv.ParseFloat(q.Get("score"), 64)
+		if member == "" || err != nil || math.IsNaN(score) {
+			http.Error(w, "member and a numeric score are required", http.StatusBadRequest)
+			return
+		}
+		added, err := st.ZAdd(key, member, score)
+		switch {
+		case err != nil:
+			writeStoreError(w, key, err)
+		case added:
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	case http.MethodDelete:
+		if member == "" {
+			http.Error(w, "member is required", http.StatusBadRequest)
+			return
+		}
+		removed, err := st.ZRem(key, q["member"]...)
+		if err != nil {
+			writeStoreError(w, key, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, map[string]int{"removed": removed})
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
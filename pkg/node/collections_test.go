@@ -0,0 +1,66 @@
+package node
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+func doRequest(t *testing.T, method, url, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestCollectionsRoutedToOwner(t *testing.T) {
+	c := newTestCluster(t, 2)
+	owner, other := c.owner(t, "profile")
+
+	if status, _ := doRequest(t, http.MethodPut, c.url(other, "/hash/profile?field=name"), "ada"); status != http.StatusCreated {
+		t.Fatalf("HSET via non-owner = %d, want 201", status)
+	}
+	if v, ok, _ := c.nodes[owner].kv.HGet("profile", "name"); !ok || string(v) != "ada" {
+		t.Fatalf("owner hash field = %q,%v", v, ok)
+	}
+	if status, body := doRequest(t, http.MethodGet, c.url(other, "/hash/profile?field=name"), ""); status != http.StatusOK || body != "ada" {
+		t.Fatalf("HGET = %d %q", status, body)
+	}
+	if status, _ := doRequest(t, http.MethodGet, c.url(other, "/kv/profile"), ""); status != http.StatusConflict {
+		t.Fatalf("GET /kv/ of a hash = %d, want 409", status)
+	}
+
+	for _, v := range []string{"a", "b", "c"} {
+		doRequest(t, http.MethodPost, c.url(other, "/list/queue"), v)
+	}
+	if status, body := doRequest(t, http.MethodDelete, c.url(other, "/list/queue"), ""); status != http.StatusOK || body != "a" {
+		t.Fatalf("LPOP = %d %q, want a", status, body)
+	}
+	_, body := doRequest(t, http.MethodGet, c.url(other, "/list/queue?start=-1"), "")
+	var vals [][]byte
+	if err := json.Unmarshal([]byte(body), &vals); err != nil || len(vals) != 1 || string(vals[0]) != "c" {
+		t.Fatalf("LRANGE -1 = %s", body)
+	}
+
+	doRequest(t, http.MethodPut, c.url(other, "/zset/board?member=ada&score=3"), "")
+	doRequest(t, http.MethodPut, c.url(other, "/zset/board?member=bob&score=1.5"), "")
+	doRequest(t, http.MethodPut, c.url(other, "/zset/board?member=cy&score=10"), "")
+	_, body = doRequest(t, http.MethodGet, c.url(other, "/zset/board?min=1&max=5"), "")
+	var members []kv.ZMember
+	if err := json.Unmarshal([]byte(body), &members); err != nil || len(members) != 2 || members[0].Member != "bob" {
+		t.Fatalf("ZRANGEBYSCORE = %s", body)
+	}
+
+	if status, _ := doRequest(t, http.MethodPut, c.url(other, "/set/board?member=x"), ""); status != http.StatusConflict {
+		t.Fatalf("SADD on a zset = %d, want 409", status)
+	}
+}
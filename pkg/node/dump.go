@@ -0,0 +1,53 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"slices"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/replication"
+)
+
+// Dump serves GET /dump?ns=, the string values this node holds in namespace
+// ns as newline-delimited replication.Record puts, ordered by key. It reads
+// the local store only and does not count as reads of the keys; dumping a
+// cluster means dumping every member. Collections, siblings, locks and rate
+// limits are left out. POSTing the records back to /replicate restores them
+// on their owners.
+func (n *Node) Dump(w http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("ns")
+	if name == "" {
+		name = DefaultNamespace
+	}
+	st, ok := n.Store(name)
+	if !ok {
+		http.Error(w, "unknown namespace", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	enc := json.NewEncoder(w)
+	keys := st.Keys()
+	slices.Sort(keys)
+	for _, key := range keys {
+		it, ok := st.Peek(key)
+		if !ok || it.Kind != kv.KindString {
+			continue
+		}
+		rec := replication.Record{
+			Op:        kv.OpPut,
+			Namespace: name,
+			Key:       key,
+			Value:     it.Bytes(),
+			Meta:      it.Meta,
+			Version:   it.Version,
+		}
+		if !it.ExpireAt.IsZero() {
+			rec.ExpireAt = it.ExpireAt.UnixMilli()
+		}
+		if err := enc.Encode(rec); err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/replication"
+)
+
+func TestDumpAndRestore(t *testing.T) {
+	src, dst := newTestCluster(t, 2), newTestCluster(t, 2)
+	for _, key := range []string{"a", "b", "c", "d"} {
+		doRequest(t, http.MethodPut, src.url(0, "/kv/"+key+"?ttl=60"), "v-"+key)
+	}
+	doRequest(t, http.MethodPut, src.url(0, "/hash/h?field=f"), "v")
+
+	// every node dumps only what it holds
+	var recs []replication.Record
+	for i := range src.nodes {
+		status, body := doRequest(t, http.MethodGet, src.url(i, "/dump"), "")
+		if status != http.StatusOK {
+			t.Fatalf("dump node %d = %d %s", i, status, body)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(body), "\n") {
+			if line == "" {
+				continue
+			}
+			var rec replication.Record
+			if err := json.Unmarshal([]byte(line), &rec); err != nil {
+				t.Fatalf("dump line %q: %v", line, err)
+			}
+			if rec.Op != kv.OpPut || rec.ExpireAt == 0 || rec.Version == 0 {
+				t.Fatalf("dumped record %+v", rec)
+			}
+			recs = append(recs, rec)
+		}
+	}
+	if len(recs) != 4 {
+		t.Fatalf("dumped %d records, want the 4 string keys", len(recs))
+	}
+
+	batch, _ := json.Marshal(recs)
+	if status, body := doRequest(t, http.MethodPost, dst.url(1, "/replicate"), string(batch)); status != http.StatusOK || !strings.Contains(body, `"applied":4`) {
+		t.Fatalf("restore = %d %s", status, body)
+	}
+	for _, key := range []string{"a", "b", "c", "d"} {
+		if status, body := doRequest(t, http.MethodGet, dst.url(0, "/kv/"+key), ""); status != http.StatusOK || body != "v-"+key {
+			t.Fatalf("restored GET %s = %d %q", key, status, body)
+		}
+	}
+
+	if status, _ := doRequest(t, http.MethodGet, src.url(0, "/dump?ns=nope"), ""); status != http.StatusNotFound {
+		t.Fatalf("dump of an unknown namespace = %d, want 404", status)
+	}
+}
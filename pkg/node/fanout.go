@@ -0,0 +1,114 @@
+package node
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// HeaderLocal marks a request that a peer fanned out to this node. It must be
+// served from the local store only and never forwarded or fanned out again.
+const HeaderLocal = "X-Zephyr-Local"
+
+// fanoutTimeout bounds how long a single peer may take to answer a fan-out.
+const fanoutTimeout = 5 * time.Second
+
+// peerResult is the raw outcome of a fanned out request against one node.
+type peerResult struct {
+	ID     string
+	Addr   string
+	Status int
+	Body   []byte
+	Err    error
+}
+
+// isLocal reports whether req was fanned out to us by a peer.
+func isLocal(req *http.Request) bool {
+	return req.Header.Get(HeaderLocal) != ""
+}
+
+// fanOut sends method+uri to every node in the ring in parallel and collects
+// the responses ordered by node ID. The request for this node is served by
+// calling local directly instead of going over the network, and is served
+// even if this node is missing from its own view of the ring, e.g. while it
+// joins or leaves; it is then reported without an ID.
+func (n *Node) fanOut(ctx context.Context, method, uri string, local func() (int, []byte)) []peerResult {
+	nodes := n.ring.Nodes()
+	self := NormalizeHostPort(n.addr, "8080")
+
+	results := make([]peerResult, 0, len(nodes)+1)
+	var (
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		served bool
+	)
+	for id, addr := range nodes {
+		hostport := NormalizeHostPort(addr, "8080")
+		if hostport == self {
+			status, body := local()
+			results = append(results, peerResult{ID: id, Addr: hostport, Status: status, Body: body})
+			served = true
+			continue
+		}
+		wg.Add(1)
+		go func(id, hostport string) {
+			defer wg.Done()
+			res := peerResult{ID: id, Addr: hostport}
+			res.Status, res.Body, res.Err = n.sendLocal(ctx, method, hostport, uri, nil)
+			mu.Lock()
+			results = append(results, res)
+			mu.Unlock()
+		}(id, hostport)
+	}
+	if !served {
+		status, body := local()
+		mu.Lock()
+		results = append(results, peerResult{Addr: self, Status: status, Body: body})
+		mu.Unlock()
+	}
+	wg.Wait()
+
+	sort.Slice(results, func(i, j int) bool { return results[i].ID < results[j].ID })
+	return results
+}
+
+// sendLocal issues a single local-only request with an optional JSON body to
+// hostport and returns the status code and body.
+func (n *Node) sendLocal(ctx context.Context, method, hostport, uri string, body []byte) (int, []byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, fanoutTimeout)
+	defer cancel()
+
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body)
+	}
+	out, err := http.NewRequestWithContext(ctx, method, "http://"+hostport+uri, rd)
+	if err != nil {
+		return 0, nil, err
+	}
+	if body != nil {
+		out.Header.Set("Content-Type", "application/json")
+	}
+	out.Header.Set(HeaderLocal, "1")
+	n.stamp(out.Header)
+
+	resp, err := http.DefaultClient.Do(out)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return resp.StatusCode, data, fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(data))
+	}
+	return resp.StatusCode, data, nil
+}
@@ -2,14 +2,44 @@ package node
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
+	"path"
 	"strconv"
 	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/loader"
 )
 
+// HeaderTags carries a comma separated list of tags on a PUT, e.g.
+// "X-Zephyr-Tags: product:42,catalog".
+const HeaderTags = "X-Zephyr-Tags"
+
+// HeaderFlags carries the opaque uint32 flags stored with a value. It is read
+// on PUT, alongside Content-Type and Content-Encoding, and replayed on GET.
+const HeaderFlags = "X-Zephyr-Flags"
+
+// HeaderTTL carries the remaining TTL of a value in milliseconds on GET
+// responses, or -1 if the key never expires.
+const HeaderTTL = "X-Zephyr-TTL-Ms"
+
+// HeaderExpireAt carries the absolute expiry of a value as unix milliseconds
+// on GET responses. It is omitted for keys that never expire.
+const HeaderExpireAt = "X-Zephyr-Expire-At"
+
+// HeaderStale is set on a GET response whose value is past its soft TTL
+// (?soft_ttl= on PUT) but not yet past its hard TTL (?ttl=).
+const HeaderStale = "X-Zephyr-Stale"
+
+// HeaderRevalidate is set on the one stale GET response whose caller should
+// refresh the value; concurrent readers only see HeaderStale.
+const HeaderRevalidate = "X-Zephyr-Revalidate"
+
 // healthz returns 200 OK to indicate the Node is alive.
 func (s *Node) Healthz(w http.ResponseWriter, _ *http.Request) {
 	w.WriteHeader(http.StatusOK)
@@ -44,18 +74,30 @@ func (s *Node) Forward(w http.ResponseWriter, req *http.Request, owner string) {
 	target := *req.URL
 	target.Scheme = "http"
 	target.Host = hostport
+	if req.Header.Get(HeaderRedirect) != "" {
+		http.Redirect(w, req, target.String(), http.StatusTemporaryRedirect)
+		return
+	}
 
 	out, err := http.NewRequestWithContext(req.Context(), req.Method, target.String(), req.Body)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
 	}
+	// stream the body through with its length instead of re-chunking it
+	out.ContentLength = req.ContentLength
 
 	out.Header = req.Header.Clone()
 
 	out.Header.Set("X-Forwarded-For", req.RemoteAddr)
+	s.stamp(out.Header)
 
 	resp, err := http.DefaultClient.Do(out)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, tooLarge.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadGateway)
 		return
@@ -63,6 +105,10 @@ func (s *Node) Forward(w http.ResponseWriter, req *http.Request, owner string) {
 	defer resp.Body.Close()
 
 	for k, vv := range resp.Header {
+		if k == HeaderRingEpoch {
+			// the client is routing by this node's ring, not the owner's
+			continue
+		}
 		for _, v := range vv {
 			w.Header().Add(k, v)
 		}
@@ -74,13 +120,25 @@ func (s *Node) Forward(w http.ResponseWriter, req *http.Request, owner string) {
 
 // put adds a key/value pair
 func (n *Node) Put(w http.ResponseWriter, req *http.Request) {
-	key := req.URL.Path[len("/kv/"):]
+	ns, key, ok := n.resolveKey(w, req, "kv")
+	if !ok {
+		return
+	}
+	st := ns.store
 	owner, self, ok := n.OwnerForKey(key)
 	if !ok {
 		http.Error(w, "no owner for key", http.StatusServiceUnavailable)
 		return
 	}
 
+	limit := n.maxValue.Load()
+	if req.ContentLength > limit {
+		http.Error(w, fmt.Sprintf("value exceeds %d bytes", limit), http.StatusRequestEntityTooLarge)
+		return
+	}
+	body := http.MaxBytesReader(w, req.Body, limit)
+	req.Body = body
+
 	if owner != self {
 		log.Printf("[Forward PUT] key=%q owner=%q self=%q", key, owner, self)
 		n.Forward(w, req, owner)
@@ -88,28 +146,71 @@ func (n *Node) Put(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// handle local case
-	val, err := io.ReadAll(req.Body)
-	if err != nil && err.Error() != "EOF" {
+	if ns.siblings {
+		n.putSibling(w, req, st, key)
+		return
+	}
+	opts, err := parseWriteOptions(req.URL.Query())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	opts.Tags = parseTags(req.Header.Get(HeaderTags))
+	if opts.Meta, err = parseMeta(req.Header); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.Version, err = requestVersion(req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	var ttl time.Duration
-	if ttlStr := req.URL.Query().Get("ttl"); ttlStr != "" {
-		sec, err := strconv.Atoi(ttlStr)
-		if err != nil {
-			http.Error(w, "invalid ttl", http.StatusBadRequest)
-			return
+	applied := true
+	if opts.Version != 0 {
+		// a write at a given version only lands if it is the newest; it is
+		// read whole, up to the value size limit, to compare versions
+		var val []byte
+		if val, err = io.ReadAll(body); err == nil {
+			applied, err = st.PutIfNewer(key, val, opts)
 		}
-		ttl = time.Duration(sec) * time.Second
+	} else {
+		opts.Version = n.clock.Now()
+		err = st.PutStream(key, body, opts)
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, kv.ErrFull):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case !applied:
+		writeStale(w, st, key)
+		return
 	}
-	n.kv.Put(key, val, ttl)
+	w.Header().Set(HeaderVersion, opts.Version.String())
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// writeStale answers a versioned write that lost to the version key already
+// has.
+func writeStale(w http.ResponseWriter, st *kv.Store, key string) {
+	cur, _ := st.Version(key)
+	w.Header().Set(HeaderVersion, cur.String())
+	http.Error(w, fmt.Sprintf("%q has a version at least as new", key), http.StatusConflict)
+}
+
 // get returns the value for a key
 func (n *Node) Get(w http.ResponseWriter, req *http.Request) {
-	key := req.URL.Path[len("/kv/"):]
+	ns, key, ok := n.resolveKey(w, req, "kv")
+	if !ok {
+		return
+	}
+	st := ns.store
 	owner, self, ok := n.OwnerForKey(key)
 	if !ok {
 		http.Error(w, "no owner for key", http.StatusServiceUnavailable)
@@ -123,18 +224,59 @@ func (n *Node) Get(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// handle local case
-	val, ok := n.kv.Get(key)
+	if ns.siblings {
+		n.getSiblings(w, req, st, key)
+		return
+	}
+	it, ok := st.GetItemEncoded(key, acceptedCodecs(req.Header)...)
+	if !ok && ns.loader != nil {
+		var err error
+		it, err = n.readThrough(req.Context(), ns, key)
+		switch {
+		case errors.Is(err, loader.ErrNotFound):
+		case err != nil:
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		default:
+			ok = true
+		}
+	}
 	if !ok {
 		http.NotFound(w, req)
 		return
 	}
-	w.Header().Set("Content-Type", "application/octet-stream")
-	w.Write(val)
+	if it.Kind != kv.KindString {
+		http.Error(w, fmt.Sprintf("%q holds a %s, read it under /%s/", key, it.Kind, it.Kind), http.StatusConflict)
+		return
+	}
+	setTTLHeaders(w.Header(), it.TTLInfo)
+	if it.Stale {
+		w.Header().Set(HeaderStale, "true")
+		if it.Revalidate {
+			w.Header().Set(HeaderRevalidate, "true")
+		}
+	}
+	setMetaHeaders(w.Header(), it.Meta)
+	if it.Version != 0 {
+		w.Header().Set(HeaderVersion, it.Version.String())
+	}
+	if st.Config().Compression != kv.CodecNone {
+		w.Header().Add("Vary", "Accept-Encoding")
+	}
+	if it.Encoding != kv.CodecNone {
+		w.Header().Set("Content-Encoding", string(it.Encoding))
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(it.Len()))
+	it.WriteTo(w)
 }
 
 // del removes a key
 func (n *Node) Del(w http.ResponseWriter, req *http.Request) {
-	key := req.URL.Path[len("/kv/"):]
+	ns, key, ok := n.resolveKey(w, req, "kv")
+	if !ok {
+		return
+	}
+	st := ns.store
 	owner, self, ok := n.OwnerForKey(key)
 	if !ok {
 		http.Error(w, "no owner for key", http.StatusServiceUnavailable)
@@ -148,6 +290,184 @@ func (n *Node) Del(w http.ResponseWriter, req *http.Request) {
 	}
 
 	// handle local case
-	n.kv.Delete(key)
+	if token := req.Header.Get(HeaderContext); ns.siblings && token != "" {
+		n.delSiblings(w, st, key, token)
+		return
+	}
+	v, err := requestVersion(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v == 0 {
+		st.Delete(key)
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if _, err := st.DeleteIfNewer(key, v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if cur, _ := st.Version(key); cur > v {
+		writeStale(w, st, key)
+		return
+	}
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// invalidate deletes every key matching ?prefix=, ?pattern= or ?tag= in
+// namespace ?ns= on all nodes in the ring and reports the per-node counts. A
+// request fanned out by a peer is only applied to the local store.
+func (n *Node) Invalidate(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	prefix, pattern, tag := q.Get("prefix"), q.Get("pattern"), q.Get("tag")
+	given := 0
+	for _, v := range []string{prefix, pattern, tag} {
+		if v != "" {
+			given++
+		}
+	}
+	if given != 1 {
+		http.Error(w, "exactly one of prefix, pattern or tag is required", http.StatusBadRequest)
+		return
+	}
+	if pattern != "" {
+		if _, err := path.Match(pattern, ""); err != nil {
+			http.Error(w, "invalid pattern", http.StatusBadRequest)
+			return
+		}
+	}
+
+	ns := q.Get("ns")
+	if ns == "" {
+		ns = DefaultNamespace
+	}
+	st, ok := n.Store(ns)
+	if !ok {
+		http.Error(w, "unknown namespace", http.StatusNotFound)
+		return
+	}
+
+	n.witness(req)
+	deleteLocal := func() int {
+		switch {
+		case prefix != "":
+			return st.DeletePrefix(prefix)
+		case tag != "":
+			return st.InvalidateTag(tag)
+		}
+		deleted, _ := st.DeleteMatch(pattern)
+		return deleted
+	}
+
+	type nodeResp struct {
+		Node    string `json:"node,omitempty"`
+		Addr    string `json:"addr,omitempty"`
+		Deleted int    `json:"deleted"`
+		Error   string `json:"error,omitempty"`
+	}
+
+	if isLocal(req) {
+		writeJSON(w, http.StatusOK, nodeResp{Deleted: deleteLocal()})
+		return
+	}
+
+	type resp struct {
+		Deleted int        `json:"deleted"`
+		Failed  int        `json:"failed"`
+		Nodes   []nodeResp `json:"nodes"`
+	}
+	out := resp{Nodes: []nodeResp{}}
+	results := n.fanOut(req.Context(), req.Method, req.URL.RequestURI(), func() (int, []byte) {
+		data, _ := json.Marshal(nodeResp{Deleted: deleteLocal()})
+		return http.StatusOK, data
+	})
+	for _, res := range results {
+		nr := nodeResp{Node: res.ID, Addr: res.Addr}
+		if res.Err == nil {
+			res.Err = json.Unmarshal(res.Body, &nr)
+		}
+		if res.Err != nil {
+			nr.Error = res.Err.Error()
+			out.Failed++
+		}
+		nr.Node, nr.Addr = res.ID, res.Addr
+		out.Deleted += nr.Deleted
+		out.Nodes = append(out.Nodes, nr)
+	}
+
+	status := http.StatusOK
+	if out.Failed > 0 {
+		status = http.StatusBadGateway
+	}
+	writeJSON(w, status, out)
+}
+
+// ttl inspects (GET) or resets (PUT/POST) the expiry of a key without reading
+// or rewriting its value. A reset takes ?ttl=, ?ttl_ms= or ?expire_at= (unix
+// ms); without any of them the TTL the key was written with is reapplied.
+// ?persist=true removes the expiry altogether.
+func (n *Node) TTL(w http.ResponseWriter, req *http.Request) {
+	ns, key, ok := n.resolveKey(w, req, "ttl")
+	if !ok {
+		return
+	}
+	st := ns.store
+	owner, self, ok := n.OwnerForKey(key)
+	if !ok {
+		http.Error(w, "no owner for key", http.StatusServiceUnavailable)
+		return
+	}
+
+	if owner != self {
+		log.Printf("[Forward TTL] key=%q owner=%q self=%q", key, owner, self)
+		n.Forward(w, req, owner)
+		return
+	}
+
+	// handle local case
+	if req.Method != http.MethodGet {
+		q := req.URL.Query()
+		for _, name := range []string{"sliding", "soft_ttl", "soft_ttl_ms"} {
+			if q.Has(name) {
+				http.Error(w, name+" is set when the value is written, not on /ttl/", http.StatusBadRequest)
+				return
+			}
+		}
+		opts, err := parseWriteOptions(q)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		switch {
+		case q.Get("persist") == "true":
+			ok = st.ExpireAt(key, time.Time{})
+		case !opts.ExpireAt.IsZero():
+			ok = st.ExpireAt(key, opts.ExpireAt)
+		default:
+			ok = st.Touch(key, opts.TTL)
+		}
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+	}
+
+	info, ok := st.TTL(key)
+	if !ok {
+		http.NotFound(w, req)
+		return
+	}
+	type resp struct {
+		TTLMs    int64 `json:"ttl_ms"`
+		ExpireAt int64 `json:"expire_at,omitempty"`
+		Sliding  bool  `json:"sliding"`
+	}
+	out := resp{TTLMs: -1, Sliding: info.Sliding}
+	if !info.ExpireAt.IsZero() {
+		out.TTLMs = info.Remaining(time.Now()).Milliseconds()
+		out.ExpireAt = info.ExpireAt.UnixMilli()
+	}
+	setTTLHeaders(w.Header(), info)
+	writeJSON(w, http.StatusOK, out)
+}
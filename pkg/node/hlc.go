@@ -0,0 +1,67 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
+)
+
+// HeaderHLC carries the sender's hybrid logical clock on requests between
+// nodes, so that the receiver never stamps a write older than one it could
+// have heard of.
+const HeaderHLC = "X-Zephyr-HLC"
+
+// HeaderVersion carries the hybrid logical clock version of a value. GET and
+// PUT responses report the version read or written. A PUT or DELETE carrying
+// it, such as a replica or handoff write, is applied at that version, and
+// rejected with 409 if the key holds, or was deleted at, a version at least
+// as new.
+const HeaderVersion = "X-Zephyr-Version"
+
+// Clock returns the hybrid logical clock the node stamps writes from.
+func (n *Node) Clock() *hlc.Clock {
+	return n.clock
+}
+
+// witness advances the node's clock past the one a peer sent with req.
+func (n *Node) witness(req *http.Request) {
+	v := req.Header.Get(HeaderHLC)
+	if v == "" {
+		return
+	}
+	ts, err := hlc.Parse(v)
+	if err == nil {
+		_, err = n.clock.Update(ts)
+	}
+	if errors.Is(err, hlc.ErrOffset) {
+		log.Printf("[HLC] ignoring clock of %s: %s is more than %v ahead", req.RemoteAddr, ts.Time(), hlc.MaxOffset)
+	}
+}
+
+// stamp sets the node's clock on a request to a peer.
+func (n *Node) stamp(h http.Header) {
+	h.Set(HeaderHLC, n.clock.Now().String())
+}
+
+// requestVersion returns the version a write is to be applied at, zero if it
+// carries none. A version more than hlc.MaxOffset ahead of the wall clock is
+// invalid: it would win over every later write of the key, here and on every
+// cluster it is replicated to.
+func requestVersion(req *http.Request) (hlc.Timestamp, error) {
+	v := req.Header.Get(HeaderVersion)
+	if v == "" {
+		return 0, nil
+	}
+	ts, err := hlc.Parse(v)
+	if err != nil || ts == 0 {
+		return 0, errors.New("invalid " + HeaderVersion)
+	}
+	if time.Until(ts.Time()) > hlc.MaxOffset {
+		return 0, fmt.Errorf("%s is more than %v in the future", HeaderVersion, hlc.MaxOffset)
+	}
+	return ts, nil
+}
@@ -0,0 +1,112 @@
+package node
+
+import (
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
+)
+
+func versionedRequest(t *testing.T, method, url, body string, v hlc.Timestamp) (int, hlc.Timestamp) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if v != 0 {
+		req.Header.Set(HeaderVersion, v.String())
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	resp.Body.Close()
+	got, _ := hlc.Parse(resp.Header.Get(HeaderVersion))
+	return resp.StatusCode, got
+}
+
+func TestForwardingAdvancesOwnerClock(t *testing.T) {
+	c := newTestCluster(t, 2)
+	owner, other := c.owner(t, "k")
+
+	// the forwarding node's clock runs ahead of the owner's
+	ahead := hlc.New(time.Now().Add(30*time.Second), 0)
+	c.nodes[other].Clock().Update(ahead)
+
+	status, v := versionedRequest(t, http.MethodPut, c.url(other, "/kv/k"), "v", 0)
+	if status != http.StatusNoContent || v <= ahead {
+		t.Fatalf("forwarded PUT = %d at version %v, want a version after %v", status, v, ahead)
+	}
+	if _, got := versionedRequest(t, http.MethodGet, c.url(owner, "/kv/k"), "", 0); got != v {
+		t.Fatalf("GET version = %v, want %v", got, v)
+	}
+	if now := c.nodes[owner].Clock().Now(); now <= v {
+		t.Fatalf("owner clock %v is behind the version it wrote, %v", now, v)
+	}
+}
+
+func TestVersionedWritesRejectOlderVersions(t *testing.T) {
+	c := newTestCluster(t, 2)
+	_, other := c.owner(t, "k")
+	url := c.url(other, "/kv/k")
+	v := hlc.New(time.Now(), 0)
+
+	if status, _ := versionedRequest(t, http.MethodPut, url, "b", v+2); status != http.StatusNoContent {
+		t.Fatalf("versioned PUT = %d", status)
+	}
+	if status, cur := versionedRequest(t, http.MethodPut, url, "a", v+1); status != http.StatusConflict || cur != v+2 {
+		t.Fatalf("older PUT = %d with version %v, want 409 with %v", status, cur, v+2)
+	}
+	if status, _ := versionedRequest(t, http.MethodDelete, url, "", v+1); status != http.StatusConflict {
+		t.Fatalf("older DELETE = %d, want 409", status)
+	}
+	if status, _ := versionedRequest(t, http.MethodDelete, url, "", v+3); status != http.StatusNoContent {
+		t.Fatalf("newer DELETE = %d, want 204", status)
+	}
+	// the tombstone rejects writes older than the delete
+	if status, _ := versionedRequest(t, http.MethodPut, url, "c", v+2); status != http.StatusConflict {
+		t.Fatalf("PUT older than the delete = %d, want 409", status)
+	}
+	if status, _ := doRequest(t, http.MethodGet, url, ""); status != http.StatusNotFound {
+		t.Fatalf("GET after delete = %d, want 404", status)
+	}
+	if status, _ := versionedRequest(t, http.MethodPut, url, "d", v+4); status != http.StatusNoContent {
+		t.Fatalf("PUT newer than the delete = %d, want 204", status)
+	}
+}
+
+func TestVersionsFromTheFutureAreRejected(t *testing.T) {
+	c := newTestCluster(t, 2)
+	owner, _ := c.owner(t, "k")
+	future := hlc.New(time.Now().Add(time.Hour), 0)
+
+	for _, method := range []string{http.MethodPut, http.MethodDelete} {
+		if status, _ := versionedRequest(t, method, c.url(owner, "/kv/k"), "v", future); status != http.StatusBadRequest {
+			t.Fatalf("%s an hour ahead = %d, want 400", method, status)
+		}
+	}
+	batch := `[{"op":"put","ns":"default","key":"k","value":"dg==","version":` + future.String() + `}]`
+	if status, body := doRequest(t, http.MethodPost, c.url(owner, "/replicate"), batch); status != http.StatusOK || !strings.Contains(body, `"failed":1`) {
+		t.Fatalf("replicated write an hour ahead = %d %s, want it failed", status, body)
+	}
+	if status, _ := doRequest(t, http.MethodGet, c.url(owner, "/kv/k"), ""); status != http.StatusNotFound {
+		t.Fatalf("GET = %d, want the future write not applied", status)
+	}
+}
+
+func TestVersionedPutIsBoundedByMaxValueSize(t *testing.T) {
+	c := newTestCluster(t, 1)
+	c.nodes[0].SetMaxValueBytes(8)
+	// no Content-Length, so the limit is only hit while reading
+	body := io.MultiReader(strings.NewReader("0123456789abcdef"))
+	req, _ := http.NewRequest(http.MethodPut, c.url(0, "/kv/k"), body)
+	req.Header.Set(HeaderVersion, hlc.New(time.Now(), 0).String())
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Fatalf("versioned PUT over the limit = %d, want 413", resp.StatusCode)
+	}
+}
@@ -0,0 +1,89 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+// invalidateResponse is the answer of a fanned out /invalidate.
+type invalidateResponse struct {
+	Deleted int `json:"deleted"`
+	Failed  int `json:"failed"`
+	Nodes   []struct {
+		Node    string `json:"node"`
+		Addr    string `json:"addr"`
+		Deleted int    `json:"deleted"`
+		Error   string `json:"error"`
+	} `json:"nodes"`
+}
+
+func invalidate(t *testing.T, url string) (int, invalidateResponse) {
+	t.Helper()
+	status, body := doRequest(t, http.MethodPost, url, "")
+	var resp invalidateResponse
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatalf("POST %s = %d %s", url, status, body)
+	}
+	return status, resp
+}
+
+func TestInvalidateFansOutToEveryNode(t *testing.T) {
+	c := newTestCluster(t, 3)
+	// keys written through node 0 land on their owners; count them per node
+	write := func() map[string]int {
+		want := make(map[string]int)
+		for i := range 30 {
+			key := "user:" + strconv.Itoa(i)
+			doRequest(t, http.MethodPut, c.url(0, "/kv/"+key), "v")
+			owner, _ := c.owner(t, key)
+			want[c.nodes[owner].Addr()]++
+		}
+		doRequest(t, http.MethodPut, c.url(0, "/kv/session:1"), "v")
+		return want
+	}
+
+	want := write()
+	status, resp := invalidate(t, c.url(0, "/invalidate?prefix=user:"))
+	if status != http.StatusOK || resp.Deleted != 30 || resp.Failed != 0 || len(resp.Nodes) != 3 {
+		t.Fatalf("invalidate = %d %+v, want 30 keys deleted on 3 nodes", status, resp)
+	}
+	for _, nr := range resp.Nodes {
+		if nr.Deleted != want[nr.Addr] || nr.Error != "" {
+			t.Errorf("node %s (%s) deleted %d, want %d", nr.Node, nr.Addr, nr.Deleted, want[nr.Addr])
+		}
+	}
+	if status, _ := doRequest(t, http.MethodGet, c.url(0, "/kv/session:1"), ""); status != http.StatusOK {
+		t.Fatalf("key outside the prefix = %d, want it kept", status)
+	}
+
+	// a peer that is down fails the request, but the others are invalidated
+	want = write()
+	down := c.nodes[2].Addr()
+	c.servers[2].Close()
+	status, resp = invalidate(t, c.url(0, "/invalidate?prefix=user:"))
+	if status != http.StatusBadGateway || resp.Failed != 1 || resp.Deleted != 30-want[down] {
+		t.Fatalf("invalidate with a peer down = %d %+v, want 502 with one failure", status, resp)
+	}
+	for _, nr := range resp.Nodes {
+		if (nr.Addr == down) != (nr.Error != "") {
+			t.Errorf("node %s: error %q", nr.Addr, nr.Error)
+		}
+	}
+}
+
+func TestInvalidateAppliesLocallyOutsideTheRing(t *testing.T) {
+	c := newTestCluster(t, 2)
+	// node 0 has not yet learned that it is a member
+	c.nodes[0].SyncPeers(map[string]string{"nodeb": c.nodes[1].Addr()})
+	c.nodes[0].kv.Put("user:1", []byte("v"), 0)
+
+	status, resp := invalidate(t, c.url(0, "/invalidate?prefix=user:"))
+	if status != http.StatusOK || resp.Deleted != 1 || len(resp.Nodes) != 2 {
+		t.Fatalf("invalidate = %d %+v, want the local key deleted", status, resp)
+	}
+	if _, ok := c.nodes[0].kv.Get("user:1"); ok {
+		t.Fatal("local key survived the invalidation")
+	}
+}
@@ -0,0 +1,159 @@
+package node
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/jsondoc"
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// Media types of the patch formats JSON accepts on PATCH.
+const (
+	ContentTypeJSONPatch  = "application/json-patch+json"
+	ContentTypeMergePatch = "application/merge-patch+json"
+)
+
+// errNotJSON marks a stored value that is not a JSON document.
+var errNotJSON = errors.New("value is not a JSON document")
+
+// errDocTooLarge marks a patched document over the node's max value size.
+var errDocTooLarge = errors.New("patched document exceeds the max value size")
+
+// JSON serves JSON documents under /json/{key}:
+//
+//	GET ?path=/a/0         the sub-document at a JSON Pointer, or the whole one
+//	PUT                    store the body, which must be JSON; takes the
+//	                       expiry options of /kv/
+//	PATCH                  apply a JSON Patch, or a merge patch if sent as
+//	                       application/merge-patch+json, on the owner
+//	                       atomically and answer the patched document
+//
+// A failed "test" op answers 409, a patch that does not apply to the document
+// 422 and one that grows it past the max value size 413; in all cases the
+// document is left unchanged.
+func (n *Node) JSON(w http.ResponseWriter, req *http.Request) {
+	ns, key, ok := n.routeKey(w, req, "json")
+	if !ok {
+		return
+	}
+	st := ns.store
+	if ns.siblings && req.Method != http.MethodGet {
+		http.Error(w, "writing JSON documents is "+errSiblingsNamespace.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch req.Method {
+	case http.MethodGet:
+		it, ok := st.GetItem(key)
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		if it.Kind != kv.KindString {
+			writeStoreError(w, key, kv.ErrWrongType)
+			return
+		}
+		doc, err := jsondoc.Get(it.Bytes(), req.URL.Query().Get("path"))
+		switch {
+		case errors.Is(err, jsondoc.ErrNotFound):
+			http.NotFound(w, req)
+			return
+		case errors.Is(err, jsondoc.ErrInvalidPointer):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		case err != nil:
+			http.Error(w, errNotJSON.Error(), http.StatusConflict)
+			return
+		}
+		setTTLHeaders(w.Header(), it.TTLInfo)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	case http.MethodPut, http.MethodPost:
+		opts, err := parseWriteOptions(req.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		val, ok := n.readValue(w, req)
+		if !ok {
+			return
+		}
+		if _, err := jsondoc.Decode(val); err != nil {
+			http.Error(w, "body is not JSON: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		opts.Tags = parseTags(req.Header.Get(HeaderTags))
+		opts.Meta = kv.Meta{ContentType: "application/json"}
+		if err := st.PutWithOptions(key, val, opts); err != nil {
+			writeStoreError(w, key, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case http.MethodPatch:
+		body, ok := n.readValue(w, req)
+		if !ok {
+			return
+		}
+		apply, err := parsePatch(req.Header.Get("Content-Type"), body)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var doc []byte
+		limit := n.maxValue.Load()
+		found, err := st.Modify(key, func(old []byte) ([]byte, error) {
+			if _, err := jsondoc.Decode(old); err != nil {
+				return nil, errNotJSON
+			}
+			doc, err = apply(old)
+			if err == nil && int64(len(doc)) > limit {
+				err = errDocTooLarge
+			}
+			return doc, err
+		})
+		switch {
+		case !found:
+			http.NotFound(w, req)
+		case err != nil:
+			writePatchError(w, err)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(doc)
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// parsePatch returns a function applying body, interpreted according to its
+// media type, to a document. JSON Patch is the default.
+func parsePatch(contentType string, body []byte) (func(doc []byte) ([]byte, error), error) {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	if mt == ContentTypeMergePatch {
+		if _, err := jsondoc.Decode(body); err != nil {
+			return nil, err
+		}
+		return func(doc []byte) ([]byte, error) { return jsondoc.MergePatch(doc, body) }, nil
+	}
+	p, err := jsondoc.ParsePatch(body)
+	if err != nil {
+		return nil, err
+	}
+	return p.Apply, nil
+}
+
+// writePatchError answers a failed patch of a JSON document.
+func writePatchError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, jsondoc.ErrTestFailed), errors.Is(err, errNotJSON), errors.Is(err, kv.ErrWrongType):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case errors.Is(err, errDocTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, kv.ErrFull):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	default:
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	}
+}
@@ -0,0 +1,90 @@
+package node
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func patchJSON(t *testing.T, url, contentType, body string) (int, string) {
+	t.Helper()
+	req, _ := http.NewRequest(http.MethodPatch, url, strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("PATCH %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data)
+}
+
+func TestJSONDocuments(t *testing.T) {
+	c := newTestCluster(t, 2)
+	_, other := c.owner(t, "cart")
+	url := c.url(other, "/json/cart")
+
+	if status, _ := doRequest(t, http.MethodPut, url, `{"user": "ada", "items": []}`); status != http.StatusNoContent {
+		t.Fatalf("PUT = %d", status)
+	}
+	if status, _ := doRequest(t, http.MethodPut, url, `{"user":`); status != http.StatusBadRequest {
+		t.Fatalf("PUT of invalid JSON = %d, want 400", status)
+	}
+	if status, body := doRequest(t, http.MethodGet, url+"?path=/user", ""); status != http.StatusOK || body != `"ada"` {
+		t.Fatalf("GET path = %d %s", status, body)
+	}
+
+	// concurrent patches are applied one at a time on the owner
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodPatch, url, strings.NewReader(`[{"op": "add", "path": "/items/-", "value": 1}]`))
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Errorf("PATCH: %v", err)
+				return
+			}
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	_, body := doRequest(t, http.MethodGet, url+"?path=/items", "")
+	var items []int
+	if err := json.Unmarshal([]byte(body), &items); err != nil || len(items) != 20 {
+		t.Fatalf("items after 20 concurrent adds = %s", body)
+	}
+
+	status, body := patchJSON(t, url, ContentTypeMergePatch, `{"user": "grace", "items": null}`)
+	if status != http.StatusOK || body != `{"user":"grace"}` {
+		t.Fatalf("merge patch = %d %s", status, body)
+	}
+	if status, _ := patchJSON(t, url, ContentTypeJSONPatch, `[{"op": "replace", "path": "/user", "value": "x"}, {"op": "test", "path": "/user", "value": "y"}]`); status != http.StatusConflict {
+		t.Fatalf("patch with failing test = %d, want 409", status)
+	}
+	if status, _ := patchJSON(t, url, ContentTypeJSONPatch, `[{"op": "remove", "path": "/missing"}]`); status != http.StatusUnprocessableEntity {
+		t.Fatalf("patch of missing path = %d, want 422", status)
+	}
+	if _, body := doRequest(t, http.MethodGet, url, ""); body != `{"user":"grace"}` {
+		t.Fatalf("failed patches changed the document: %s", body)
+	}
+}
+
+func TestJSONPatchIsBoundedByMaxValueSize(t *testing.T) {
+	c := newTestCluster(t, 1)
+	c.nodes[0].SetMaxValueBytes(32)
+	url := c.url(0, "/json/doc")
+	doRequest(t, http.MethodPut, url, `{"a": 1}`)
+
+	status, _ := patchJSON(t, url, ContentTypeMergePatch, `{"b": "`+strings.Repeat("x", 20)+`"}`)
+	if status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("patch growing the document past the limit = %d, want 413", status)
+	}
+	if _, body := doRequest(t, http.MethodGet, url, ""); body != `{"a":1}` {
+		t.Fatalf("document after rejected patch = %s", body)
+	}
+}
@@ -0,0 +1,92 @@
+package node
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// lockResponse describes a lock. The holder is only reported back to the
+// holder itself.
+type lockResponse struct {
+	Holder   string        `json:"holder,omitempty"`
+	Fence    hlc.Timestamp `json:"fence,string"` // a string, as it overflows JSON numbers
+	ExpireAt int64         `json:"expire_at"`    // unix milliseconds
+}
+
+func newLockResponse(l kv.Lock) lockResponse {
+	return lockResponse{Holder: l.Holder, Fence: l.Fence, ExpireAt: l.ExpireAt.UnixMilli()}
+}
+
+// Lock serves the lock under /lock/{key}, taken on the key's owner:
+//
+//	POST ?holder=h&ttl=s      acquire for h; 409 while someone else holds it
+//	PUT ?holder=h&ttl=s       renew; 409 unless h holds it
+//	DELETE ?holder=h          release; 409 unless h holds it
+//	GET                       the lock's fencing token and expiry
+//
+// The TTL is in seconds, or in milliseconds with ?ttl_ms=. Acquire and renew
+// answer the lock with its fencing token.
+func (n *Node) Lock(w http.ResponseWriter, req *http.Request) {
+	ns, key, ok := n.routeKey(w, req, "lock")
+	if !ok {
+		return
+	}
+	st, q := ns.store, req.URL.Query()
+	holder := q.Get("holder")
+	if holder == "" && req.Method != http.MethodGet {
+		http.Error(w, "holder is required", http.StatusBadRequest)
+		return
+	}
+	var ttl time.Duration
+	if req.Method == http.MethodPost || req.Method == http.MethodPut {
+		var err error
+		if ttl, err = parseDuration(q, "ttl"); err != nil || ttl <= 0 {
+			http.Error(w, "a positive ttl is required", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var (
+		l   kv.Lock
+		err error
+	)
+	switch req.Method {
+	case http.MethodGet:
+		var held bool
+		l, held, err = st.LockState(key)
+		if err == nil && !held {
+			http.NotFound(w, req)
+			return
+		}
+	case http.MethodPost:
+		l, err = st.Acquire(key, holder, ttl)
+	case http.MethodPut:
+		l, err = st.Renew(key, holder, ttl)
+	case http.MethodDelete:
+		if err = st.Release(key, holder); err == nil {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	switch {
+	case errors.Is(err, kv.ErrLocked):
+		secs := max(int64(time.Until(l.ExpireAt).Seconds()+1), 1)
+		w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+		writeJSON(w, http.StatusConflict, newLockResponse(l))
+	case errors.Is(err, kv.ErrNotHeld):
+		http.Error(w, err.Error(), http.StatusConflict)
+	case err != nil:
+		writeStoreError(w, key, err)
+	default:
+		writeJSON(w, http.StatusOK, newLockResponse(l))
+	}
+}
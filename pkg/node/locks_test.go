@@ -0,0 +1,109 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+func TestLockLifecycleOnOwner(t *testing.T) {
+	c := newTestCluster(t, 2)
+	owner, other := c.owner(t, "job")
+	url := func(i int, query string) string { return c.url(i, "/lock/job?"+query) }
+
+	status, body := doRequest(t, http.MethodPost, url(other, "holder=a&ttl=30"), "")
+	var a lockResponse
+	json.Unmarshal([]byte(body), &a)
+	if status != http.StatusOK || a.Holder != "a" || a.Fence == 0 {
+		t.Fatalf("acquire via non-owner = %d %s", status, body)
+	}
+	status, body = doRequest(t, http.MethodPost, url(owner, "holder=b&ttl=30"), "")
+	var held lockResponse
+	json.Unmarshal([]byte(body), &held)
+	if status != http.StatusConflict || held.Holder != "" || held.Fence != a.Fence {
+		t.Fatalf("acquire of a held lock = %d %s, want 409 with the fence but not the holder", status, body)
+	}
+
+	if status, _ := doRequest(t, http.MethodPut, url(other, "holder=b&ttl=30"), ""); status != http.StatusConflict {
+		t.Fatalf("renew by another holder = %d, want 409", status)
+	}
+	if status, _ := doRequest(t, http.MethodPut, url(other, "holder=a&ttl_ms=500"), ""); status != http.StatusOK {
+		t.Fatalf("renew by the holder = %d", status)
+	}
+	if status, _ := doRequest(t, http.MethodDelete, url(owner, "holder=b"), ""); status != http.StatusConflict {
+		t.Fatalf("release by another holder = %d, want 409", status)
+	}
+	if status, _ := doRequest(t, http.MethodDelete, url(other, "holder=a"), ""); status != http.StatusNoContent {
+		t.Fatalf("release by the holder = %d", status)
+	}
+
+	status, body = doRequest(t, http.MethodPost, url(other, "holder=b&ttl=30"), "")
+	var b lockResponse
+	json.Unmarshal([]byte(body), &b)
+	if status != http.StatusOK || b.Fence <= a.Fence {
+		t.Fatalf("acquire after release = %d %s, want a fence after %v", status, body, a.Fence)
+	}
+	if status, _ := doRequest(t, http.MethodPost, url(owner, "holder=b"), ""); status != http.StatusBadRequest {
+		t.Fatalf("acquire without a ttl = %d, want 400", status)
+	}
+}
+
+func TestLocksAreNotWrittenBehind(t *testing.T) {
+	n := newTestNode(t)
+	n.SetCDCBuffer(16)
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	n.SyncNamespaces(map[string]string{
+		"jobs": `{"capacity_bytes": 4096, "write_behind": {"sink": "file", "path": "` + path + `", "flush_interval": "10ms"}}`,
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPost, "/ns/jobs/lock/nightly?holder=a&ttl=30", nil),
+		httptest.NewRequest(http.MethodDelete, "/ns/jobs/lock/nightly?holder=a", nil),
+	} {
+		rec := httptest.NewRecorder()
+		n.Lock(rec, req)
+		if rec.Code/100 != 2 {
+			t.Fatalf("%s %s = %d", req.Method, req.URL, rec.Code)
+		}
+	}
+	rec := httptest.NewRecorder()
+	n.Put(rec, httptest.NewRequest(http.MethodPut, "/ns/jobs/kv/marker", strings.NewReader("m")))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if strings.Contains(string(data), `"key":"marker"`) {
+			if strings.Contains(string(data), "nightly") {
+				t.Fatalf("lock mutations were written behind:\n%s", data)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("write-behind did not flush, file has:\n%s", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// the change feed records them as what they are
+	records, err := n.changes.Load().Read(1, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var ops []kv.Op
+	for _, r := range records {
+		if r.Key == "nightly" {
+			ops = append(ops, r.Op)
+		}
+	}
+	if want := []kv.Op{kv.OpLock, kv.OpUnlock}; !slices.Equal(ops, want) {
+		t.Fatalf("change feed ops for the lock = %v, want %v", ops, want)
+	}
+}
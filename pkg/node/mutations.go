@@ -0,0 +1,67 @@
+package node
+
+import (
+	"github.com/ryandielhenn/zephyrcache/pkg/cdc"
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/replication"
+	"github.com/ryandielhenn/zephyrcache/pkg/watch"
+	"github.com/ryandielhenn/zephyrcache/pkg/writebehind"
+)
+
+// watchTypes maps store mutations to the watch events they publish.
+var watchTypes = map[kv.Op]watch.Type{
+	kv.OpPut:    watch.Put,
+	kv.OpUpdate: watch.Put,
+	kv.OpDelete: watch.Delete,
+	kv.OpExpire: watch.Expire,
+	kv.OpEvict:  watch.Evict,
+	kv.OpLock:   watch.Put,
+	kv.OpUnlock: watch.Delete,
+}
+
+// onMutation is the observer of every namespace store. It runs while the
+// store is locked, so everything it hands mutations to must not block.
+func (n *Node) onMutation(ns string, hooks *nsHooks, m kv.Mutation) {
+	// values stored in chunks are joined once, and only if someone needs them
+	var val []byte
+	value := func() []byte {
+		if val == nil {
+			val = m.Bytes()
+		}
+		return val
+	}
+	if typ, ok := watchTypes[m.Op]; ok && n.watch.Len() > 0 {
+		n.watch.Publish(watch.Event{Type: typ, Namespace: ns, Key: m.Key, Value: value(), Time: m.Time})
+	}
+	if l := n.changes.Load(); l != nil {
+		rec := cdc.Record{Op: m.Op, Namespace: ns, Key: m.Key, Time: m.Time}
+		if limit := l.Limits().MaxValue; limit > 0 && m.Len() > limit {
+			rec.ValueOmitted = true
+		} else {
+			rec.Value = value()
+		}
+		if !m.ExpireAt.IsZero() {
+			rec.ExpireAt = m.ExpireAt.UnixMilli()
+		}
+		l.Append(rec)
+	}
+	if r := n.replicator.Load(); r != nil && (m.Op == kv.OpPut || m.Op == kv.OpDelete) && r.Replicates(ns) {
+		rec := replication.Record{Op: m.Op, Namespace: ns, Key: m.Key, Value: value(), Meta: m.Meta, Version: m.Version}
+		if !m.ExpireAt.IsZero() {
+			rec.ExpireAt = m.ExpireAt.UnixMilli()
+		}
+		r.Enqueue(rec)
+	}
+	if w := hooks.writer.Load(); w != nil {
+		switch m.Op {
+		case kv.OpPut:
+			rec := writebehind.Record{Op: writebehind.OpPut, Namespace: ns, Key: m.Key, Value: value(), Time: m.Time}
+			if !m.ExpireAt.IsZero() {
+				rec.ExpireAt = m.ExpireAt.UnixMilli()
+			}
+			w.Enqueue(rec)
+		case kv.OpDelete:
+			w.Enqueue(writebehind.Record{Op: writebehind.OpDelete, Namespace: ns, Key: m.Key, Time: m.Time})
+		}
+	}
+}
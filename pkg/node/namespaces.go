@@ -0,0 +1,315 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/loader"
+	"github.com/ryandielhenn/zephyrcache/pkg/writebehind"
+)
+
+// DefaultNamespace is the namespace served under /kv/{key}.
+const DefaultNamespace = "default"
+
+// NamespaceConfig is the JSON document stored in etcd under
+// /zephyr/namespaces/{name}, e.g.
+//
+//	{"capacity_bytes": 16777216, "eviction": "lru", "default_ttl": "10m",
+//	 "compression": "zstd", "compress_min_bytes": 1024,
+//	 "loader_url": "http://users-api/users/{key}", "loader_ttl": "5m",
+//	 "write_behind": {"sink": "http", "url": "http://sessions-db/batch"},
+//	 "conflicts": "lww"}
+type NamespaceConfig struct {
+	CapacityBytes int                `json:"capacity_bytes"`
+	Eviction      string             `json:"eviction,omitempty"`           // lru (default), fifo or noeviction
+	DefaultTTL    string             `json:"default_ttl,omitempty"`        // Go duration, e.g. "30s"
+	Compression   string             `json:"compression,omitempty"`        // gzip, zstd or snappy
+	CompressMin   int                `json:"compress_min_bytes,omitempty"` // smaller values are stored as-is
+	LoaderURL     string             `json:"loader_url,omitempty"`         // origin URL template read through on misses
+	LoaderTTL     string             `json:"loader_ttl,omitempty"`         // TTL of loaded values, Go duration
+	WriteBehind   *WriteBehindConfig `json:"write_behind,omitempty"`       // flush writes to a backing store
+	Conflicts     string             `json:"conflicts,omitempty"`          // lww (default) or siblings
+}
+
+// WriteBehindConfig configures asynchronous flushing of a namespace's writes
+// to a backing store.
+type WriteBehindConfig struct {
+	Sink          string `json:"sink"`                     // "file" or "http"
+	Path          string `json:"path,omitempty"`           // file the file sink appends to
+	URL           string `json:"url,omitempty"`            // endpoint the http sink POSTs to
+	BatchSize     int    `json:"batch_size,omitempty"`     // keys per batch
+	FlushInterval string `json:"flush_interval,omitempty"` // Go duration
+	MaxRetries    int    `json:"max_retries,omitempty"`    // retries before dead-lettering
+	DeadLetter    string `json:"dead_letter,omitempty"`    // file failed batches are appended to
+}
+
+// namespace is a named store plus the behaviour configured for it.
+type namespace struct {
+	name   string
+	store  *kv.Store
+	loader loader.Loader // nil if misses are not read through
+	// embedded is set for loaders installed with SetLoader; config syncs
+	// leave those alone
+	embedded bool
+	// hooks is read by the store observer, which runs without nsMu
+	hooks *nsHooks
+	wbCfg *WriteBehindConfig
+	// siblings is set if concurrent writes of a key are kept as siblings
+	// instead of the last one winning
+	siblings bool
+}
+
+// nsHooks holds what the store observer of a namespace dispatches to.
+type nsHooks struct {
+	writer atomic.Pointer[writebehind.Writer]
+}
+
+// namespaceSpec is a decoded and validated NamespaceConfig.
+type namespaceSpec struct {
+	store       kv.Config
+	loader      loader.Loader
+	writeBehind *WriteBehindConfig
+	siblings    bool
+}
+
+// parseNamespaceConfig decodes and validates a namespace config document.
+func parseNamespaceConfig(data []byte) (namespaceSpec, error) {
+	var nc NamespaceConfig
+	if err := json.Unmarshal(data, &nc); err != nil {
+		return namespaceSpec{}, err
+	}
+	if nc.CapacityBytes <= 0 {
+		return namespaceSpec{}, fmt.Errorf("capacity_bytes must be positive")
+	}
+	spec := namespaceSpec{store: kv.Config{CapacityBytes: nc.CapacityBytes, Eviction: kv.Policy(nc.Eviction)}}
+	switch spec.store.Eviction {
+	case "", kv.PolicyLRU, kv.PolicyFIFO, kv.PolicyNoEviction:
+	default:
+		return namespaceSpec{}, fmt.Errorf("unknown eviction policy %q", nc.Eviction)
+	}
+	var err error
+	if spec.store.Compression, err = kv.ParseCodec(nc.Compression); err != nil {
+		return namespaceSpec{}, fmt.Errorf("invalid compression: %w", err)
+	}
+	spec.store.CompressMinBytes = nc.CompressMin
+	if spec.store.DefaultTTL, err = parseOptionalDuration(nc.DefaultTTL); err != nil {
+		return namespaceSpec{}, fmt.Errorf("invalid default_ttl: %w", err)
+	}
+	if nc.LoaderURL != "" {
+		if !strings.Contains(nc.LoaderURL, "{key}") {
+			return namespaceSpec{}, fmt.Errorf("loader_url must contain {key}")
+		}
+		ttl, err := parseOptionalDuration(nc.LoaderTTL)
+		if err != nil {
+			return namespaceSpec{}, fmt.Errorf("invalid loader_ttl: %w", err)
+		}
+		spec.loader = &loader.HTTP{URLTemplate: nc.LoaderURL, TTL: ttl, MaxBytes: DefaultMaxValueBytes}
+	}
+	if wb := nc.WriteBehind; wb != nil {
+		switch {
+		case wb.Sink == "file" && wb.Path == "":
+			return namespaceSpec{}, fmt.Errorf("write_behind: file sink needs path")
+		case wb.Sink == "http" && wb.URL == "":
+			return namespaceSpec{}, fmt.Errorf("write_behind: http sink needs url")
+		case wb.Sink != "file" && wb.Sink != "http":
+			return namespaceSpec{}, fmt.Errorf("write_behind: unknown sink %q", wb.Sink)
+		}
+		if _, err := parseOptionalDuration(wb.FlushInterval); err != nil {
+			return namespaceSpec{}, fmt.Errorf("write_behind: invalid flush_interval: %w", err)
+		}
+		spec.writeBehind = wb
+	}
+	switch nc.Conflicts {
+	case "", "lww":
+	case "siblings":
+		// loaders and write-behind deal in single values
+		if spec.loader != nil || spec.writeBehind != nil {
+			return namespaceSpec{}, fmt.Errorf("conflicts: siblings cannot be combined with loader_url or write_behind")
+		}
+		spec.siblings = true
+	default:
+		return namespaceSpec{}, fmt.Errorf("unknown conflicts mode %q", nc.Conflicts)
+	}
+	return spec, nil
+}
+
+// newWriter starts a write-behind writer for cfg, which must have been
+// validated by parseNamespaceConfig.
+func newWriter(cfg *WriteBehindConfig) *writebehind.Writer {
+	var sink writebehind.Sink
+	switch cfg.Sink {
+	case "file":
+		sink = &writebehind.FileSink{Path: cfg.Path}
+	case "http":
+		sink = &writebehind.HTTPSink{URL: cfg.URL}
+	}
+	interval, _ := parseOptionalDuration(cfg.FlushInterval)
+	return writebehind.New(sink, writebehind.Config{
+		BatchSize:      cfg.BatchSize,
+		FlushInterval:  interval,
+		MaxRetries:     cfg.MaxRetries,
+		DeadLetterPath: cfg.DeadLetter,
+	})
+}
+
+// setWriteBehind swaps the write-behind writer of ns if its config changed.
+// The old writer is flushed and closed in the background. Callers hold nsMu.
+func (ns *namespace) setWriteBehind(cfg *WriteBehindConfig) {
+	if ns.wbCfg == nil && cfg == nil || ns.wbCfg != nil && cfg != nil && *ns.wbCfg == *cfg {
+		return
+	}
+	ns.wbCfg = cfg
+	var w *writebehind.Writer
+	if cfg != nil {
+		w = newWriter(cfg)
+	}
+	if old := ns.hooks.writer.Swap(w); old != nil {
+		go old.Close(context.Background())
+	}
+}
+
+func parseOptionalDuration(v string) (time.Duration, error) {
+	if v == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(v)
+}
+
+// SyncNamespaces creates, reconfigures and drops namespaces so that they match
+// the raw configs keyed by namespace name. Invalid configs are logged and
+// leave the namespace as it was. Dropping a namespace discards its data; the
+// default namespace is never dropped and reverts to its boot config instead.
+func (n *Node) SyncNamespaces(raw map[string]string) {
+	n.nsMu.Lock()
+	defer n.nsMu.Unlock()
+
+	for name, doc := range raw {
+		spec, err := parseNamespaceConfig([]byte(doc))
+		if err != nil {
+			log.Printf("[Namespaces] ignoring config for %q: %v", name, err)
+			continue
+		}
+		ns, ok := n.namespaces[name]
+		if ok {
+			ns.store.Reconfigure(spec.store)
+		} else {
+			log.Printf("[Namespaces] creating %q cap=%d eviction=%s", name, spec.store.CapacityBytes, spec.store.Eviction)
+			ns = n.newNamespace(name, kv.NewStoreWithConfig(spec.store))
+			n.namespaces[name] = ns
+		}
+		if !ns.embedded {
+			ns.loader = spec.loader
+		}
+		ns.setWriteBehind(spec.writeBehind)
+		ns.siblings = spec.siblings
+	}
+
+	for name, ns := range n.namespaces {
+		if _, ok := raw[name]; ok {
+			continue
+		}
+		if name == DefaultNamespace {
+			ns.store.Reconfigure(n.defaultCfg)
+			if !ns.embedded {
+				ns.loader = nil
+			}
+			ns.setWriteBehind(nil)
+			ns.siblings = false
+			continue
+		}
+		log.Printf("[Namespaces] dropping %q", name)
+		ns.setWriteBehind(nil)
+		ns.store.SetObserver(nil)
+		delete(n.namespaces, name)
+	}
+}
+
+// newNamespace wraps st as namespace name and starts observing its mutations.
+func (n *Node) newNamespace(name string, st *kv.Store) *namespace {
+	ns := &namespace{name: name, store: st, hooks: &nsHooks{}}
+	hooks := ns.hooks
+	st.SetObserver(func(m kv.Mutation) { n.onMutation(name, hooks, m) })
+	st.SetClock(n.clock)
+	return ns
+}
+
+// SetLoader installs l as the read-through loader of namespace ns, taking
+// precedence over any loader_url in the namespace config. A nil l removes it.
+// It reports whether the namespace exists.
+func (n *Node) SetLoader(ns string, l loader.Loader) bool {
+	n.nsMu.Lock()
+	defer n.nsMu.Unlock()
+	nsp, ok := n.namespaces[ns]
+	if !ok {
+		return false
+	}
+	nsp.loader = l
+	nsp.embedded = l != nil
+	return true
+}
+
+// Store returns the store backing namespace ns.
+func (n *Node) Store(ns string) (*kv.Store, bool) {
+	nsp, ok := n.namespace(ns)
+	return nsp.store, ok
+}
+
+// namespace returns a snapshot of namespace name.
+func (n *Node) namespace(name string) (namespace, bool) {
+	n.nsMu.RLock()
+	defer n.nsMu.RUnlock()
+	ns, ok := n.namespaces[name]
+	if !ok {
+		return namespace{}, false
+	}
+	return *ns, true
+}
+
+// NamespaceStats returns the usage of every namespace keyed by name.
+func (n *Node) NamespaceStats() map[string]kv.Stats {
+	n.nsMu.RLock()
+	defer n.nsMu.RUnlock()
+	out := make(map[string]kv.Stats, len(n.namespaces))
+	for name, ns := range n.namespaces {
+		out[name] = ns.store.Stats()
+	}
+	return out
+}
+
+// WriteBehindStats returns the write-behind backlog of every namespace that
+// has one, keyed by namespace name.
+func (n *Node) WriteBehindStats() map[string]writebehind.Stats {
+	n.nsMu.RLock()
+	defer n.nsMu.RUnlock()
+	out := make(map[string]writebehind.Stats)
+	for name, ns := range n.namespaces {
+		if w := ns.hooks.writer.Load(); w != nil {
+			out[name] = w.Stats()
+		}
+	}
+	return out
+}
+
+// parseKeyPath splits a request path of the form /{section}/{key} or
+// /ns/{name}/{section}/{key} into its namespace and key, e.g. section "kv"
+// for /kv/{key}.
+func parseKeyPath(p, section string) (ns, key string, ok bool) {
+	if key, ok := strings.CutPrefix(p, "/"+section+"/"); ok {
+		return DefaultNamespace, key, true
+	}
+	rest, ok := strings.CutPrefix(p, "/ns/")
+	if !ok {
+		return "", "", false
+	}
+	ns, key, ok = strings.Cut(rest, "/"+section+"/")
+	if !ok || ns == "" || strings.Contains(ns, "/") {
+		return "", "", false
+	}
+	return ns, key, true
+}
@@ -0,0 +1,145 @@
+package node
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/loader"
+	"github.com/ryandielhenn/zephyrcache/pkg/ring"
+)
+
+func TestParseKeyPath(t *testing.T) {
+	cases := []struct {
+		path, ns, key string
+		ok            bool
+	}{
+		{"/kv/foo", DefaultNamespace, "foo", true},
+		{"/kv/a/b", DefaultNamespace, "a/b", true},
+		{"/ns/users/kv/42", "users", "42", true},
+		{"/ns/users/kv/a/kv/b", "users", "a/kv/b", true},
+		{"/ns//kv/42", "", "", false},
+		{"/ns/a/b/kv/42", "", "", false},
+		{"/other/foo", "", "", false},
+		{"/ns/users/ttl/42", "", "", false},
+	}
+	for _, c := range cases {
+		ns, key, ok := parseKeyPath(c.path, "kv")
+		if ns != c.ns || key != c.key || ok != c.ok {
+			t.Errorf("parseKeyPath(%q) = (%q,%q,%v), want (%q,%q,%v)", c.path, ns, key, ok, c.ns, c.key, c.ok)
+		}
+	}
+}
+
+func TestParseNamespaceConfig(t *testing.T) {
+	spec, err := parseNamespaceConfig([]byte(`{"capacity_bytes": 1024, "eviction": "fifo", "default_ttl": "1m"}`))
+	if err != nil {
+		t.Fatalf("parseNamespaceConfig: %v", err)
+	}
+	want := kv.Config{CapacityBytes: 1024, Eviction: kv.PolicyFIFO, DefaultTTL: time.Minute}
+	if spec.store != want || spec.loader != nil {
+		t.Fatalf("spec = %+v, want store %+v and no loader", spec, want)
+	}
+
+	spec, err = parseNamespaceConfig([]byte(`{"capacity_bytes": 1, "loader_url": "http://origin/{key}", "loader_ttl": "5m"}`))
+	if err != nil {
+		t.Fatalf("parseNamespaceConfig with loader: %v", err)
+	}
+	if l, ok := spec.loader.(*loader.HTTP); !ok || l.URLTemplate != "http://origin/{key}" || l.TTL != 5*time.Minute {
+		t.Fatalf("loader = %#v", spec.loader)
+	}
+
+	for _, doc := range []string{
+		`{"capacity_bytes": 0}`,
+		`{"capacity_bytes": 1, "eviction": "random"}`,
+		`{"capacity_bytes": 1, "default_ttl": "soon"}`,
+		`{"capacity_bytes": 1, "compression": "lz4"}`,
+		`{"capacity_bytes": 1, "loader_url": "http://origin/static"}`,
+		`{"capacity_bytes": 1, "write_behind": {"sink": "file"}}`,
+		`{"capacity_bytes": 1, "write_behind": {"sink": "kafka"}}`,
+		`{"capacity_bytes": 1, "conflicts": "crdt"}`,
+		`{"capacity_bytes": 1, "conflicts": "siblings", "loader_url": "http://origin/{key}"}`,
+		`not json`,
+	} {
+		if _, err := parseNamespaceConfig([]byte(doc)); err == nil {
+			t.Errorf("parseNamespaceConfig(%s) succeeded, want error", doc)
+		}
+	}
+}
+
+func TestSyncNamespaces(t *testing.T) {
+	def := kv.NewStore(1 << 20)
+	n := NewNode(def, ring.New(16, nil), "self:8080")
+
+	n.SyncNamespaces(map[string]string{
+		"users":          `{"capacity_bytes": 100}`,
+		DefaultNamespace: `{"capacity_bytes": 200}`,
+		"broken":         `{}`,
+	})
+	if _, ok := n.Store("users"); !ok {
+		t.Fatalf("users namespace not created")
+	}
+	if _, ok := n.Store("broken"); ok {
+		t.Fatalf("invalid namespace config should be ignored")
+	}
+	if got := def.Config().CapacityBytes; got != 200 {
+		t.Fatalf("default capacity = %d, want 200", got)
+	}
+
+	n.SyncNamespaces(map[string]string{})
+	if _, ok := n.Store("users"); ok {
+		t.Fatalf("users namespace not dropped")
+	}
+	st, ok := n.Store(DefaultNamespace)
+	if !ok || st != def {
+		t.Fatalf("default namespace must survive config removal")
+	}
+	if got := def.Config().CapacityBytes; got != 1<<20 {
+		t.Fatalf("default capacity = %d, want boot value %d", got, 1<<20)
+	}
+}
+
+func TestWriteBehindFlushesOwnerWrites(t *testing.T) {
+	n := newTestNode(t)
+	path := filepath.Join(t.TempDir(), "sessions.jsonl")
+	n.SyncNamespaces(map[string]string{
+		"sessions": `{"capacity_bytes": 1024, "write_behind": {"sink": "file", "path": "` + path + `", "flush_interval": "10ms"}}`,
+	})
+
+	for _, req := range []*http.Request{
+		httptest.NewRequest(http.MethodPut, "/ns/sessions/kv/s1", strings.NewReader("a")),
+		httptest.NewRequest(http.MethodPut, "/ns/sessions/kv/s2", strings.NewReader("b")),
+		httptest.NewRequest(http.MethodDelete, "/ns/sessions/kv/s1", nil),
+	} {
+		rec := httptest.NewRecorder()
+		if req.Method == http.MethodDelete {
+			n.Del(rec, req)
+		} else {
+			n.Put(rec, req)
+		}
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("%s %s = %d", req.Method, req.URL, rec.Code)
+		}
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		data, _ := os.ReadFile(path)
+		if lines := strings.Count(string(data), "\n"); lines >= 2 {
+			if !strings.Contains(string(data), `"op":"delete","namespace":"sessions","key":"s1"`) ||
+				!strings.Contains(string(data), `"key":"s2"`) {
+				t.Fatalf("unexpected write-behind output:\n%s", data)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("write-behind did not flush, file has:\n%s", data)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,18 +1,49 @@
 package node
 
 import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/cdc"
 	"github.com/ryandielhenn/zephyrcache/pkg/gossip"
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
 	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/loader"
+	"github.com/ryandielhenn/zephyrcache/pkg/replication"
 	"github.com/ryandielhenn/zephyrcache/pkg/ring"
+	"github.com/ryandielhenn/zephyrcache/pkg/watch"
+)
+
+// DefaultMaxValueBytes is the largest value a node accepts unless
+// SetMaxValueBytes says otherwise.
+const DefaultMaxValueBytes = 64 << 20
+
+// Defaults of the change feed once SetCDCBuffer turns it on: how many
+// records it holds, how many value bytes across them, and the largest value
+// recorded with its write; larger writes are recorded without their value.
+const (
+	DefaultCDCBuffer   = 10000
+	DefaultCDCBytes    = 64 << 20
+	DefaultCDCMaxValue = 64 << 10
 )
 
 type Node struct {
-	kv    *kv.Store
+	kv    *kv.Store // store of the default namespace
 	ring  *ring.HashRing
 	peers []string
 	addr  string
 	gsp   gossip.Gossip
 	rf    int
+
+	nsMu       sync.RWMutex
+	namespaces map[string]*namespace
+	defaultCfg kv.Config // boot config of the default namespace
+	loads      loader.Group
+	maxValue   atomic.Int64                           // largest accepted value in bytes
+	watch      watch.Hub                              // keyspace events of the local stores
+	changes    atomic.Pointer[cdc.Log]                // change feed of the local stores, nil until enabled
+	replicator atomic.Pointer[replication.Replicator] // mirror to another cluster, nil if none
+	clock      *hlc.Clock                             // versions writes to every local store
 }
 
 func NewNode(store *kv.Store, r *ring.HashRing, addr string) *Node {
@@ -20,12 +51,40 @@ func NewNode(store *kv.Store, r *ring.HashRing, addr string) *Node {
 }
 
 func NewNodeRF(store *kv.Store, r *ring.HashRing, addr string, replicationFactor int) *Node {
-	return &Node{
-		kv:   store,
-		ring: r,
-		addr: addr,
-		rf:   replicationFactor,
+	n := &Node{
+		kv:         store,
+		ring:       r,
+		addr:       addr,
+		rf:         replicationFactor,
+		defaultCfg: store.Config(),
+		clock:      hlc.NewClock(),
+	}
+	n.namespaces = map[string]*namespace{DefaultNamespace: n.newNamespace(DefaultNamespace, store)}
+	n.maxValue.Store(DefaultMaxValueBytes)
+	return n
+}
+
+// SetCDCBuffer turns on the change feed, replacing it with an empty one
+// holding the last capacity mutations and at most DefaultCDCBytes of values,
+// or turns it off if capacity is 0. The feed is off until then.
+func (n *Node) SetCDCBuffer(capacity int) {
+	n.SetCDCLimits(cdc.Limits{Records: capacity, Bytes: DefaultCDCBytes, MaxValue: DefaultCDCMaxValue})
+}
+
+// SetCDCLimits is SetCDCBuffer with every bound of the feed chosen by the
+// caller.
+func (n *Node) SetCDCLimits(lim cdc.Limits) {
+	if lim.Records <= 0 {
+		n.changes.Store(nil)
+		return
 	}
+	n.changes.Store(cdc.NewWithLimits(lim))
+}
+
+// SetMaxValueBytes sets the largest value PUTs may carry; larger ones are
+// rejected with 413 Request Entity Too Large.
+func (n *Node) SetMaxValueBytes(limit int64) {
+	n.maxValue.Store(limit)
 }
 
 func (n *Node) AddPeer(id string, hostport string) {
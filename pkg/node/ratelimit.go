@@ -0,0 +1,103 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// rateLimitResponse is the outcome of a rate limit check.
+type rateLimitResponse struct {
+	Allowed      bool  `json:"allowed"`
+	Limit        int   `json:"limit"`
+	Remaining    int   `json:"remaining"`
+	ResetMs      int64 `json:"reset_ms"` // until the full limit is available again
+	RetryAfterMs int64 `json:"retry_after_ms,omitempty"`
+}
+
+// RateLimit serves POST /ratelimit/{key}?limit=n&window=s: it counts a
+// request against the limit under key on the key's owner and answers 200 if
+// it is allowed and 429 if not. ?algorithm= is token_bucket (default) or
+// sliding_window, ?cost= how many requests this one counts as (default 1),
+// and the window is in seconds, or in milliseconds with ?window_ms=.
+//
+// Besides the JSON result, the response carries the RateLimit-Limit,
+// RateLimit-Remaining, RateLimit-Reset and RateLimit-Policy headers of the
+// IETF RateLimit header fields draft, and Retry-After when denied, so a
+// gateway can pass them straight on to its caller.
+func (n *Node) RateLimit(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	ns, key, ok := n.routeKey(w, req, "ratelimit")
+	if !ok {
+		return
+	}
+	rl, cost, err := parseRateLimit(req)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	res, err := ns.store.Allow(key, rl, cost)
+	switch {
+	case errors.Is(err, kv.ErrInvalidRateLimit):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	case err != nil:
+		writeStoreError(w, key, err)
+		return
+	}
+
+	h := w.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(rl.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.Reset), 10))
+	h.Set("RateLimit-Policy", fmt.Sprintf("%d;w=%d", rl.Limit, ceilSeconds(rl.Window)))
+	out := rateLimitResponse{
+		Allowed:   res.Allowed,
+		Limit:     rl.Limit,
+		Remaining: res.Remaining,
+		ResetMs:   res.Reset.Milliseconds(),
+	}
+	status := http.StatusOK
+	if !res.Allowed {
+		status = http.StatusTooManyRequests
+		h.Set("Retry-After", strconv.FormatInt(ceilSeconds(res.RetryAfter), 10))
+		out.RetryAfterMs = max(res.RetryAfter.Milliseconds(), 1)
+	}
+	writeJSON(w, status, out)
+}
+
+// parseRateLimit reads the policy and cost of a rate limit check.
+func parseRateLimit(req *http.Request) (kv.RateLimit, int, error) {
+	q := req.URL.Query()
+	rl := kv.RateLimit{Algorithm: kv.RateAlgorithm(q.Get("algorithm"))}
+	if rl.Algorithm == "" {
+		rl.Algorithm = kv.TokenBucket
+	}
+	var err error
+	if rl.Limit, err = strconv.Atoi(q.Get("limit")); err != nil || rl.Limit <= 0 {
+		return rl, 0, errors.New("a positive limit is required")
+	}
+	if rl.Window, err = parseDuration(q, "window"); err != nil || rl.Window <= 0 {
+		return rl, 0, errors.New("a positive window is required")
+	}
+	cost := 1
+	if v := q.Get("cost"); v != "" {
+		if cost, err = strconv.Atoi(v); err != nil {
+			return rl, 0, errors.New("invalid cost")
+		}
+	}
+	return rl, cost, nil
+}
+
+// ceilSeconds rounds d up to whole seconds, as the RateLimit headers and
+// Retry-After count them.
+func ceilSeconds(d time.Duration) int64 {
+	return int64((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,42 @@
+package node
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestRateLimitCountsOnOwner(t *testing.T) {
+	c := newTestCluster(t, 2)
+	owner, other := c.owner(t, "api:alice")
+
+	// requests through either node count against the same limit
+	for i, node := range []int{other, owner, other} {
+		resp, err := http.Post(c.url(node, "/ratelimit/api:alice?limit=3&window=60&algorithm=sliding_window"), "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || resp.Header.Get("RateLimit-Remaining") != strconv.Itoa(2-i) {
+			t.Fatalf("request %d = %d remaining %q", i, resp.StatusCode, resp.Header.Get("RateLimit-Remaining"))
+		}
+	}
+
+	resp, err := http.Post(c.url(owner, "/ratelimit/api:alice?limit=3&window=60&algorithm=sliding_window"), "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	h := resp.Header
+	if resp.StatusCode != http.StatusTooManyRequests || h.Get("Retry-After") == "" ||
+		h.Get("RateLimit-Limit") != "3" || h.Get("RateLimit-Policy") != "3;w=60" || h.Get("RateLimit-Reset") == "" {
+		t.Fatalf("request over the limit = %d %v", resp.StatusCode, h)
+	}
+
+	if status, _ := doRequest(t, http.MethodPost, c.url(owner, "/ratelimit/api:bob?limit=3"), ""); status != http.StatusBadRequest {
+		t.Fatalf("check without a window = %d, want 400", status)
+	}
+	if status, _ := doRequest(t, http.MethodGet, c.url(owner, "/ratelimit/api:alice"), ""); status != http.StatusMethodNotAllowed {
+		t.Fatalf("GET = %d, want 405", status)
+	}
+}
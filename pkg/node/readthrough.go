@@ -0,0 +1,47 @@
+package node
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/loader"
+)
+
+// loadTimeout bounds a single origin fetch.
+const loadTimeout = 10 * time.Second
+
+// readThrough fetches key from the namespace's loader after a miss on the
+// owner, stores it and returns it. Concurrent misses for the same key share a
+// single origin call.
+func (n *Node) readThrough(ctx context.Context, ns namespace, key string) (kv.Item, error) {
+	res, err, shared := n.loads.Do(ns.name+"/"+key, func() (loader.Result, error) {
+		// the load is shared, so it must not be cancelled with the first caller
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+
+		res, err := ns.loader.Load(ctx, key)
+		if err != nil {
+			return res, err
+		}
+		if limit := n.maxValue.Load(); int64(len(res.Value)) > limit {
+			return loader.Result{}, fmt.Errorf("%w: %d bytes, the limit is %d", loader.ErrTooLarge, len(res.Value), limit)
+		}
+		if err := ns.store.PutWithOptions(key, res.Value, kv.PutOptions{TTL: res.TTL, Meta: res.Meta}); err != nil {
+			log.Printf("[ReadThrough] ns=%q key=%q not stored: %v", ns.name, key, err)
+		}
+		return res, nil
+	})
+	if err != nil {
+		return kv.Item{}, err
+	}
+	log.Printf("[ReadThrough] ns=%q key=%q loaded shared=%v", ns.name, key, shared)
+
+	it := kv.Item{Value: res.Value, Meta: res.Meta}
+	if info, ok := ns.store.TTL(key); ok {
+		it.TTLInfo = info
+	}
+	return it, nil
+}
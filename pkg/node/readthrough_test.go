@@ -0,0 +1,64 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/loader"
+	"github.com/ryandielhenn/zephyrcache/pkg/ring"
+)
+
+// newTestNode returns a single node ring whose only member is the node itself.
+func newTestNode(t *testing.T) *Node {
+	t.Helper()
+	r := ring.New(16, nil)
+	r.Add("self", "self:8080")
+	return NewNode(kv.NewStore(1<<20), r, "self:8080")
+}
+
+func TestGetReadsThroughOnMiss(t *testing.T) {
+	n := newTestNode(t)
+	var loads atomic.Int32
+	n.SetLoader(DefaultNamespace, loader.Func(func(ctx context.Context, key string) (loader.Result, error) {
+		loads.Add(1)
+		time.Sleep(20 * time.Millisecond)
+		if key == "missing" {
+			return loader.Result{}, loader.ErrNotFound
+		}
+		return loader.Result{Value: []byte("loaded:" + key), TTL: time.Minute}, nil
+	}))
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			n.Get(rec, httptest.NewRequest(http.MethodGet, "/kv/user:1", nil))
+			if rec.Code != http.StatusOK || rec.Body.String() != "loaded:user:1" {
+				t.Errorf("Get = %d %q", rec.Code, rec.Body.String())
+			}
+		}()
+	}
+	wg.Wait()
+	if got := loads.Load(); got != 1 {
+		t.Fatalf("origin loaded %d times, want 1", got)
+	}
+
+	// the loaded value is now cached
+	if v, ok := n.kv.Get("user:1"); !ok || string(v) != "loaded:user:1" {
+		t.Fatalf("loaded value not stored: %q,%v", v, ok)
+	}
+
+	rec := httptest.NewRecorder()
+	n.Get(rec, httptest.NewRequest(http.MethodGet, "/kv/missing", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("Get(missing) = %d, want 404", rec.Code)
+	}
+}
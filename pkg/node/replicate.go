@@ -0,0 +1,168 @@
+package node
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/replication"
+)
+
+// replicateResponse counts what became of the records of an ingested batch.
+type replicateResponse struct {
+	Applied int `json:"applied"`
+	// Ignored records were older than the key's current write, or deleted
+	// a key that was already gone.
+	Ignored int `json:"ignored"`
+	Skipped int `json:"skipped"` // namespace not configured here, or unknown op
+	Failed  int `json:"failed"`  // rejected by the store, e.g. a full namespace
+}
+
+func (r *replicateResponse) add(o replicateResponse) {
+	r.Applied += o.Applied
+	r.Ignored += o.Ignored
+	r.Skipped += o.Skipped
+	r.Failed += o.Failed
+}
+
+// maxReplicateBatch caps the body Replicate reads. It is a variable so that
+// tests need not send hundreds of megabytes.
+var maxReplicateBatch int64 = replication.MaxBatchBytes
+
+// SetReplicator mirrors the writes of the namespaces r replicates to r's
+// remote cluster. A nil r stops mirroring; the caller closes the old one.
+func (n *Node) SetReplicator(r *replication.Replicator) {
+	n.replicator.Store(r)
+}
+
+// Replicate ingests a batch of writes mirrored from another cluster, the JSON
+// array of replication.Record a Replicator POSTs. Every record is applied on
+// its key's owner unless the key holds a write at least as new, so the last
+// writer wins whatever order writes arrive in. If any owner cannot be reached
+// the batch fails with 502 and the sender retries it; the records already
+// applied are then ignored. Batches over replication.MaxBatchBytes answer
+// 413.
+func (n *Node) Replicate(w http.ResponseWriter, req *http.Request) {
+	n.witness(req)
+	var recs []replication.Record
+	body := http.MaxBytesReader(w, req.Body, maxReplicateBatch)
+	if err := json.NewDecoder(body).Decode(&recs); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("batch exceeds %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, fmt.Sprintf("invalid batch: %v", err), http.StatusBadRequest)
+		return
+	}
+	if isLocal(req) {
+		writeJSON(w, http.StatusOK, n.applyReplicated(recs))
+		return
+	}
+
+	groups := make(map[string][]replication.Record)
+	self := NormalizeHostPort(n.addr, "8080")
+	for _, rec := range recs {
+		owner, _, ok := n.OwnerForKey(rec.Key)
+		if !ok {
+			http.Error(w, "no owner for key", http.StatusServiceUnavailable)
+			return
+		}
+		groups[owner] = append(groups[owner], rec)
+	}
+
+	var (
+		mu     sync.Mutex
+		total  replicateResponse
+		failed error
+		wg     sync.WaitGroup
+	)
+	for owner, sub := range groups {
+		if owner == self {
+			res := n.applyReplicated(sub)
+			mu.Lock()
+			total.add(res)
+			mu.Unlock()
+			continue
+		}
+		wg.Add(1)
+		go func(owner string, sub []replication.Record) {
+			defer wg.Done()
+			data, err := json.Marshal(sub)
+			var res replicateResponse
+			if err == nil {
+				var raw []byte
+				if _, raw, err = n.sendLocal(req.Context(), http.MethodPost, owner, replication.IngestPath, data); err == nil {
+					err = json.Unmarshal(raw, &res)
+				}
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				failed = fmt.Errorf("%s: %w", owner, err)
+				return
+			}
+			total.add(res)
+		}(owner, sub)
+	}
+	wg.Wait()
+
+	if failed != nil {
+		http.Error(w, failed.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, total)
+}
+
+// applyReplicated applies mirrored writes to the local stores.
+func (n *Node) applyReplicated(recs []replication.Record) replicateResponse {
+	var res replicateResponse
+	for _, rec := range recs {
+		ns, ok := n.namespace(rec.Namespace)
+		if !ok {
+			res.Skipped++
+			continue
+		}
+		if ns.siblings && rec.Op == kv.OpPut {
+			log.Printf("[Replicate] put %s/%q failed: %v", rec.Namespace, rec.Key, errSiblingsNamespace)
+			res.Failed++
+			continue
+		}
+		switch rec.Op {
+		case kv.OpPut:
+			opts := kv.PutOptions{Meta: rec.Meta, Version: rec.Version}
+			if rec.ExpireAt != 0 {
+				opts.ExpireAt = time.UnixMilli(rec.ExpireAt)
+			}
+			applied, err := ns.store.PutIfNewer(rec.Key, rec.Value, opts)
+			switch {
+			case err != nil:
+				log.Printf("[Replicate] put %s/%q failed: %v", rec.Namespace, rec.Key, err)
+				res.Failed++
+			case applied:
+				res.Applied++
+			default:
+				res.Ignored++
+			}
+		case kv.OpDelete:
+			applied, err := ns.store.DeleteIfNewer(rec.Key, rec.Version)
+			switch {
+			case err != nil:
+				log.Printf("[Replicate] delete %s/%q failed: %v", rec.Namespace, rec.Key, err)
+				res.Failed++
+			case applied:
+				res.Applied++
+			default:
+				res.Ignored++
+			}
+		default:
+			res.Skipped++
+		}
+	}
+	return res
+}
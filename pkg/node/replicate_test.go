@@ -0,0 +1,68 @@
+package node
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/replication"
+)
+
+func TestReplicationBetweenClusters(t *testing.T) {
+	east, west := newTestCluster(t, 2), newTestCluster(t, 2)
+	r := replication.New(replication.Config{
+		Target:        west.url(1, ""),
+		Namespaces:    []string{DefaultNamespace},
+		FlushInterval: time.Hour, // ship only on Close
+	})
+	for _, n := range east.nodes {
+		n.SetReplicator(r)
+	}
+
+	// west's write of gone is older than east's delete of it, and east's
+	// write of b older than west's
+	doRequest(t, http.MethodPut, west.url(0, "/kv/gone"), "west")
+	time.Sleep(time.Millisecond)
+	doRequest(t, http.MethodPut, east.url(0, "/kv/a"), "east")
+	doRequest(t, http.MethodPut, east.url(1, "/kv/b"), "east")
+	doRequest(t, http.MethodPut, east.url(0, "/kv/gone"), "east")
+	doRequest(t, http.MethodDelete, east.url(1, "/kv/gone"), "")
+	time.Sleep(time.Millisecond)
+	doRequest(t, http.MethodPut, west.url(0, "/kv/b"), "west")
+	if st := r.Stats(); st.Pending != 3 || st.Lag <= 0 {
+		t.Fatalf("stats before shipping = %+v, want 3 pending with lag", st)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r.Close(ctx)
+	if st := r.Stats(); st.Pending != 0 || st.Shipped != 3 {
+		t.Fatalf("stats after shipping = %+v", st)
+	}
+
+	for key, want := range map[string]string{"a": "east", "b": "west"} {
+		if status, body := doRequest(t, http.MethodGet, west.url(0, "/kv/"+key), ""); status != http.StatusOK || body != want {
+			t.Fatalf("west GET %s = %d %q, want %q", key, status, body, want)
+		}
+	}
+	if status, _ := doRequest(t, http.MethodGet, west.url(0, "/kv/gone"), ""); status != http.StatusNotFound {
+		t.Fatalf("west GET gone = %d, want 404 after east's newer delete", status)
+	}
+}
+
+func TestReplicateRejectsOversizedBatches(t *testing.T) {
+	defer func(limit int64) { maxReplicateBatch = limit }(maxReplicateBatch)
+	maxReplicateBatch = 1 << 10
+	c := newTestCluster(t, 1)
+
+	big := `[{"op": "put", "ns": "default", "key": "k", "value": "` + strings.Repeat("A", 2<<10) + `", "version": 1}]`
+	if status, body := doRequest(t, http.MethodPost, c.url(0, replication.IngestPath), big); status != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized batch = %d %s, want 413", status, body)
+	}
+	small := `[{"op": "put", "ns": "default", "key": "k", "value": "YQ==", "version": 1}]`
+	if status, body := doRequest(t, http.MethodPost, c.url(0, replication.IngestPath), small); status != http.StatusOK {
+		t.Fatalf("batch under the limit = %d %s", status, body)
+	}
+}
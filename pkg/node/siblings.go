@@ -0,0 +1,122 @@
+package node
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+	"github.com/ryandielhenn/zephyrcache/pkg/vclock"
+)
+
+// HeaderContext carries the opaque causal context of a key in a namespace
+// with "conflicts": "siblings". GET returns the context of every sibling it
+// read; a PUT or DELETE sending it back replaces or removes those siblings,
+// and only those.
+const HeaderContext = "X-Zephyr-Context"
+
+// errSiblingsNamespace rejects writes that would store a plain value in a
+// siblings namespace, where only PUT and DELETE of /kv/ keep the causal
+// context of a key.
+var errSiblingsNamespace = errors.New("not supported in a siblings namespace; PUT each key with its context")
+
+// siblingsResponse is the body of a GET that found concurrent values.
+type siblingsResponse struct {
+	Siblings [][]byte `json:"siblings"` // base64 encoded, oldest first
+	Context  string   `json:"context"`
+}
+
+// getSiblings answers a GET of key in a siblings namespace: the value itself
+// as application/octet-stream if the key has one, or 300 Multiple Choices
+// listing its siblings as JSON for the client to resolve.
+func (n *Node) getSiblings(w http.ResponseWriter, req *http.Request, st *kv.Store, key string) {
+	sibs, err := st.Siblings(key)
+	switch {
+	case errors.Is(err, kv.ErrWrongType):
+		http.Error(w, fmt.Sprintf("%q was not written as siblings", key), http.StatusConflict)
+		return
+	case len(sibs) == 0:
+		http.NotFound(w, req)
+		return
+	}
+	clocks := make([]vclock.Clock, len(sibs))
+	for i, sib := range sibs {
+		clocks[i] = sib.Clock
+	}
+	ctx := vclock.Merge(clocks...).Encode()
+	w.Header().Set(HeaderContext, ctx)
+	if info, ok := st.TTL(key); ok {
+		setTTLHeaders(w.Header(), info)
+	}
+
+	if len(sibs) == 1 {
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Header().Set("Content-Length", strconv.Itoa(len(sibs[0].Value)))
+		w.Write(sibs[0].Value)
+		return
+	}
+	res := siblingsResponse{Context: ctx}
+	for _, sib := range sibs {
+		res.Siblings = append(res.Siblings, sib.Value)
+	}
+	writeJSON(w, http.StatusMultipleChoices, res)
+}
+
+// putSibling answers a PUT of key in a siblings namespace. The value
+// replaces the siblings covered by the request's context and is kept
+// alongside the rest. The context of the new value is returned.
+func (n *Node) putSibling(w http.ResponseWriter, req *http.Request, st *kv.Store, key string) {
+	if req.Header.Get(HeaderVersion) != "" {
+		http.Error(w, HeaderVersion+" is not supported in a siblings namespace", http.StatusBadRequest)
+		return
+	}
+	ctx, err := vclock.Decode(req.Header.Get(HeaderContext))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	val, err := io.ReadAll(req.Body)
+	var clock vclock.Clock
+	if err == nil {
+		clock, err = st.PutSibling(key, val, ctx, NormalizeHostPort(n.addr, "8080"))
+	}
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, kv.ErrFull):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+		return
+	case errors.Is(err, kv.ErrWrongType):
+		http.Error(w, fmt.Sprintf("%q was not written as siblings, delete it first", key), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set(HeaderContext, clock.Encode())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// delSiblings answers a DELETE of key in a siblings namespace carrying a
+// context: the siblings it covers are removed, and 409 reports any written
+// concurrently that are left. A DELETE without a context removes them all.
+func (n *Node) delSiblings(w http.ResponseWriter, st *kv.Store, key, token string) {
+	ctx, err := vclock.Decode(token)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	left, err := st.DeleteSiblings(key, ctx)
+	switch {
+	case errors.Is(err, kv.ErrWrongType):
+		http.Error(w, fmt.Sprintf("%q was not written as siblings", key), http.StatusConflict)
+	case left > 0:
+		http.Error(w, fmt.Sprintf("%d concurrent siblings of %q remain", left, key), http.StatusConflict)
+	default:
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,115 @@
+package node
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func contextRequest(t *testing.T, method, url, body, ctx string) (int, string, string) {
+	t.Helper()
+	req, _ := http.NewRequest(method, url, strings.NewReader(body))
+	if ctx != "" {
+		req.Header.Set(HeaderContext, ctx)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, url, err)
+	}
+	defer resp.Body.Close()
+	data, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(data), resp.Header.Get(HeaderContext)
+}
+
+func TestSiblingsKeepConcurrentWrites(t *testing.T) {
+	c := newTestCluster(t, 2)
+	for _, n := range c.nodes {
+		n.SyncNamespaces(map[string]string{"carts": `{"capacity_bytes": 65536, "conflicts": "siblings"}`})
+	}
+	owner, other := c.owner(t, "cart")
+	url := func(i int) string { return c.url(i, "/ns/carts/kv/cart") }
+
+	// two clients read nothing and write concurrently
+	contextRequest(t, http.MethodPut, url(owner), "apples", "")
+	contextRequest(t, http.MethodPut, url(other), "pears", "")
+
+	status, body, ctx := contextRequest(t, http.MethodGet, url(other), "", "")
+	var res siblingsResponse
+	json.Unmarshal([]byte(body), &res)
+	if status != http.StatusMultipleChoices || len(res.Siblings) != 2 || ctx == "" || res.Context != ctx {
+		t.Fatalf("GET of concurrent writes = %d %s (context %q), want 300 with two siblings", status, body, ctx)
+	}
+
+	// writing back with the context resolves the conflict
+	if status, _, _ := contextRequest(t, http.MethodPut, url(other), "apples,pears", ctx); status != http.StatusNoContent {
+		t.Fatalf("resolving PUT = %d", status)
+	}
+	status, body, ctx = contextRequest(t, http.MethodGet, url(owner), "", "")
+	if status != http.StatusOK || body != "apples,pears" {
+		t.Fatalf("GET after resolving = %d %q", status, body)
+	}
+
+	// a write racing the delete survives it
+	contextRequest(t, http.MethodPut, url(owner), "plums", "")
+	if status, _, _ := contextRequest(t, http.MethodDelete, url(other), "", ctx); status != http.StatusConflict {
+		t.Fatalf("DELETE with a concurrent sibling = %d, want 409", status)
+	}
+	if status, body, _ := contextRequest(t, http.MethodGet, url(owner), "", ""); status != http.StatusOK || body != "plums" {
+		t.Fatalf("GET after DELETE = %d %q, want the concurrent write", status, body)
+	}
+}
+
+func TestSiblingsGetSetsContentType(t *testing.T) {
+	c := newTestCluster(t, 1)
+	c.nodes[0].SyncNamespaces(map[string]string{"carts": `{"capacity_bytes": 65536, "conflicts": "siblings"}`})
+	url := c.url(0, "/ns/carts/kv/cart")
+	contextRequest(t, http.MethodPut, url, "apples", "")
+
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusOK || got != "application/octet-stream" {
+		t.Fatalf("GET of a single sibling = %d with Content-Type %q", resp.StatusCode, got)
+	}
+
+	contextRequest(t, http.MethodPut, url, "pears", "")
+	resp, err = http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if got := resp.Header.Get("Content-Type"); resp.StatusCode != http.StatusMultipleChoices || got != "application/json" {
+		t.Fatalf("GET of two siblings = %d with Content-Type %q", resp.StatusCode, got)
+	}
+}
+
+func TestSiblingsRejectWritesWithoutContext(t *testing.T) {
+	c := newTestCluster(t, 2)
+	for _, n := range c.nodes {
+		n.SyncNamespaces(map[string]string{"carts": `{"capacity_bytes": 65536, "conflicts": "siblings"}`})
+	}
+	owner, _ := c.owner(t, "cart")
+	for _, tc := range []struct{ method, path, body string }{
+		{http.MethodPost, "/mset?ns=carts", `{"items": [{"key": "cart", "value": "YQ=="}]}`},
+		{http.MethodPost, "/txn?ns=carts", `{"ops": [{"op": "put", "key": "cart", "value": "YQ=="}]}`},
+		{http.MethodPut, "/ns/carts/json/cart", `{"a": 1}`},
+		{http.MethodPatch, "/ns/carts/json/cart", `[{"op": "add", "path": "/a", "value": 1}]`},
+	} {
+		if status, body := doRequest(t, tc.method, c.url(owner, tc.path), tc.body); status != http.StatusBadRequest {
+			t.Errorf("%s %s = %d %s, want 400", tc.method, tc.path, status, body)
+		}
+	}
+
+	status, body := doRequest(t, http.MethodPost, c.url(owner, "/replicate"),
+		`[{"op": "put", "ns": "carts", "key": "cart", "value": "YQ==", "version": 1}]`)
+	if status != http.StatusOK || !strings.Contains(body, `"failed":1`) {
+		t.Fatalf("replicated put = %d %s, want it failed", status, body)
+	}
+	if status, body := doRequest(t, http.MethodGet, c.url(owner, "/ns/carts/kv/cart"), ""); status != http.StatusNotFound {
+		t.Fatalf("GET after rejected writes = %d %s, want 404", status, body)
+	}
+}
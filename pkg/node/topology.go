@@ -0,0 +1,121 @@
+package node
+
+import (
+	"maps"
+	"math"
+	"net/http"
+	"slices"
+	"strconv"
+)
+
+// HeaderRingEpoch carries the epoch of the ring the responding node routes
+// by, ring.HashRing.Epoch in hex, on every response. A client whose own ring
+// has a different epoch should fetch /ring again.
+const HeaderRingEpoch = "X-Zephyr-Ring-Epoch"
+
+// HeaderRedirect asks a node that does not own the requested key to answer
+// 307 Temporary Redirect to the owner instead of forwarding the request, so
+// that a client routing by a stale ring finds out.
+const HeaderRedirect = "X-Zephyr-Redirect"
+
+// ringResponse is what a client needs to build the node's ring.
+type ringResponse struct {
+	Epoch    string            `json:"epoch"`
+	Replicas int               `json:"replicas"`
+	Members  map[string]string `json:"members"` // node ID -> host:port
+}
+
+// Ring serves GET /ring, the members of the ring the node routes by.
+func (n *Node) Ring(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, ringResponse{
+		Epoch:    n.RingEpoch(),
+		Replicas: n.ring.Replicas(),
+		Members:  n.ring.Nodes(),
+	})
+}
+
+// RingEpoch returns the epoch of the node's ring as sent in HeaderRingEpoch.
+func (n *Node) RingEpoch() string {
+	return strconv.FormatUint(n.ring.Epoch(), 16)
+}
+
+// WithRingEpoch sets HeaderRingEpoch on every response of h.
+func (n *Node) WithRingEpoch(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set(HeaderRingEpoch, n.RingEpoch())
+		h.ServeHTTP(w, req)
+	})
+}
+
+// member is a node of the ring as /cluster describes it.
+type member struct {
+	ID           string   `json:"id"`
+	Addr         string   `json:"addr"`
+	Self         bool     `json:"self,omitempty"`
+	OwnershipPct float64  `json:"ownership_pct"` // share of the hash space the node owns
+	Tokens       []uint32 `json:"tokens,omitempty"`
+}
+
+// clusterResponse describes the ring a node routes by.
+type clusterResponse struct {
+	Epoch             string   `json:"epoch"`
+	Replicas          int      `json:"replicas"` // tokens per node
+	ReplicationFactor int      `json:"replication_factor"`
+	Members           []member `json:"members"` // ordered by ID
+}
+
+// Cluster serves GET /cluster, the ring the node routes by: every member
+// with its tokens and share of the keys, the ring epoch and the replication
+// factor. Comparing it across nodes shows whether they agree on the ring.
+func (n *Node) Cluster(w http.ResponseWriter, _ *http.Request) {
+	nodes := n.ring.Nodes()
+	own := n.ring.Ownership()
+	self := NormalizeHostPort(n.addr, "8080")
+	res := clusterResponse{
+		Epoch:             n.RingEpoch(),
+		Replicas:          n.ring.Replicas(),
+		ReplicationFactor: n.rf,
+		Members:           make([]member, 0, len(nodes)),
+	}
+	for _, id := range slices.Sorted(maps.Keys(nodes)) {
+		res.Members = append(res.Members, member{
+			ID:           id,
+			Addr:         nodes[id],
+			Self:         NormalizeHostPort(nodes[id], "8080") == self,
+			OwnershipPct: math.Round(own[id]*1e4) / 100,
+			Tokens:       n.ring.Tokens(id),
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// locateResponse is the preference list of a key.
+type locateResponse struct {
+	Key   string   `json:"key"`
+	Epoch string   `json:"epoch"`
+	Nodes []member `json:"nodes"` // owner first, then the replicas; no tokens
+}
+
+// Locate serves GET /locate?key=, the nodes key is placed on according to
+// this node's ring: its owner followed by the next replication factor - 1
+// nodes.
+func (n *Node) Locate(w http.ResponseWriter, req *http.Request) {
+	key := req.URL.Query().Get("key")
+	if key == "" {
+		http.Error(w, "key is required", http.StatusBadRequest)
+		return
+	}
+	self := NormalizeHostPort(n.addr, "8080")
+	res := locateResponse{Key: key, Epoch: n.RingEpoch(), Nodes: []member{}}
+	own := n.ring.Ownership()
+	for _, id := range n.ring.LookupN([]byte(key), n.rf) {
+		addr, _ := n.ring.Addr(id)
+		res.Nodes = append(res.Nodes, member{
+			ID:           id,
+			Addr:         addr,
+			Self:         NormalizeHostPort(addr, "8080") == self,
+			OwnershipPct: math.Round(own[id]*1e4) / 100,
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
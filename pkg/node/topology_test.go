@@ -0,0 +1,48 @@
+package node
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"testing"
+)
+
+func TestClusterAndLocateDescribeTheRing(t *testing.T) {
+	c := newTestCluster(t, 3)
+
+	status, body := doRequest(t, http.MethodGet, c.url(1, "/cluster"), "")
+	var cl clusterResponse
+	if err := json.Unmarshal([]byte(body), &cl); err != nil || status != http.StatusOK {
+		t.Fatalf("/cluster = %d %s", status, body)
+	}
+	if cl.Epoch != c.nodes[0].RingEpoch() || cl.ReplicationFactor != 3 || len(cl.Members) != 3 {
+		t.Fatalf("/cluster = %+v", cl)
+	}
+	total, selves := 0.0, 0
+	for _, m := range cl.Members {
+		total += m.OwnershipPct
+		if len(m.Tokens) != cl.Replicas {
+			t.Errorf("%s has %d tokens, want %d", m.ID, len(m.Tokens), cl.Replicas)
+		}
+		if m.Self {
+			selves++
+			if m.Addr != c.nodes[1].Addr() {
+				t.Errorf("self is %s, want %s", m.Addr, c.nodes[1].Addr())
+			}
+		}
+	}
+	if math.Abs(total-100) > 0.1 || selves != 1 {
+		t.Fatalf("ownership sums to %v%%, %d members marked self", total, selves)
+	}
+
+	owner, _ := c.owner(t, "user:42")
+	status, body = doRequest(t, http.MethodGet, c.url(2, "/locate?key=user:42"), "")
+	var loc locateResponse
+	json.Unmarshal([]byte(body), &loc)
+	if status != http.StatusOK || len(loc.Nodes) != 3 || loc.Nodes[0].Addr != c.nodes[owner].Addr() {
+		t.Fatalf("/locate = %d %s, want the owner %s first", status, body, c.nodes[owner].Addr())
+	}
+	if status, _ := doRequest(t, http.MethodGet, c.url(0, "/locate"), ""); status != http.StatusBadRequest {
+		t.Fatalf("/locate without a key = %d, want 400", status)
+	}
+}
@@ -0,0 +1,116 @@
+package node
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// getHeaders GETs url and returns the status and response headers.
+func getHeaders(t *testing.T, url string) (int, http.Header) {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode, resp.Header
+}
+
+func TestSoftTTLFlagsStaleReads(t *testing.T) {
+	c := newTestCluster(t, 2)
+	_, other := c.owner(t, "feed")
+	if status, body := doRequest(t, http.MethodPut, c.url(other, "/kv/feed?soft_ttl_ms=50&ttl=60"), "v1"); status != http.StatusNoContent {
+		t.Fatalf("PUT = %d %s", status, body)
+	}
+	if _, h := getHeaders(t, c.url(other, "/kv/feed")); h.Get(HeaderStale) != "" || h.Get(HeaderRevalidate) != "" {
+		t.Fatalf("fresh value flagged %s=%q %s=%q", HeaderStale, h.Get(HeaderStale), HeaderRevalidate, h.Get(HeaderRevalidate))
+	}
+
+	// past the soft TTL one reader is asked to refresh and the rest read stale
+	time.Sleep(100 * time.Millisecond)
+	status, h := getHeaders(t, c.url(other, "/kv/feed"))
+	if status != http.StatusOK || h.Get(HeaderStale) != "true" || h.Get(HeaderRevalidate) != "true" {
+		t.Fatalf("first stale GET = %d %v, want stale and revalidate", status, h)
+	}
+	if _, h := getHeaders(t, c.url(other, "/kv/feed")); h.Get(HeaderStale) != "true" || h.Get(HeaderRevalidate) != "" {
+		t.Fatalf("second stale GET = %v, want stale only", h)
+	}
+
+	// the refresh makes the value fresh again
+	doRequest(t, http.MethodPut, c.url(other, "/kv/feed?soft_ttl=30&ttl=60"), "v2")
+	if _, h := getHeaders(t, c.url(other, "/kv/feed")); h.Get(HeaderStale) != "" {
+		t.Fatalf("refreshed value flagged stale")
+	}
+
+	if status, _ := doRequest(t, http.MethodPut, c.url(other, "/kv/feed?soft_ttl=90&ttl=60"), "v3"); status != http.StatusBadRequest {
+		t.Fatalf("soft_ttl beyond ttl = %d, want 400", status)
+	}
+	for _, q := range []string{"soft_ttl=10", "soft_ttl_ms=10", "sliding=true"} {
+		if status, body := doRequest(t, http.MethodPost, c.url(other, "/ttl/feed?ttl=60&"+q), ""); status != http.StatusBadRequest {
+			t.Errorf("POST /ttl/?%s = %d %s, want 400", q, status, body)
+		}
+	}
+}
+
+// ttlBody is the answer of /ttl/.
+type ttlBody struct {
+	TTLMs    int64 `json:"ttl_ms"`
+	ExpireAt int64 `json:"expire_at"`
+	Sliding  bool  `json:"sliding"`
+}
+
+func getTTL(t *testing.T, url string) (int, ttlBody) {
+	t.Helper()
+	status, body := doRequest(t, http.MethodGet, url, "")
+	var res ttlBody
+	json.Unmarshal([]byte(body), &res)
+	return status, res
+}
+
+func TestTTLInspectTouchAndPersist(t *testing.T) {
+	c := newTestCluster(t, 2)
+	_, other := c.owner(t, "session")
+	url := c.url(other, "/ttl/session")
+
+	if status, _ := getTTL(t, url); status != http.StatusNotFound {
+		t.Fatalf("TTL of a missing key = %d, want 404", status)
+	}
+	doRequest(t, http.MethodPut, c.url(other, "/kv/session?ttl_ms=60000&sliding=true"), "v")
+	status, res := getTTL(t, url)
+	if status != http.StatusOK || res.TTLMs <= 50000 || res.TTLMs > 60000 || !res.Sliding || res.ExpireAt == 0 {
+		t.Fatalf("GET /ttl/ = %d %+v, want about 60s, sliding", status, res)
+	}
+
+	// touching resets the expiry without rewriting the value
+	if status, body := doRequest(t, http.MethodPost, url+"?ttl=600", ""); status != http.StatusOK {
+		t.Fatalf("touch = %d %s", status, body)
+	}
+	if _, res := getTTL(t, url); res.TTLMs <= 590000 {
+		t.Fatalf("TTL after touch = %+v, want about 600s", res)
+	}
+	at := time.Now().Add(time.Hour).UnixMilli()
+	doRequest(t, http.MethodPut, url+"?expire_at="+strconv.FormatInt(at, 10), "")
+	if _, res := getTTL(t, url); res.ExpireAt != at {
+		t.Fatalf("expire_at after touch = %d, want %d", res.ExpireAt, at)
+	}
+
+	// persisting removes the expiry; the value is untouched throughout
+	doRequest(t, http.MethodPost, url+"?persist=true", "")
+	if _, res := getTTL(t, url); res.TTLMs != -1 || res.ExpireAt != 0 {
+		t.Fatalf("TTL after persist = %+v, want none", res)
+	}
+	status, h := getHeaders(t, c.url(other, "/kv/session"))
+	if status != http.StatusOK || h.Get(HeaderTTL) != "-1" {
+		t.Fatalf("GET after persist = %d %s=%q", status, HeaderTTL, h.Get(HeaderTTL))
+	}
+
+	if status, _ := doRequest(t, http.MethodPost, c.url(other, "/ttl/missing?ttl=60"), ""); status != http.StatusNotFound {
+		t.Fatalf("touch of a missing key = %d, want 404", status)
+	}
+	if status, _ := doRequest(t, http.MethodPost, url+"?expire_at=1", ""); status != http.StatusBadRequest {
+		t.Fatalf("expire_at in the past = %d, want 400", status)
+	}
+}
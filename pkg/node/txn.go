@@ -0,0 +1,148 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// txnRequest is the body of a transaction.
+type txnRequest struct {
+	Ops []txnOp `json:"ops"`
+}
+
+// txnOp is one conditional put or delete of a transaction.
+type txnOp struct {
+	Op     string `json:"op"` // "put" or "delete"
+	Key    string `json:"key"`
+	Value  []byte `json:"value,omitempty"` // base64 in JSON
+	TTLMs  int64  `json:"ttl_ms,omitempty"`
+	If     string `json:"if,omitempty"`     // "absent", "present" or "equals"
+	Expect []byte `json:"expect,omitempty"` // base64 value compared by "equals"
+}
+
+type txnResponse struct {
+	Applied bool   `json:"applied"`
+	Failed  *int   `json:"failed,omitempty"` // index of the op whose condition failed
+	Key     string `json:"key,omitempty"`
+}
+
+var txnConds = map[string]kv.Cond{
+	"":        kv.CondNone,
+	"absent":  kv.CondAbsent,
+	"present": kv.CondPresent,
+	"equals":  kv.CondEquals,
+}
+
+// Txn applies the JSON body {"ops": [{"op", "key", "value", "ttl_ms", "if",
+// "expect"}]} to namespace ?ns= atomically on the owner of its keys. All keys
+// must have the same owner, which hash tags such as "{user42}:profile"
+// guarantee; transactions spanning owners are rejected with 400. If any
+// condition fails nothing is applied and the answer is 409.
+func (n *Node) Txn(w http.ResponseWriter, req *http.Request) {
+	n.witness(req)
+	name := req.URL.Query().Get("ns")
+	if name == "" {
+		name = DefaultNamespace
+	}
+	ns, ok := n.namespace(name)
+	if !ok {
+		http.Error(w, "unknown namespace", http.StatusNotFound)
+		return
+	}
+	if ns.siblings {
+		http.Error(w, "TXN is "+errSiblingsNamespace.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(w, req.Body, n.maxValue.Load()))
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	var tr txnRequest
+	if err == nil {
+		err = json.Unmarshal(data, &tr)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("invalid transaction: %v", err), http.StatusBadRequest)
+		return
+	}
+	ops, err := parseTxnOps(tr.Ops)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var owner, self string
+	for _, op := range ops {
+		o, s, ok := n.OwnerForKey(op.Key)
+		if !ok {
+			http.Error(w, "no owner for key", http.StatusServiceUnavailable)
+			return
+		}
+		if owner != "" && o != owner {
+			http.Error(w, fmt.Sprintf("keys span owners: %q is not on %s", op.Key, owner), http.StatusBadRequest)
+			return
+		}
+		owner, self = o, s
+	}
+
+	if owner != self {
+		log.Printf("[Forward TXN] keys=%d owner=%q self=%q", len(ops), owner, self)
+		req.Body = io.NopCloser(bytes.NewReader(data))
+		req.ContentLength = int64(len(data))
+		n.Forward(w, req, owner)
+		return
+	}
+
+	err = ns.store.Txn(ops)
+	var failed *kv.ConditionError
+	switch {
+	case errors.As(err, &failed):
+		writeJSON(w, http.StatusConflict, txnResponse{Failed: &failed.Index, Key: failed.Key})
+	case errors.Is(err, kv.ErrFull):
+		http.Error(w, err.Error(), http.StatusInsufficientStorage)
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	default:
+		writeJSON(w, http.StatusOK, txnResponse{Applied: true})
+	}
+}
+
+// parseTxnOps validates the ops of a transaction and converts them for
+// kv.Store.Txn.
+func parseTxnOps(in []txnOp) ([]kv.TxnOp, error) {
+	if len(in) == 0 {
+		return nil, fmt.Errorf("transaction has no ops")
+	}
+	out := make([]kv.TxnOp, len(in))
+	for i, op := range in {
+		cond, ok := txnConds[op.If]
+		if !ok {
+			return nil, fmt.Errorf("op %d: unknown condition %q", i, op.If)
+		}
+		if op.Key == "" {
+			return nil, fmt.Errorf("op %d: empty key", i)
+		}
+		out[i] = kv.TxnOp{Key: op.Key, Cond: cond, Expect: op.Expect}
+		switch op.Op {
+		case "put":
+			out[i].Value = op.Value
+			out[i].Opts.TTL = time.Duration(op.TTLMs) * time.Millisecond
+		case "delete":
+			out[i].Delete = true
+		default:
+			return nil, fmt.Errorf("op %d: unknown op %q", i, op.Op)
+		}
+	}
+	return out, nil
+}
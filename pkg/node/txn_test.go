@@ -0,0 +1,71 @@
+package node
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func postTxn(t *testing.T, url string, ops ...txnOp) (int, txnResponse) {
+	t.Helper()
+	data, _ := json.Marshal(txnRequest{Ops: ops})
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("POST %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+	var out txnResponse
+	json.NewDecoder(resp.Body).Decode(&out)
+	return resp.StatusCode, out
+}
+
+func TestTxnOnTaggedKeys(t *testing.T) {
+	c := newTestCluster(t, 3)
+	owner, other := c.owner(t, "{user42}:profile")
+
+	status, _ := postTxn(t, c.url(other, "/txn"),
+		txnOp{Op: "put", Key: "{user42}:profile", Value: []byte("ada"), If: "absent"},
+		txnOp{Op: "put", Key: "{user42}:prefs", Value: []byte("dark")},
+	)
+	if status != http.StatusOK {
+		t.Fatalf("txn via non-owner = %d, want 200", status)
+	}
+	for _, key := range []string{"{user42}:profile", "{user42}:prefs"} {
+		if _, ok := c.nodes[owner].kv.Get(key); !ok {
+			t.Fatalf("%q not stored on the owner", key)
+		}
+	}
+
+	status, resp := postTxn(t, c.url(owner, "/txn"),
+		txnOp{Op: "delete", Key: "{user42}:prefs"},
+		txnOp{Op: "put", Key: "{user42}:profile", Value: []byte("grace"), If: "equals", Expect: []byte("nobody")},
+	)
+	if status != http.StatusConflict || resp.Failed == nil || *resp.Failed != 1 {
+		t.Fatalf("conflicting txn = %d %+v, want 409 failing op 1", status, resp)
+	}
+	if _, ok := c.nodes[owner].kv.Get("{user42}:prefs"); !ok {
+		t.Fatalf("rejected txn deleted prefs")
+	}
+}
+
+func TestTxnRejectsKeysSpanningOwners(t *testing.T) {
+	c := newTestCluster(t, 3)
+	a := "k0"
+	ownerA, _ := c.owner(t, a)
+	var b string
+	for i := 1; b == ""; i++ {
+		if o, _ := c.owner(t, fmt.Sprint("k", i)); o != ownerA {
+			b = fmt.Sprint("k", i)
+		}
+	}
+
+	status, _ := postTxn(t, c.url(0, "/txn"),
+		txnOp{Op: "put", Key: a, Value: []byte("1")},
+		txnOp{Op: "put", Key: b, Value: []byte("2")},
+	)
+	if status != http.StatusBadRequest {
+		t.Fatalf("cross-owner txn = %d, want 400", status)
+	}
+}
@@ -1,8 +1,17 @@
 package node
 
 import (
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net"
+	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
 )
 
 // normalizeHostPort cuts the http:// https:// prefixes from the input address
@@ -30,3 +39,178 @@ func (s *Node) OwnerForKey(key string) (ownerHP, selfHP string, ok bool) {
 	}
 	return NormalizeHostPort(ownerAddr, "8080"), NormalizeHostPort(s.addr, "8080"), true
 }
+
+// writeJSON marshals v and writes it with the given status code
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+// parseTags splits a comma separated tag header into its trimmed, non-empty parts
+func parseTags(header string) []string {
+	var tags []string
+	for _, t := range strings.Split(header, ",") {
+		if t = strings.TrimSpace(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+// resolveKey extracts the namespace and key from a /{section}/{key} request
+// path and looks up the namespace, writing a 404 if it does not exist. As
+// every single-key request passes through here, it also takes in the clock
+// of a forwarding peer.
+func (n *Node) resolveKey(w http.ResponseWriter, req *http.Request, section string) (namespace, string, bool) {
+	n.witness(req)
+	name, key, ok := parseKeyPath(req.URL.Path, section)
+	if !ok {
+		http.NotFound(w, req)
+		return namespace{}, "", false
+	}
+	ns, ok := n.namespace(name)
+	if !ok {
+		http.Error(w, "unknown namespace", http.StatusNotFound)
+		return namespace{}, "", false
+	}
+	return ns, key, true
+}
+
+// parseWriteOptions reads the expiry options of a write from the query:
+//
+//	ttl, ttl_ms            hard TTL in seconds or milliseconds
+//	expire_at              absolute hard expiry as unix milliseconds
+//	soft_ttl, soft_ttl_ms  soft TTL in seconds or milliseconds
+//	sliding=true           reads push the hard expiry out by the TTL again
+//
+// A soft TTL must not outlive the hard one.
+func parseWriteOptions(q url.Values) (kv.PutOptions, error) {
+	var opts kv.PutOptions
+	var err error
+	if opts.TTL, err = parseDuration(q, "ttl"); err != nil {
+		return opts, err
+	}
+	if opts.SoftTTL, err = parseDuration(q, "soft_ttl"); err != nil {
+		return opts, err
+	}
+	if v := q.Get("expire_at"); v != "" {
+		if opts.TTL > 0 {
+			return opts, errors.New("ttl and expire_at are mutually exclusive")
+		}
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return opts, errors.New("invalid expire_at")
+		}
+		opts.ExpireAt = time.UnixMilli(ms)
+		if !opts.ExpireAt.After(time.Now()) {
+			return opts, errors.New("expire_at is in the past")
+		}
+	}
+	if v := q.Get("sliding"); v != "" {
+		if opts.Sliding, err = strconv.ParseBool(v); err != nil {
+			return opts, errors.New("invalid sliding")
+		}
+	}
+
+	hard := opts.TTL
+	if !opts.ExpireAt.IsZero() {
+		hard = time.Until(opts.ExpireAt)
+	}
+	if hard > 0 && opts.SoftTTL > hard {
+		return opts, errors.New("soft_ttl must not exceed ttl")
+	}
+	return opts, nil
+}
+
+// parseDuration reads a duration given either as name (seconds) or name_ms
+// (milliseconds).
+func parseDuration(q url.Values, name string) (time.Duration, error) {
+	sec, ms := q.Get(name), q.Get(name+"_ms")
+	if sec != "" && ms != "" {
+		return 0, fmt.Errorf("%s and %s_ms are mutually exclusive", name, name)
+	}
+	v, unit := sec, time.Second
+	if ms != "" {
+		v, unit = ms, time.Millisecond
+	}
+	if v == "" {
+		return 0, nil
+	}
+	n, err := strconv.ParseInt(v, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid %s", name)
+	}
+	return time.Duration(n) * unit, nil
+}
+
+// setTTLHeaders reports the remaining TTL and absolute expiry of a value
+func setTTLHeaders(h http.Header, info kv.TTLInfo) {
+	if info.ExpireAt.IsZero() {
+		h.Set(HeaderTTL, "-1")
+		return
+	}
+	h.Set(HeaderTTL, strconv.FormatInt(info.Remaining(time.Now()).Milliseconds(), 10))
+	h.Set(HeaderExpireAt, strconv.FormatInt(info.ExpireAt.UnixMilli(), 10))
+}
+
+// parseMeta reads the metadata stored with a value from the PUT headers
+func parseMeta(h http.Header) (kv.Meta, error) {
+	meta := kv.Meta{
+		ContentType:     h.Get("Content-Type"),
+		ContentEncoding: h.Get("Content-Encoding"),
+	}
+	if v := h.Get(HeaderFlags); v != "" {
+		flags, err := strconv.ParseUint(v, 10, 32)
+		if err != nil {
+			return kv.Meta{}, errors.New("invalid " + HeaderFlags)
+		}
+		meta.Flags = uint32(flags)
+	}
+	return meta, nil
+}
+
+// setMetaHeaders replays the metadata stored with a value, defaulting the
+// content type to application/octet-stream
+func setMetaHeaders(h http.Header, meta kv.Meta) {
+	if meta.ContentType != "" {
+		h.Set("Content-Type", meta.ContentType)
+	} else {
+		h.Set("Content-Type", "application/octet-stream")
+	}
+	if meta.ContentEncoding != "" {
+		h.Set("Content-Encoding", meta.ContentEncoding)
+	}
+	if meta.Flags != 0 {
+		h.Set(HeaderFlags, strconv.FormatUint(uint64(meta.Flags), 10))
+	}
+}
+
+// acceptedCodecs returns the stored codecs a client may be sent as-is
+// according to its Accept-Encoding header. Snappy is not an HTTP
+// content-coding, so it is always decompressed.
+func acceptedCodecs(h http.Header) []kv.Codec {
+	var out []kv.Codec
+	for _, v := range h.Values("Accept-Encoding") {
+		for _, part := range strings.Split(v, ",") {
+			coding, params, _ := strings.Cut(part, ";")
+			if q, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+				if w, err := strconv.ParseFloat(q, 64); err == nil && w == 0 {
+					continue
+				}
+			}
+			switch c := strings.ToLower(strings.TrimSpace(coding)); c {
+			case "gzip", "zstd":
+				out = append(out, kv.Codec(c))
+			case "*":
+				out = append(out, kv.CodecGzip, kv.CodecZstd)
+			}
+		}
+	}
+	return out
+}
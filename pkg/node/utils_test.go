@@ -0,0 +1,40 @@
+package node
+
+import (
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestParseWriteOptions(t *testing.T) {
+	q, _ := url.ParseQuery("ttl_ms=1500&soft_ttl=1&sliding=true")
+	opts, err := parseWriteOptions(q)
+	if err != nil {
+		t.Fatalf("parseWriteOptions: %v", err)
+	}
+	if opts.TTL != 1500*time.Millisecond || opts.SoftTTL != time.Second || !opts.Sliding {
+		t.Fatalf("opts = %+v", opts)
+	}
+
+	at := time.Now().Add(time.Minute).UnixMilli()
+	q = url.Values{"expire_at": {strconv.FormatInt(at, 10)}}
+	if opts, err = parseWriteOptions(q); err != nil || opts.ExpireAt.UnixMilli() != at {
+		t.Fatalf("expire_at: opts=%+v err=%v", opts, err)
+	}
+
+	for _, raw := range []string{
+		"ttl=1&ttl_ms=1000",
+		"ttl=-1",
+		"ttl=abc",
+		"ttl=1&soft_ttl=2",
+		"ttl=1&expire_at=" + strconv.FormatInt(at, 10),
+		"expire_at=1",
+		"sliding=maybe",
+	} {
+		q, _ := url.ParseQuery(raw)
+		if _, err := parseWriteOptions(q); err == nil {
+			t.Errorf("parseWriteOptions(%q) succeeded, want error", raw)
+		}
+	}
+}
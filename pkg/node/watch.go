@@ -0,0 +1,239 @@
+package node
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/watch"
+)
+
+const (
+	// watchRefresh is how often a watch re-resolves the owners it follows.
+	watchRefresh = time.Second
+	// watchRetry is how long a relay waits before reconnecting to an owner.
+	watchRetry = time.Second
+	// watchHeartbeat is how often an idle stream gets a comment line, so that
+	// proxies keep it open and dead clients are noticed.
+	watchHeartbeat = 15 * time.Second
+)
+
+// Watch streams put, delete, expire and evict events for ?key= or ?prefix= in
+// namespace ?ns= as Server-Sent Events, with the event JSON as data. Any node
+// can serve a watch: it relays the events of the key's owner, or of every
+// node for a prefix, and follows ownership changes in the ring, sending a
+// resync event whenever events may have been missed in the handoff.
+func (n *Node) Watch(w http.ResponseWriter, req *http.Request) {
+	q := req.URL.Query()
+	f := watch.Filter{Namespace: q.Get("ns"), Key: q.Get("key"), Prefix: q.Get("prefix")}
+	if f.Namespace == "" {
+		f.Namespace = DefaultNamespace
+	}
+	// an empty prefix watches the whole namespace
+	if q.Has("key") == q.Has("prefix") || q.Has("key") && f.Key == "" {
+		http.Error(w, "exactly one of key or prefix is required", http.StatusBadRequest)
+		return
+	}
+	if _, ok := n.namespace(f.Namespace); !ok {
+		http.Error(w, "unknown namespace", http.StatusNotFound)
+		return
+	}
+	rc := http.NewResponseController(w)
+
+	ctx := req.Context()
+	events := make(chan watch.Event, watch.Buffer)
+	if isLocal(req) {
+		go n.relayLocal(ctx, f, events)
+	} else {
+		go n.followOwners(ctx, f, events)
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", "text/event-stream")
+	h.Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		log.Printf("[Watch] cannot stream: %v", err)
+		return
+	}
+
+	heartbeat := time.NewTicker(watchHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		case ev := <-events:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Type, data)
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// watchTargets returns the addresses of the nodes holding the keys f selects.
+func (n *Node) watchTargets(f watch.Filter) []string {
+	if f.Key != "" {
+		if owner, _, ok := n.OwnerForKey(f.Key); ok {
+			return []string{owner}
+		}
+		return nil
+	}
+	var out []string
+	for _, addr := range n.ring.Nodes() {
+		out = append(out, NormalizeHostPort(addr, "8080"))
+	}
+	slices.Sort(out)
+	return out
+}
+
+// followOwners relays the events of the nodes holding the keys f selects to
+// out until ctx is done, re-resolving those nodes every watchRefresh.
+func (n *Node) followOwners(ctx context.Context, f watch.Filter, out chan<- watch.Event) {
+	self := NormalizeHostPort(n.addr, "8080")
+	relays := make(map[string]context.CancelFunc)
+	defer func() {
+		for _, cancel := range relays {
+			cancel()
+		}
+	}()
+
+	ticker := time.NewTicker(watchRefresh)
+	defer ticker.Stop()
+	for first := true; ; first = false {
+		targets := n.watchTargets(f)
+		changed := false
+		for _, addr := range targets {
+			if _, ok := relays[addr]; ok {
+				continue
+			}
+			rctx, cancel := context.WithCancel(ctx)
+			relays[addr] = cancel
+			changed = true
+			if addr == self {
+				go n.relayLocal(rctx, f, out)
+			} else {
+				go relayRemote(rctx, addr, f, out)
+			}
+		}
+		for addr, cancel := range relays {
+			if !slices.Contains(targets, addr) {
+				cancel()
+				delete(relays, addr)
+				changed = true
+			}
+		}
+		if changed && !first {
+			log.Printf("[Watch] owners of %+v changed to %v", f, slices.Sorted(maps.Keys(relays)))
+			send(ctx, out, watch.Event{Type: watch.Resync, Namespace: f.Namespace, Key: f.Key, Time: time.Now()})
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// relayLocal relays the events of the local stores matching f to out until
+// ctx is done. If the subscription falls behind it is renewed and a resync
+// event sent.
+func (n *Node) relayLocal(ctx context.Context, f watch.Filter, out chan<- watch.Event) {
+	for {
+		sub := n.watch.Subscribe(f)
+		for open := true; open; {
+			select {
+			case <-ctx.Done():
+				sub.Close()
+				return
+			case ev, ok := <-sub.C:
+				if open = ok; ok {
+					send(ctx, out, ev)
+				}
+			}
+		}
+		send(ctx, out, watch.Event{Type: watch.Resync, Namespace: f.Namespace, Key: f.Key, Time: time.Now()})
+	}
+}
+
+// relayRemote relays the local events of the node at addr to out until ctx
+// is done, reconnecting after watchRetry whenever the stream breaks.
+func relayRemote(ctx context.Context, addr string, f watch.Filter, out chan<- watch.Event) {
+	for {
+		err := streamRemote(ctx, addr, f, out)
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("[Watch] stream from %s ended: %v", addr, err)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(watchRetry):
+		}
+		send(ctx, out, watch.Event{Type: watch.Resync, Namespace: f.Namespace, Key: f.Key, Time: time.Now()})
+	}
+}
+
+// streamRemote opens a local-only watch on addr and relays its events.
+func streamRemote(ctx context.Context, addr string, f watch.Filter, out chan<- watch.Event) error {
+	q := url.Values{"ns": {f.Namespace}}
+	if f.Key != "" {
+		q.Set("key", f.Key)
+	} else {
+		q.Set("prefix", f.Prefix)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://"+addr+"/watch?"+q.Encode(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set(HeaderLocal, "1")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s", resp.Status)
+	}
+
+	r := bufio.NewReader(resp.Body)
+	var data []byte
+	for {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return err
+		}
+		line = bytes.TrimRight(line, "\r\n")
+		switch {
+		case len(line) == 0 && data != nil:
+			var ev watch.Event
+			if err := json.Unmarshal(data, &ev); err == nil {
+				send(ctx, out, ev)
+			}
+			data = nil
+		case bytes.HasPrefix(line, []byte("data:")):
+			data = append(data, bytes.TrimSpace(line[len("data:"):])...)
+		}
+	}
+}
+
+// send hands ev to out unless ctx is done first.
+func send(ctx context.Context, out chan<- watch.Event, ev watch.Event) {
+	select {
+	case out <- ev:
+	case <-ctx.Done():
+	}
+}
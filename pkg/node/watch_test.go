@@ -0,0 +1,144 @@
+package node
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/watch"
+)
+
+// openWatch opens a watch on url and returns its events.
+func openWatch(t *testing.T, url string) <-chan watch.Event {
+	t.Helper()
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("GET %s = %s", url, resp.Status)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+
+	events := make(chan watch.Event, watch.Buffer)
+	go func() {
+		defer close(events)
+		sc := bufio.NewScanner(resp.Body)
+		for sc.Scan() {
+			data, ok := strings.CutPrefix(sc.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var ev watch.Event
+			if json.Unmarshal([]byte(data), &ev) == nil {
+				events <- ev
+			}
+		}
+	}()
+	return events
+}
+
+// nextEvent returns the next event, skipping resyncs if asked, or fails
+// after a few seconds.
+func nextEvent(t *testing.T, events <-chan watch.Event, skipResync bool) watch.Event {
+	t.Helper()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case ev, ok := <-events:
+			if !ok {
+				t.Fatal("watch stream ended")
+			}
+			if skipResync && ev.Type == watch.Resync {
+				continue
+			}
+			return ev
+		case <-timeout:
+			t.Fatal("timed out waiting for a watch event")
+		}
+	}
+}
+
+func TestWatchPrefixAcrossOwners(t *testing.T) {
+	c := newTestCluster(t, 3)
+	events := openWatch(t, c.url(0, "/watch?prefix=user:"))
+	// let the relays to every node subscribe
+	time.Sleep(200 * time.Millisecond)
+
+	keys := []string{"user:1", "user:2", "user:3", "user:4"}
+	for i, key := range keys {
+		if status, _ := doRequest(t, http.MethodPut, c.url(i%3, "/kv/"+key), "v"+key); status >= 300 {
+			t.Fatalf("PUT %s = %d", key, status)
+		}
+	}
+	doRequest(t, http.MethodPut, c.url(1, "/kv/other"), "x")
+	doRequest(t, http.MethodDelete, c.url(2, "/kv/user:1"), "")
+
+	seen := map[string]bool{}
+	for range keys {
+		ev := nextEvent(t, events, true)
+		if ev.Type != watch.Put || !strings.HasPrefix(ev.Key, "user:") || string(ev.Value) != "v"+ev.Key {
+			t.Fatalf("event = %+v, want a put of a user: key", ev)
+		}
+		seen[ev.Key] = true
+	}
+	if len(seen) != len(keys) {
+		t.Fatalf("saw puts of %v, want %v", seen, keys)
+	}
+	if ev := nextEvent(t, events, true); ev.Type != watch.Delete || ev.Key != "user:1" {
+		t.Fatalf("event = %+v, want delete of user:1", ev)
+	}
+}
+
+func TestWatchFollowsOwnershipChange(t *testing.T) {
+	c := newTestCluster(t, 2)
+	peers := map[string]string{"nodea": c.nodes[0].Addr(), "nodeb": c.nodes[1].Addr()}
+
+	// find a key node b owns once both nodes are in the ring
+	key := ""
+	for i := 0; key == ""; i++ {
+		k := "k" + string(rune('a'+i%26)) + strings.Repeat("x", i/26)
+		if owner, _ := c.owner(t, k); owner == 1 {
+			key = k
+		}
+	}
+
+	// shrink the ring to node a, watch the key there, then let b rejoin
+	for _, n := range c.nodes {
+		n.SyncPeers(map[string]string{"nodea": peers["nodea"]})
+	}
+	events := openWatch(t, c.url(0, "/watch?key="+key))
+	time.Sleep(100 * time.Millisecond)
+	for _, n := range c.nodes {
+		n.SyncPeers(peers)
+	}
+
+	if ev := nextEvent(t, events, false); ev.Type != watch.Resync || ev.Key != key {
+		t.Fatalf("event = %+v, want resync of %s", ev, key)
+	}
+	// the relay to b may still be connecting, so write until an event arrives
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		doRequest(t, http.MethodPut, c.url(0, "/kv/"+key), "moved")
+		select {
+		case ev := <-events:
+			if ev.Type == watch.Resync {
+				continue
+			}
+			if ev.Type != watch.Put || ev.Key != key || string(ev.Value) != "moved" {
+				t.Fatalf("event = %+v, want put of %s", ev, key)
+			}
+			if _, ok := c.nodes[1].kv.Get(key); !ok {
+				t.Fatalf("%s was not written to its new owner", key)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("no event from the new owner")
+		}
+	}
+}
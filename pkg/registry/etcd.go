@@ -66,13 +66,26 @@ func GetPeers(cli *clientv3.Client, prefix string) (map[string]string, error) {
 }
 
 func WatchPeers(cli *clientv3.Client, callback func(map[string]string)) {
-	const prefix = "/zephyr/nodes/"
-	log.Printf("[WATCH] starting WatchPeers on prefix=%q", prefix)
+	watchPrefix(cli, "/zephyr/nodes/", callback)
+}
+
+// WatchNamespaces delivers the namespace configs stored under
+// /zephyr/namespaces/{name} to callback, once on start and again on every change.
+func WatchNamespaces(cli *clientv3.Client, callback func(map[string]string)) {
+	watchPrefix(cli, "/zephyr/namespaces/", callback)
+}
+
+// watchPrefix snapshots every key under prefix, then keeps the snapshot up to
+// date from a watch and hands a copy (keyed without the prefix) to callback
+// after every batch of events.
+func watchPrefix(cli *clientv3.Client, prefix string, callback func(map[string]string)) {
+	log.Printf("[WATCH] starting watch on prefix=%q", prefix)
 	peers, err := GetPeers(cli, prefix)
 	if err != nil {
 		log.Printf("[WATCH] GetPeers failed: %v", err)
+		peers = make(map[string]string)
 	} else {
-		log.Printf("[WATCH] bootstrap snapshot: %d peers", len(peers))
+		log.Printf("[WATCH] bootstrap snapshot: %d keys under %q", len(peers), prefix)
 	}
 	callback(maps.Clone(peers))
 
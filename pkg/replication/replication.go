@@ -1,4 +1,5 @@
+// Package replication mirrors the writes of selected namespaces to another
+// cluster asynchronously, settling conflicting writes by last-writer-wins.
+// Hinted handoff and Merkle anti-entropy between the nodes of one cluster
+// are still to come.
 package replication
-
-// Placeholder for hinted handoff and Merkle anti-entropy sync.
-// Week 3-4 milestone will implement background healing workers.
@@ -0,0 +1,325 @@
+package replication
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// IngestPath is the endpoint of the remote cluster batches are POSTed to.
+// It reads at most MaxBatchBytes of a batch and answers larger ones 413.
+const IngestPath = "/replicate"
+
+// MaxBatchBytes is the largest batch body IngestPath accepts. Replicators,
+// and anything else POSTing there, split batches to stay under it.
+const MaxBatchBytes = 256 << 20
+
+// recordOverhead is a generous bound on what the JSON encoding of a Record
+// adds to its strings and value.
+const recordOverhead = 256
+
+// Record is one write shipped to the remote cluster.
+type Record struct {
+	Op        kv.Op   `json:"op"` // kv.OpPut or kv.OpDelete
+	Namespace string  `json:"ns"`
+	Key       string  `json:"key"`
+	Value     []byte  `json:"value,omitempty"`
+	Meta      kv.Meta `json:"meta"`
+	ExpireAt  int64   `json:"expire_at,omitempty"` // unix milliseconds, 0 if none
+	// Version is the write's hybrid logical clock timestamp; the remote keeps
+	// whichever write of a key has the latest.
+	Version hlc.Timestamp `json:"version"`
+}
+
+// Size bounds the length of rec's JSON encoding from above. Escaping can
+// make a string up to six times longer.
+func (rec Record) Size() int {
+	strs := len(rec.Namespace) + len(rec.Key) + len(rec.Meta.ContentType) + len(rec.Meta.ContentEncoding)
+	return recordOverhead + 6*strs + base64.StdEncoding.EncodedLen(len(rec.Value))
+}
+
+// Config selects what is mirrored where and tunes batching and retries. Zero
+// values pick the defaults.
+type Config struct {
+	Target        string        // base URL of any node of the remote cluster
+	Namespaces    []string      // namespaces to mirror
+	BatchSize     int           // ship once this many keys are pending (default 100)
+	FlushInterval time.Duration // ship at least this often (default 100ms)
+	RetryBackoff  time.Duration // wait after a failed batch, doubled per failure (default 100ms)
+	MaxBackoff    time.Duration // cap on the wait between retries (default 10s)
+	Client        *http.Client  // nil means http.DefaultClient
+}
+
+func (c *Config) setDefaults() {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = 100 * time.Millisecond
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 100 * time.Millisecond
+	}
+	if c.MaxBackoff <= 0 {
+		c.MaxBackoff = 10 * time.Second
+	}
+	if c.Client == nil {
+		c.Client = http.DefaultClient
+	}
+	c.Target = strings.TrimRight(c.Target, "/")
+}
+
+// Stats describes how far the remote cluster is behind.
+type Stats struct {
+	Pending int // writes not yet acknowledged by the remote
+	// Lag is the age of the oldest write not yet acknowledged, zero when
+	// the remote is caught up.
+	Lag      time.Duration
+	Shipped  uint64 // records acknowledged by the remote
+	Failures uint64 // batches the remote failed to take
+}
+
+// Replicator ships the writes it is handed to a remote cluster in batches,
+// in the background. Writes are coalesced per key, so only the latest write
+// of a key since the last batch is sent. Failed batches are retried with
+// backoff until they go through; nothing is dropped, but a long outage keeps
+// every written key pending in memory.
+type Replicator struct {
+	cfg        Config
+	namespaces map[string]bool
+
+	mu       sync.Mutex
+	pending  map[string]Record // latest record per namespace and key
+	order    []string          // keys of pending in the order they became pending
+	inflight []Record          // records taken by the flush under way and not yet shipped
+
+	shipped  atomic.Uint64
+	failures atomic.Uint64
+
+	// ctx is cancelled once Close gives up, aborting shipping and retries
+	ctx    context.Context
+	cancel context.CancelFunc
+	kick   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// New starts a Replicator shipping to cfg.Target.
+func New(cfg Config) *Replicator {
+	cfg.setDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &Replicator{
+		cfg:        cfg,
+		namespaces: make(map[string]bool),
+		pending:    make(map[string]Record),
+		ctx:        ctx,
+		cancel:     cancel,
+		kick:       make(chan struct{}, 1),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	for _, ns := range cfg.Namespaces {
+		r.namespaces[ns] = true
+	}
+	go r.loop()
+	return r
+}
+
+// Replicates reports whether writes to namespace ns are mirrored.
+func (r *Replicator) Replicates(ns string) bool {
+	return r.namespaces[ns]
+}
+
+// Enqueue schedules rec to be shipped, unless its namespace is not mirrored.
+// It never blocks: a newer record for the same key replaces one that has not
+// been shipped yet.
+func (r *Replicator) Enqueue(rec Record) {
+	if !r.Replicates(rec.Namespace) {
+		return
+	}
+	r.mu.Lock()
+	full := r.add(rec)
+	r.mu.Unlock()
+
+	if full {
+		select {
+		case r.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// add makes rec pending unless a newer write of its key already is, and
+// reports whether a batch is full. r.mu must be held.
+func (r *Replicator) add(rec Record) bool {
+	id := rec.Namespace + "\x00" + rec.Key
+	old, ok := r.pending[id]
+	switch {
+	case !ok:
+		r.order = append(r.order, id)
+		r.pending[id] = rec
+	case old.Version < rec.Version:
+		r.pending[id] = rec
+	}
+	return len(r.pending) >= r.cfg.BatchSize
+}
+
+// Stats returns the replicator's current backlog.
+func (r *Replicator) Stats() Stats {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var oldest time.Time
+	note := func(rec Record) {
+		if t := rec.Version.Time(); oldest.IsZero() || t.Before(oldest) {
+			oldest = t
+		}
+	}
+	for _, rec := range r.inflight {
+		note(rec)
+	}
+	for _, rec := range r.pending {
+		note(rec)
+	}
+	st := Stats{Pending: len(r.pending) + len(r.inflight), Shipped: r.shipped.Load(), Failures: r.failures.Load()}
+	if !oldest.IsZero() {
+		st.Lag = max(time.Since(oldest), 0)
+	}
+	return st
+}
+
+// Close stops the replicator after shipping what is pending, retrying until
+// ctx is done.
+func (r *Replicator) Close(ctx context.Context) {
+	close(r.stop)
+	select {
+	case <-r.done:
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+	}
+}
+
+func (r *Replicator) loop() {
+	defer close(r.done)
+	defer r.cancel()
+	ticker := time.NewTicker(r.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	backoff := r.cfg.RetryBackoff
+	for {
+		select {
+		case <-ticker.C:
+		case <-r.kick:
+		case <-r.stop:
+			r.drain(backoff)
+			return
+		}
+		err := r.flush()
+		if err == nil {
+			backoff = r.cfg.RetryBackoff
+			continue
+		}
+		log.Printf("[Replication] shipping to %s failed, retrying in %v: %v", r.cfg.Target, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-r.stop:
+			r.drain(backoff)
+			return
+		}
+		backoff = min(backoff*2, r.cfg.MaxBackoff)
+	}
+}
+
+// drain ships what is pending until it goes through or Close gives up.
+func (r *Replicator) drain(backoff time.Duration) {
+	for r.flush() != nil {
+		select {
+		case <-time.After(backoff):
+		case <-r.ctx.Done():
+			return
+		}
+		backoff = min(backoff*2, r.cfg.MaxBackoff)
+	}
+}
+
+// flush ships everything pending, batch by batch. If a batch fails, it and
+// everything after it are made pending again.
+func (r *Replicator) flush() error {
+	r.mu.Lock()
+	pending, order := r.pending, r.order
+	r.pending, r.order = make(map[string]Record), nil
+	r.mu.Unlock()
+
+	recs := make([]Record, len(order))
+	for i, id := range order {
+		recs[i] = pending[id]
+	}
+	for start, end := 0, 0; start < len(recs); start = end {
+		// cut the batch at BatchSize records or MaxBatchBytes, whichever
+		// comes first, but always ship at least one record
+		end = start + 1
+		for size := recs[start].Size(); end < min(start+r.cfg.BatchSize, len(recs)); end++ {
+			if size += recs[end].Size(); size > MaxBatchBytes {
+				break
+			}
+		}
+		batch := recs[start:end]
+		r.mu.Lock()
+		r.inflight = recs[start:]
+		r.mu.Unlock()
+
+		err := r.ship(batch)
+
+		r.mu.Lock()
+		r.inflight = nil
+		if err != nil {
+			for _, rec := range recs[start:] {
+				r.add(rec)
+			}
+		}
+		r.mu.Unlock()
+		if err != nil {
+			r.failures.Add(1)
+			return err
+		}
+		r.shipped.Add(uint64(len(batch)))
+	}
+	return nil
+}
+
+// ship POSTs batch to the remote cluster as a JSON array.
+func (r *Replicator) ship(batch []Record) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(r.ctx, 30*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.cfg.Target+IngestPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := r.cfg.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("replication: %s answered %s", r.cfg.Target, resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package replication
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ryandielhenn/zephyrcache/pkg/hlc"
+	"github.com/ryandielhenn/zephyrcache/pkg/kv"
+)
+
+// ingest is a fake remote cluster that records batches and fails the first
+// failN of them.
+type ingest struct {
+	mu      sync.Mutex
+	failN   int
+	batches [][]Record
+}
+
+func (in *ingest) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	if req.URL.Path != IngestPath {
+		http.NotFound(w, req)
+		return
+	}
+	if in.failN > 0 {
+		in.failN--
+		http.Error(w, "down", http.StatusServiceUnavailable)
+		return
+	}
+	var batch []Record
+	if err := json.NewDecoder(req.Body).Decode(&batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	in.batches = append(in.batches, batch)
+}
+
+func (in *ingest) records() []Record {
+	in.mu.Lock()
+	defer in.mu.Unlock()
+	var out []Record
+	for _, b := range in.batches {
+		out = append(out, b...)
+	}
+	return out
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestReplicatorCoalescesAndFiltersNamespaces(t *testing.T) {
+	in := &ingest{}
+	srv := httptest.NewServer(in)
+	defer srv.Close()
+	r := New(Config{Target: srv.URL + "/", Namespaces: []string{"sessions"}, FlushInterval: time.Hour, BatchSize: 2})
+
+	v := hlc.New(time.Now(), 0)
+	r.Enqueue(Record{Op: kv.OpPut, Namespace: "sessions", Key: "a", Value: []byte("1"), Version: v})
+	r.Enqueue(Record{Op: kv.OpPut, Namespace: "sessions", Key: "a", Value: []byte("2"), Version: v + 1})
+	r.Enqueue(Record{Op: kv.OpPut, Namespace: "other", Key: "x", Version: v})
+	if st := r.Stats(); st.Pending != 1 {
+		t.Fatalf("pending = %d, want 1", st.Pending)
+	}
+	r.Enqueue(Record{Op: kv.OpDelete, Namespace: "sessions", Key: "b", Version: v}) // fills the batch
+
+	waitFor(t, func() bool { return len(in.records()) == 2 })
+	r.Close(context.Background())
+	got := in.records()
+	if got[0].Key != "a" || string(got[0].Value) != "2" || got[1].Op != kv.OpDelete {
+		t.Fatalf("shipped %+v", got)
+	}
+	if st := r.Stats(); st.Pending != 0 || st.Lag != 0 || st.Shipped != 2 {
+		t.Fatalf("stats = %+v", st)
+	}
+}
+
+func TestReplicatorRetriesUntilShipped(t *testing.T) {
+	in := &ingest{failN: 2}
+	srv := httptest.NewServer(in)
+	defer srv.Close()
+	r := New(Config{Target: srv.URL, Namespaces: []string{"default"}, FlushInterval: 10 * time.Millisecond, RetryBackoff: 10 * time.Millisecond})
+	defer r.Close(context.Background())
+
+	r.Enqueue(Record{Op: kv.OpPut, Namespace: "default", Key: "k", Value: []byte("v"), Version: hlc.New(time.Now().Add(-time.Second), 0)})
+	if st := r.Stats(); st.Lag < time.Second {
+		t.Fatalf("lag = %v, want at least the age of the write", st.Lag)
+	}
+	waitFor(t, func() bool { return len(in.records()) == 1 })
+	waitFor(t, func() bool { return r.Stats().Shipped == 1 })
+	if st := r.Stats(); st.Failures != 2 || st.Pending != 0 {
+		t.Fatalf("stats = %+v, want 2 failures and nothing pending", st)
+	}
+}
+
+func TestRecordSizeBoundsItsEncoding(t *testing.T) {
+	for _, rec := range []Record{
+		{Op: kv.OpDelete, Namespace: "default", Key: "k", Version: hlc.New(time.Now(), 1<<15)},
+		{Op: kv.OpPut, Namespace: "sessions", Key: "<a \"quoted\" key>", Value: make([]byte, 1000),
+			Meta:     kv.Meta{ContentType: "application/json", ContentEncoding: "gzip", Flags: 1<<32 - 1},
+			ExpireAt: time.Now().UnixMilli(), Version: hlc.New(time.Now(), 7)},
+	} {
+		data, err := json.Marshal(rec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rec.Size() < len(data) {
+			t.Fatalf("Size() = %d, but %s encodes to %d bytes", rec.Size(), rec.Key, len(data))
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package ring
 
 import (
+	"bytes"
 	"encoding/binary"
 	"hash/fnv"
 	"maps"
@@ -93,13 +94,15 @@ func (r *HashRing) Lookup(key []byte) string {
 	return nodes[0]
 }
 
+// LookupN returns up to n distinct nodes for key in ring order, starting with
+// its owner. Keys with a hash tag are placed by the tag alone.
 func (r *HashRing) LookupN(key []byte, n int) []string {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 	if len(r.tokens) == 0 || n <= 0 {
 		return nil
 	}
-	h := r.hash(key)
+	h := r.hash(HashTag(key))
 	idx := sort.Search(len(r.tokens), func(i int) bool { return r.tokens[i] >= h })
 	if idx == len(r.tokens) {
 		idx = 0
@@ -134,6 +137,80 @@ func (r *HashRing) Nodes() map[string]string {
 	return nodes
 }
 
+// Replicas returns the number of tokens each node is given on the ring.
+func (r *HashRing) Replicas() int {
+	return r.replicas
+}
+
+// Tokens returns the positions of nodeID's tokens on the ring, in ring
+// order.
+func (r *HashRing) Tokens(nodeID string) []uint32 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	var out []uint32
+	for _, tok := range r.tokens {
+		if r.owners[tok] == nodeID {
+			out = append(out, tok)
+		}
+	}
+	return out
+}
+
+// Ownership returns the share of the hash space each node owns, between 0
+// and 1. A token owns the hashes after the token before it, up to and
+// including itself.
+func (r *HashRing) Ownership() map[string]float64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	out := make(map[string]float64, len(r.nodes))
+	for id := range r.nodes {
+		out[id] = 0
+	}
+	for i, tok := range r.tokens {
+		prev := r.tokens[(i+len(r.tokens)-1)%len(r.tokens)]
+		span := uint64(tok - prev) // wraps around for the first token
+		if len(r.tokens) == 1 {
+			span = 1 << 32
+		}
+		out[r.owners[tok]] += float64(span) / (1 << 32)
+	}
+	return out
+}
+
+// Epoch identifies the ring's membership. Rings with the same nodes at the
+// same addresses and the same number of replicas have the same epoch,
+// whatever order the nodes were added in, so nodes and clients can tell
+// cheaply whether they agree on the ring.
+func (r *HashRing) Epoch() uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	h := fnv.New64a()
+	binary.Write(h, binary.LittleEndian, uint32(r.replicas))
+	for _, id := range slices.Sorted(maps.Keys(r.nodes)) {
+		h.Write([]byte(id))
+		h.Write([]byte{0})
+		h.Write([]byte(r.nodes[id]))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
+// HashTag returns the part of key that decides its placement: the text
+// between the first '{' and the next '}' if that is non-empty, as in Redis
+// Cluster, and the whole key otherwise. Keys sharing a tag, such as
+// "{user42}:profile" and "{user42}:prefs", always have the same owner.
+func HashTag(key []byte) []byte {
+	open := bytes.IndexByte(key, '{')
+	if open < 0 {
+		return key
+	}
+	end := bytes.IndexByte(key[open+1:], '}')
+	if end <= 0 {
+		return key
+	}
+	return key[open+1 : open+1+end]
+}
+
 func FNV32a(b []byte) uint32 {
 	h := fnv.New32a()
 	_, _ = h.Write(b)
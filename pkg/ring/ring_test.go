@@ -3,6 +3,7 @@ package ring
 import (
 	"hash/fnv"
 	"math"
+	"slices"
 	"testing"
 )
 
@@ -145,6 +146,54 @@ func TestNodes(t *testing.T) {
 	}
 }
 
+func TestEpochFollowsMembership(t *testing.T) {
+	a, b := New(16, fnv32a), New(16, fnv32a)
+	a.Add("n1", "a:1")
+	a.Add("n2", "a:2")
+	b.Add("n2", "a:2")
+	b.Add("n1", "a:1")
+	if a.Epoch() != b.Epoch() {
+		t.Fatal("rings with the same members should share an epoch")
+	}
+	before := a.Epoch()
+	a.Remove("n2")
+	a.Add("n2", "a:3")
+	if a.Epoch() == before {
+		t.Fatal("epoch did not change with a node's address")
+	}
+	if New(32, fnv32a).Epoch() == New(16, fnv32a).Epoch() {
+		t.Fatal("epoch ignores the replica count")
+	}
+}
+
+func TestTokensAndOwnership(t *testing.T) {
+	r := New(64, fnv32a)
+	r.Add("n1", "a:1")
+	r.Add("n2", "a:2")
+	r.Add("n3", "a:3")
+
+	if toks := r.Tokens("n2"); len(toks) != 64 || !slices.IsSorted(toks) {
+		t.Fatalf("Tokens(n2) = %d tokens, sorted %v", len(toks), slices.IsSorted(toks))
+	}
+	own := r.Ownership()
+	total := 0.0
+	for id, share := range own {
+		if share < 0.15 || share > 0.55 {
+			t.Errorf("%s owns %.2f of the ring", id, share)
+		}
+		total += share
+	}
+	if len(own) != 3 || math.Abs(total-1) > 1e-9 {
+		t.Fatalf("ownership %v sums to %v", own, total)
+	}
+
+	one := New(1, fnv32a)
+	one.Add("solo", "a:1")
+	if got := one.Ownership()["solo"]; got != 1 {
+		t.Fatalf("single token owns %v", got)
+	}
+}
+
 func TestRemoveOnlyAffectsTargetNode(t *testing.T) {
 	r := New(128, fnv32a)
 	r.Add("n1", "a:1")
@@ -183,3 +232,29 @@ func TestRemoveOnlyAffectsTargetNode(t *testing.T) {
 		}
 	}
 }
+
+func TestHashTag(t *testing.T) {
+	for key, want := range map[string]string{
+		"{user42}:profile": "user42",
+		"a{b}c{d}":         "b",
+		"{}x":              "{}x",
+		"{unclosed":        "{unclosed",
+		"plain":            "plain",
+		"x{}{y}":           "x{}{y}",
+	} {
+		if got := string(HashTag([]byte(key))); got != want {
+			t.Errorf("HashTag(%q) = %q, want %q", key, got, want)
+		}
+	}
+
+	r := New(128, fnv32a)
+	for _, id := range []string{"node1", "node2", "node3", "node4"} {
+		r.Add(id, id)
+	}
+	for i := range 100 {
+		tag := "{user" + string(rune('a'+i%26)) + string(rune('a'+i/26)) + "}"
+		if a, b := r.Lookup([]byte(tag+":profile")), r.Lookup([]byte(tag+":prefs")); a != b {
+			t.Fatalf("keys tagged %s placed on %s and %s", tag, a, b)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// Package vclock implements Dynamo-style vector clocks, which tell whether
+// one write of a key saw another or the two were made concurrently.
+package vclock
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+)
+
+// Clock counts the writes each actor, a node coordinating writes, has made
+// to a key. The zero Clock is empty and descends from no other clock but the
+// empty one.
+type Clock map[string]uint64
+
+// Copy returns a copy of c.
+func (c Clock) Copy() Clock {
+	out := make(Clock, len(c))
+	for a, n := range c {
+		out[a] = n
+	}
+	return out
+}
+
+// Descends reports whether c has seen every write o has, i.e. c is o or a
+// successor of it.
+func (c Clock) Descends(o Clock) bool {
+	for a, n := range o {
+		if c[a] < n {
+			return false
+		}
+	}
+	return true
+}
+
+// Concurrent reports whether neither of c and o has seen the other.
+func (c Clock) Concurrent(o Clock) bool {
+	return !c.Descends(o) && !o.Descends(c)
+}
+
+// Merge returns a clock descending from every one of clocks.
+func Merge(clocks ...Clock) Clock {
+	out := make(Clock)
+	for _, c := range clocks {
+		for a, n := range c {
+			out[a] = max(out[a], n)
+		}
+	}
+	return out
+}
+
+// Encode formats c as the opaque token clients hand back with a write.
+func (c Clock) Encode() string {
+	data, _ := json.Marshal(c) // map keys are sorted, so equal clocks encode alike
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Decode reads a token formatted by Encode. The empty token is the empty
+// clock.
+func Decode(s string) (Clock, error) {
+	if s == "" {
+		return Clock{}, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	var c Clock
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("vclock: invalid context %q", s)
+	}
+	if c == nil {
+		c = Clock{}
+	}
+	return c, nil
+}
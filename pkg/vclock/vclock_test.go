@@ -0,0 +1,36 @@
+package vclock
+
+import "testing"
+
+func TestDescendsAndConcurrent(t *testing.T) {
+	a := Clock{"n1": 2}
+	b := Clock{"n1": 2, "n2": 1}
+	c := Clock{"n1": 1, "n3": 1}
+
+	if !b.Descends(a) || a.Descends(b) {
+		t.Fatalf("%v should strictly descend from %v", b, a)
+	}
+	if !a.Descends(Clock{}) || !a.Descends(a) {
+		t.Fatal("a clock descends from itself and from the empty clock")
+	}
+	if !b.Concurrent(c) || a.Concurrent(b) {
+		t.Fatalf("want %v and %v concurrent, %v and %v not", b, c, a, b)
+	}
+	if m := Merge(b, c); !m.Descends(b) || !m.Descends(c) || len(m) != 3 || m["n1"] != 2 {
+		t.Fatalf("Merge = %v", m)
+	}
+}
+
+func TestEncodeRoundTrips(t *testing.T) {
+	c := Clock{"10.0.0.1:8080": 3, "10.0.0.2:8080": 1}
+	got, err := Decode(c.Encode())
+	if err != nil || !got.Descends(c) || !c.Descends(got) {
+		t.Fatalf("Decode(Encode(%v)) = %v, %v", c, got, err)
+	}
+	if got, err := Decode(""); err != nil || len(got) != 0 {
+		t.Fatalf("Decode of the empty context = %v, %v", got, err)
+	}
+	if _, err := Decode("not a context"); err == nil {
+		t.Fatal("Decode accepted garbage")
+	}
+}
@@ -0,0 +1,127 @@
+// Package watch fans keyspace change events out to subscribers filtered by
+// namespace and key or key prefix.
+package watch
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// Type is the kind of change an Event reports.
+type Type string
+
+const (
+	Put    Type = "put"    // a key was written or updated in place
+	Delete Type = "delete" // a key was deleted or invalidated
+	Expire Type = "expire" // a key was dropped after its TTL passed
+	Evict  Type = "evict"  // a key was dropped to stay within capacity
+	// Resync tells a subscriber that events may have been missed, e.g. when
+	// the owners of the watched keys changed, and it should re-read them.
+	Resync Type = "resync"
+)
+
+// Event is a change to one key.
+type Event struct {
+	Type      Type      `json:"type"`
+	Namespace string    `json:"ns,omitempty"`
+	Key       string    `json:"key,omitempty"`
+	Value     []byte    `json:"value,omitempty"` // Put of a plain value only; shared, do not modify
+	Time      time.Time `json:"time"`
+}
+
+// Filter selects the events a subscription receives: those of Key, or of
+// every key starting with Prefix, in Namespace.
+type Filter struct {
+	Namespace string
+	Key       string
+	Prefix    string
+}
+
+func (f Filter) match(ev Event) bool {
+	if ev.Namespace != f.Namespace {
+		return false
+	}
+	if f.Key != "" {
+		return ev.Key == f.Key
+	}
+	return strings.HasPrefix(ev.Key, f.Prefix)
+}
+
+// Buffer is how many events a subscriber may fall behind by before it is
+// dropped.
+const Buffer = 256
+
+// Subscription receives matching events on C until it is closed. C is closed
+// by Close, or by the hub when the subscriber falls more than Buffer events
+// behind; Dropped then reports true.
+type Subscription struct {
+	C       <-chan Event
+	c       chan Event
+	filter  Filter
+	hub     *Hub
+	dropped bool // guarded by hub.mu
+}
+
+// Hub distributes published events to subscriptions. The zero value is
+// ready to use.
+type Hub struct {
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscribe starts a subscription for the events matching f.
+func (h *Hub) Subscribe(f Filter) *Subscription {
+	c := make(chan Event, Buffer)
+	s := &Subscription{C: c, c: c, filter: f, hub: h}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.subs == nil {
+		h.subs = make(map[*Subscription]struct{})
+	}
+	h.subs[s] = struct{}{}
+	return s
+}
+
+// Publish hands ev to every matching subscription without blocking.
+func (h *Hub) Publish(ev Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		if !s.filter.match(ev) {
+			continue
+		}
+		select {
+		case s.c <- ev:
+		default:
+			s.dropped = true
+			delete(h.subs, s)
+			close(s.c)
+		}
+	}
+}
+
+// Len returns the number of live subscriptions.
+func (h *Hub) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	if _, ok := s.hub.subs[s]; ok {
+		delete(s.hub.subs, s)
+		close(s.c)
+	}
+}
+
+// Dropped reports whether the hub ended the subscription because it fell
+// behind.
+func (s *Subscription) Dropped() bool {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.dropped
+}
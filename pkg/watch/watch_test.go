@@ -0,0 +1,38 @@
+package watch
+
+import "testing"
+
+func TestHubFiltersEvents(t *testing.T) {
+	var h Hub
+	byKey := h.Subscribe(Filter{Namespace: "default", Key: "cfg"})
+	byPrefix := h.Subscribe(Filter{Namespace: "default", Prefix: "cfg:"})
+	defer byKey.Close()
+	defer byPrefix.Close()
+
+	h.Publish(Event{Type: Put, Namespace: "default", Key: "cfg"})
+	h.Publish(Event{Type: Put, Namespace: "default", Key: "cfg:a"})
+	h.Publish(Event{Type: Delete, Namespace: "other", Key: "cfg:b"})
+
+	if ev := <-byKey.C; ev.Key != "cfg" || len(byKey.C) != 0 {
+		t.Fatalf("key subscription got %+v and %d more", ev, len(byKey.C))
+	}
+	if ev := <-byPrefix.C; ev.Key != "cfg:a" || len(byPrefix.C) != 0 {
+		t.Fatalf("prefix subscription got %+v and %d more", ev, len(byPrefix.C))
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	var h Hub
+	s := h.Subscribe(Filter{Prefix: ""})
+	for range Buffer + 1 {
+		h.Publish(Event{Type: Put, Key: "k"})
+	}
+	n := 0
+	for range s.C {
+		n++
+	}
+	if n != Buffer || !s.Dropped() || h.Len() != 0 {
+		t.Fatalf("received %d events, dropped=%v, subs=%d", n, s.Dropped(), h.Len())
+	}
+	s.Close() // no-op after the hub closed it
+}
@@ -0,0 +1,95 @@
+package writebehind
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Sink is the backing store a Writer flushes batches to. Write must either
+// persist the whole batch or return an error; failed batches are retried.
+type Sink interface {
+	Write(ctx context.Context, batch []Record) error
+}
+
+// FileSink appends every record as one JSON line to a file.
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *FileSink) Write(_ context.Context, batch []Record) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for _, r := range batch {
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	file, err := os.OpenFile(f.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(buf.Bytes()); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// DefaultHTTPTimeout bounds a batch POSTed by an HTTPSink without a Timeout.
+const DefaultHTTPTimeout = 10 * time.Second
+
+// HTTPSink POSTs every batch as a JSON array to URL and expects a 2xx reply.
+type HTTPSink struct {
+	URL     string
+	Client  *http.Client  // nil means http.DefaultClient
+	Timeout time.Duration // per batch, reply included (default DefaultHTTPTimeout)
+}
+
+func (h *HTTPSink) Write(ctx context.Context, batch []Record) error {
+	body, err := json.Marshal(batch)
+	if err != nil {
+		return err
+	}
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = DefaultHTTPTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("writebehind: sink returned %s", resp.Status)
+	}
+	return nil
+}
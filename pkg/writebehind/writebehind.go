@@ -0,0 +1,234 @@
+// Package writebehind acknowledges writes from memory and flushes them to a
+// backing store asynchronously. Records are coalesced per key, so only the
+// latest write of a key since the last flush is sent, and flushed in batches.
+// Batches that keep failing after the configured retries are appended to a
+// dead-letter file instead of being dropped. Writes of new keys arriving while
+// too many keys are pending are dropped and counted.
+package writebehind
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Op is the kind of write a Record carries.
+type Op string
+
+const (
+	OpPut    Op = "put"
+	OpDelete Op = "delete"
+)
+
+// Record is one write to be persisted to the backing store.
+type Record struct {
+	Op        Op        `json:"op"`
+	Namespace string    `json:"namespace"`
+	Key       string    `json:"key"`
+	Value     []byte    `json:"value,omitempty"`
+	ExpireAt  int64     `json:"expire_at,omitempty"` // unix milliseconds, 0 if none
+	Time      time.Time `json:"time"`
+}
+
+// Config tunes batching and retries. Zero values pick the defaults.
+type Config struct {
+	BatchSize      int           // flush once this many keys are pending (default 100)
+	FlushInterval  time.Duration // flush at least this often (default 1s)
+	MaxRetries     int           // attempts after the first before dead-lettering (default 3, negative for none)
+	RetryBackoff   time.Duration // initial backoff, doubled per retry (default 100ms)
+	DeadLetterPath string        // file failed batches are appended to; empty drops them
+	MaxPending     int           // keys pending at most; writes of further keys are dropped (default 100000)
+}
+
+func (c *Config) setDefaults() {
+	if c.BatchSize <= 0 {
+		c.BatchSize = 100
+	}
+	if c.FlushInterval <= 0 {
+		c.FlushInterval = time.Second
+	}
+	if c.MaxRetries < 0 {
+		c.MaxRetries = 0
+	} else if c.MaxRetries == 0 {
+		c.MaxRetries = 3
+	}
+	if c.RetryBackoff <= 0 {
+		c.RetryBackoff = 100 * time.Millisecond
+	}
+	if c.MaxPending <= 0 {
+		c.MaxPending = 100000
+	}
+}
+
+// Stats is a point-in-time view of a Writer's backlog.
+type Stats struct {
+	Pending int    // keys waiting to be flushed
+	Dropped uint64 // writes dropped because MaxPending keys were pending
+}
+
+// Writer buffers records and flushes them to a Sink in the background.
+type Writer struct {
+	sink Sink
+	cfg  Config
+	dead *FileSink
+
+	mu      sync.Mutex
+	pending map[string]Record // latest record per key since the last flush
+	order   []string          // keys in the order they first became pending
+	dropped atomic.Uint64
+
+	// ctx is canceled when Close gives up waiting, which aborts sink writes
+	// and retry backoffs in flight
+	ctx    context.Context
+	cancel context.CancelFunc
+	kick   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// New starts a Writer that flushes to sink.
+func New(sink Sink, cfg Config) *Writer {
+	cfg.setDefaults()
+	ctx, cancel := context.WithCancel(context.Background())
+	w := &Writer{
+		sink:    sink,
+		cfg:     cfg,
+		pending: make(map[string]Record),
+		ctx:     ctx,
+		cancel:  cancel,
+		kick:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	if cfg.DeadLetterPath != "" {
+		w.dead = &FileSink{Path: cfg.DeadLetterPath}
+	}
+	go w.loop()
+	return w
+}
+
+// Enqueue schedules r to be written. It never blocks: a newer record for the
+// same key replaces one that has not been flushed yet, and a record of a new
+// key is dropped if MaxPending keys are already pending.
+func (w *Writer) Enqueue(r Record) {
+	w.mu.Lock()
+	if _, ok := w.pending[r.Key]; !ok {
+		if len(w.pending) >= w.cfg.MaxPending {
+			w.mu.Unlock()
+			w.dropped.Add(1)
+			return
+		}
+		w.order = append(w.order, r.Key)
+	}
+	w.pending[r.Key] = r
+	full := len(w.pending) >= w.cfg.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		select {
+		case w.kick <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// Pending returns the number of keys waiting to be flushed.
+func (w *Writer) Pending() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return len(w.pending)
+}
+
+// Stats returns the writer's backlog.
+func (w *Writer) Stats() Stats {
+	return Stats{Pending: w.Pending(), Dropped: w.dropped.Load()}
+}
+
+// Close stops the writer after a final flush of what is pending, waiting for
+// that flush until ctx is done. Batches still failing then are dead-lettered
+// without further retries.
+func (w *Writer) Close(ctx context.Context) {
+	close(w.stop)
+	select {
+	case <-w.done:
+	case <-ctx.Done():
+		w.cancel()
+	}
+}
+
+func (w *Writer) loop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-w.kick:
+		case <-w.stop:
+			for w.Pending() > 0 {
+				w.flush()
+			}
+			return
+		}
+		w.flush()
+	}
+}
+
+// flush sends everything pending, batch by batch.
+func (w *Writer) flush() {
+	w.mu.Lock()
+	pending, order := w.pending, w.order
+	w.pending, w.order = make(map[string]Record), nil
+	w.mu.Unlock()
+
+	batch := make([]Record, 0, min(len(order), w.cfg.BatchSize))
+	for _, key := range order {
+		batch = append(batch, pending[key])
+		if len(batch) == w.cfg.BatchSize {
+			w.write(batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		w.write(batch)
+	}
+}
+
+// write delivers one batch, retrying with exponential backoff and
+// dead-lettering it once the retries are exhausted.
+func (w *Writer) write(batch []Record) {
+	backoff := w.cfg.RetryBackoff
+	var err error
+	for attempt := 0; attempt <= w.cfg.MaxRetries && w.ctx.Err() == nil; attempt++ {
+		if attempt > 0 {
+			t := time.NewTimer(backoff)
+			select {
+			case <-t.C:
+			case <-w.ctx.Done():
+				t.Stop()
+				continue
+			}
+			backoff *= 2
+		}
+		if err = w.sink.Write(w.ctx, batch); err == nil {
+			return
+		}
+		log.Printf("[WriteBehind] batch of %d failed (attempt %d): %v", len(batch), attempt+1, err)
+	}
+	if err == nil {
+		err = w.ctx.Err()
+	}
+
+	if w.dead == nil {
+		log.Printf("[WriteBehind] dropping batch of %d: %v", len(batch), err)
+		return
+	}
+	if derr := w.dead.Write(context.Background(), batch); derr != nil {
+		log.Printf("[WriteBehind] dead-letter write failed, dropping batch of %d: %v", len(batch), derr)
+		return
+	}
+	log.Printf("[WriteBehind] dead-lettered batch of %d to %s", len(batch), w.dead.Path)
+}
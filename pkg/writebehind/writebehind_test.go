@@ -0,0 +1,162 @@
+package writebehind
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memSink records batches and fails the first failN writes.
+type memSink struct {
+	mu      sync.Mutex
+	failN   int
+	batches [][]Record
+}
+
+func (m *memSink) Write(_ context.Context, batch []Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.failN > 0 {
+		m.failN--
+		return errors.New("sink down")
+	}
+	m.batches = append(m.batches, append([]Record(nil), batch...))
+	return nil
+}
+
+func (m *memSink) records() []Record {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var out []Record
+	for _, b := range m.batches {
+		out = append(out, b...)
+	}
+	return out
+}
+
+func TestWriterCoalescesAndBatches(t *testing.T) {
+	sink := &memSink{}
+	w := New(sink, Config{BatchSize: 2, FlushInterval: time.Hour})
+
+	w.Enqueue(Record{Op: OpPut, Key: "counter", Value: []byte("1")})
+	w.Enqueue(Record{Op: OpPut, Key: "counter", Value: []byte("2")})
+	w.Enqueue(Record{Op: OpDelete, Key: "session"}) // second key fills the batch
+
+	deadline := time.Now().Add(time.Second)
+	for len(sink.records()) < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	w.Close(context.Background())
+
+	got := sink.records()
+	if len(got) != 2 {
+		t.Fatalf("flushed %d records, want 2: %+v", len(got), got)
+	}
+	if got[0].Key != "counter" || string(got[0].Value) != "2" {
+		t.Fatalf("first record = %+v, want latest counter value", got[0])
+	}
+	if got[1].Key != "session" || got[1].Op != OpDelete {
+		t.Fatalf("second record = %+v", got[1])
+	}
+}
+
+func TestWriterRetriesThenSucceeds(t *testing.T) {
+	sink := &memSink{failN: 2}
+	w := New(sink, Config{FlushInterval: time.Hour, MaxRetries: 3, RetryBackoff: time.Millisecond})
+	w.Enqueue(Record{Op: OpPut, Key: "k", Value: []byte("v")})
+	w.Close(context.Background())
+
+	if got := sink.records(); len(got) != 1 {
+		t.Fatalf("flushed %d records after retries, want 1", len(got))
+	}
+}
+
+func TestWriterDeadLetters(t *testing.T) {
+	dlq := filepath.Join(t.TempDir(), "dead.jsonl")
+	sink := &memSink{failN: 100}
+	w := New(sink, Config{FlushInterval: time.Hour, MaxRetries: 1, RetryBackoff: time.Millisecond, DeadLetterPath: dlq})
+	w.Enqueue(Record{Op: OpPut, Namespace: "sessions", Key: "k", Value: []byte("v")})
+	w.Close(context.Background())
+
+	f, err := os.Open(dlq)
+	if err != nil {
+		t.Fatalf("dead-letter file: %v", err)
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	var recs []Record
+	for sc.Scan() {
+		var r Record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			t.Fatalf("decode dead letter: %v", err)
+		}
+		recs = append(recs, r)
+	}
+	if len(recs) != 1 || recs[0].Key != "k" || recs[0].Namespace != "sessions" || string(recs[0].Value) != "v" {
+		t.Fatalf("dead letters = %+v", recs)
+	}
+}
+
+func TestWriterCloseAbortsRetries(t *testing.T) {
+	dlq := filepath.Join(t.TempDir(), "dead.jsonl")
+	sink := &memSink{failN: 100}
+	w := New(sink, Config{FlushInterval: time.Hour, MaxRetries: 10, RetryBackoff: time.Minute, DeadLetterPath: dlq})
+	w.Enqueue(Record{Op: OpPut, Key: "k", Value: []byte("v")})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	w.Close(ctx)
+	select {
+	case <-w.done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer still backing off after Close gave up")
+	}
+	if data, err := os.ReadFile(dlq); err != nil || len(data) == 0 {
+		t.Fatalf("aborted batch not dead-lettered: %v", err)
+	}
+}
+
+func TestWriterDropsNewKeysWhenFull(t *testing.T) {
+	sink := &memSink{}
+	w := New(sink, Config{BatchSize: 10, FlushInterval: time.Hour, MaxPending: 2})
+	w.Enqueue(Record{Op: OpPut, Key: "a"})
+	w.Enqueue(Record{Op: OpPut, Key: "b"})
+	w.Enqueue(Record{Op: OpPut, Key: "c"})                     // dropped
+	w.Enqueue(Record{Op: OpPut, Key: "a", Value: []byte("2")}) // replaces a pending key
+	if st := w.Stats(); st.Pending != 2 || st.Dropped != 1 {
+		t.Fatalf("Stats = %+v, want 2 pending and 1 dropped", st)
+	}
+	w.Close(context.Background())
+	if got := sink.records(); len(got) != 2 || string(got[0].Value) != "2" {
+		t.Fatalf("flushed %+v", got)
+	}
+}
+
+func TestHTTPSinkTimesOut(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	sink := &HTTPSink{URL: srv.URL, Timeout: 50 * time.Millisecond}
+	start := time.Now()
+	if err := sink.Write(context.Background(), []Record{{Op: OpPut, Key: "k"}}); err == nil {
+		t.Fatal("write to a hung sink succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("write gave up after %v", elapsed)
+	}
+}